@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/adapter/encryption"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/backend"
+	"github.com/nisibz/go-auth-tests/internal/core/port"
+	"github.com/nisibz/go-auth-tests/internal/core/service"
+)
+
+const usage = `Usage: cli <command> [arguments]
+
+Commands:
+  audit verify    Check the audit log hash chain for gaps and edits
+  keys rotate     Re-encrypt users stored in plaintext or under an old key
+  users import    Create users from a CSV or NDJSON file, see users import -h
+  users export    Write users to a CSV or NDJSON file, see users export -h
+`
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+// run executes the command and returns the process exit code. It is separate
+// from main so that deferred cleanup runs before exiting.
+func run(args []string) int {
+	if len(args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	appConfig, err := config.New()
+	if err != nil {
+		slog.Error("Error loading environment variables", "error", err)
+		return 1
+	}
+	if appConfig.Database.Driver == "memory" {
+		// a memory database lives in the server process, out of reach of the CLI
+		fmt.Fprintln(os.Stderr, "the CLI cannot reach a DB_DRIVER memory database, use mongodb, postgres or sqlite")
+		return 2
+	}
+
+	var fieldEncryptor port.FieldEncryptor
+	if appConfig.Encryption.KeyFile != "" {
+		fieldEncryptor, err = encryption.NewFieldEncryptor(appConfig.Encryption.KeyFile, appConfig.Encryption.UserFields)
+		if err != nil {
+			slog.Error("Error loading encryption keys", "error", err)
+			return 1
+		}
+	}
+
+	stores, err := backend.Open(appConfig, fieldEncryptor)
+	if err != nil {
+		slog.Error("Error opening the database", "driver", appConfig.Database.Driver, "error", err)
+		return 1
+	}
+	defer stores.Close()
+
+	switch command := args[0] + " " + args[1]; command {
+	case "audit verify":
+		return auditVerify(stores)
+	case "keys rotate":
+		return keysRotate(stores, appConfig)
+	case "users import":
+		return usersImport(stores, appConfig, args[2:])
+	case "users export":
+		return usersExport(stores, appConfig, args[2:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		return 2
+	}
+}
+
+func auditVerify(stores *backend.Stores) int {
+	auditService := service.NewAuditService(stores.Audit)
+
+	result, err := auditService.Verify(context.Background())
+	if err != nil {
+		slog.Error("Error verifying audit log", "error", err)
+		return 1
+	}
+
+	for _, problem := range result.Problems {
+		fmt.Println(problem)
+	}
+	if !result.Valid {
+		fmt.Printf("audit log is NOT intact: %d entries checked, %d problems found\n", result.Checked, len(result.Problems))
+		return 1
+	}
+	fmt.Printf("audit log is intact: %d entries checked\n", result.Checked)
+	return 0
+}
+
+func keysRotate(stores *backend.Stores, appConfig *config.Container) int {
+	if appConfig.Encryption.KeyFile == "" || stores.Reencrypt == nil {
+		fmt.Fprintln(os.Stderr, "ENCRYPTION_KEY_FILE is not set, personal data is stored in plaintext")
+		return 2
+	}
+
+	reencrypted, err := stores.Reencrypt(context.Background())
+	if err != nil {
+		slog.Error("Error re-encrypting users", "reencrypted", reencrypted, "error", err)
+		return 1
+	}
+	fmt.Printf("%d users re-encrypted\n", reencrypted)
+	return 0
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/adapter/mailer"
+	"github.com/nisibz/go-auth-tests/internal/adapter/schema"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/backend"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/port"
+	"github.com/nisibz/go-auth-tests/internal/core/service"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+// newUserService wires a user service the same way the HTTP server does
+func newUserService(stores *backend.Stores, appConfig *config.Container) (*service.UserService, error) {
+	if err := util.InitJWTSecretKey(appConfig); err != nil {
+		return nil, fmt.Errorf("failed to initialize JWT secret key: %w", err)
+	}
+
+	var emailSender port.Mailer = mailer.NewLogMailer()
+	if appConfig.Mail.Host != "" {
+		emailSender = mailer.NewSMTPMailer(appConfig.Mail)
+	}
+
+	metadataValidator, err := schema.NewMetadataValidator(appConfig.Metadata.UserSchemaFile, appConfig.Metadata.AdminSchemaFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.NewUserService(
+		stores.Users,
+		stores.Sessions,
+		stores.Tokens,
+		stores.LoginHistory,
+		stores.Blobs,
+		emailSender,
+		service.NewAuditService(stores.Audit),
+		metadataValidator,
+		appConfig.App.URL,
+	), nil
+}
+
+func usersImport(stores *backend.Stores, appConfig *config.Container, args []string) int {
+	flags := flag.NewFlagSet("users import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: cli users import [flags] <file>\n\nThe file is CSV with a header row or NDJSON, - reads standard input.\nColumns: %s\n\nFlags:\n", strings.Join(domain.ImportColumns, ", "))
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", "", "csv or ndjson, guessed from the file extension by default")
+	dryRun := flags.Bool("dry-run", false, "validate the file and report what would happen without writing anything")
+	onDuplicate := flags.String("on-duplicate", domain.ImportOnDuplicateSkip, "what to do with existing emails: skip or upsert")
+	invite := flags.Bool("invite", false, "email every created user a sign-in link")
+	asJSON := flags.Bool("json", false, "print the full report as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	path := flags.Arg(0)
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			*format = domain.ImportFormatCSV
+		case ".ndjson", ".jsonl":
+			*format = domain.ImportFormatNDJSON
+		default:
+			fmt.Fprintln(os.Stderr, "cannot guess the file format, use -format csv or -format ndjson")
+			return 2
+		}
+	}
+
+	var input io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			slog.Error("Error opening import file", "error", err)
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+
+	userService, err := newUserService(stores, appConfig)
+	if err != nil {
+		slog.Error("Error initializing user service", "error", err)
+		return 1
+	}
+
+	opts := &domain.ImportOptions{Format: *format, OnDuplicate: *onDuplicate, DryRun: *dryRun, SendInvites: *invite}
+	report, err := userService.ImportUsers(context.Background(), input, opts)
+	if err != nil {
+		slog.Error("Error importing users", "error", err)
+		if report == nil {
+			return 1
+		}
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			slog.Error("Error writing report", "error", err)
+			return 1
+		}
+	} else {
+		for _, row := range report.Rows {
+			if len(row.Errors) > 0 {
+				fmt.Printf("line %d (%s): %s: %s\n", row.Line, row.Email, row.Action, strings.Join(row.Errors, "; "))
+			}
+		}
+		prefix := ""
+		if report.DryRun {
+			prefix = "dry run, nothing written: "
+		}
+		fmt.Printf("%s%d created, %d updated, %d skipped, %d invalid, %d failed\n",
+			prefix, report.Created, report.Updated, report.Skipped, report.Invalid, report.Failed)
+	}
+
+	if err != nil || report.Invalid > 0 || report.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func usersExport(stores *backend.Stores, appConfig *config.Container, args []string) int {
+	flags := flag.NewFlagSet("users export", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: cli users export [flags]\n\nColumns: %s\n\nFlags:\n", strings.Join(domain.ExportColumns, ", "))
+		flags.PrintDefaults()
+	}
+	format := flags.String("format", domain.ExportFormatCSV, "csv, excel or ndjson")
+	columns := flags.String("columns", "", "comma separated columns, "+strings.Join(domain.DefaultExportColumns, ",")+" by default")
+	status := flags.String("status", "", "only export users with this status")
+	role := flags.String("role", "", "only export users with this role")
+	search := flags.String("q", "", "full-text search over name and email")
+	email := flags.String("email", "", "only export emails starting with this prefix")
+	name := flags.String("name", "", "only export names starting with this prefix")
+	sortSpec := flags.String("sort", "", "comma separated sort fields, prefixed with - for descending order")
+	output := flags.String("o", "-", "file to write, - writes to standard output")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	switch *format {
+	case domain.ExportFormatCSV, domain.ExportFormatExcel, domain.ExportFormatNDJSON:
+	default:
+		fmt.Fprintln(os.Stderr, "unknown format, use csv, excel or ndjson")
+		return 2
+	}
+	exportColumns, err := domain.ParseExportColumns(*columns)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	sort, err := domain.ParseSort(*sortSpec, domain.UserSortFields)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	userService, err := newUserService(stores, appConfig)
+	if err != nil {
+		slog.Error("Error initializing user service", "error", err)
+		return 1
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			slog.Error("Error creating export file", "error", err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	filter := &domain.UserFilter{
+		EmailPrefix: *email,
+		NamePrefix:  *name,
+		Search:      *search,
+		Status:      *status,
+		Role:        *role,
+		Sort:        sort,
+	}
+	opts := &domain.ExportOptions{Format: *format, Columns: exportColumns}
+	count, err := userService.ExportUsers(context.Background(), out, filter, opts)
+	if err != nil {
+		slog.Error("Error exporting users", "exported", count, "error", err)
+		return 1
+	}
+	if *output != "-" {
+		fmt.Fprintf(os.Stderr, "%d users exported to %s\n", count, *output)
+	}
+	return 0
+}
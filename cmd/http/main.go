@@ -6,12 +6,18 @@ import (
 	"log/slog"
 	"os"
 	"time"
+	// Timezones in user profiles are checked against the embedded database
+	// so that validation does not depend on the host
+	_ "time/tzdata"
 
 	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/adapter/encryption"
 	"github.com/nisibz/go-auth-tests/internal/adapter/handler/http"
 	"github.com/nisibz/go-auth-tests/internal/adapter/logger"
-	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb"
-	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb/repository"
+	"github.com/nisibz/go-auth-tests/internal/adapter/mailer"
+	"github.com/nisibz/go-auth-tests/internal/adapter/schema"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/backend"
+	"github.com/nisibz/go-auth-tests/internal/core/port"
 	"github.com/nisibz/go-auth-tests/internal/core/service"
 	"github.com/nisibz/go-auth-tests/internal/core/util"
 )
@@ -25,42 +31,56 @@ func main() {
 
 	logger.Set(appConfig.App)
 
-	slog.Info("Connecting to MongoDB...")
-	mongoClient, err := mongodb.NewMongoClient(appConfig.Mongo)
+	err = util.InitJWTSecretKey(appConfig)
 	if err != nil {
-		slog.Error("Error connecting to MongoDB", "error", err)
+		slog.Error("Failed to initialize JWT secret key", "error", err)
 		os.Exit(1)
 	}
-	slog.Info("Successfully connected to MongoDB")
-
-	// Graceful shutdown for MongoDB client
-	defer func() {
-		slog.Info("Closing MongoDB connection...")
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		if err := mongoClient.Disconnect(ctx); err != nil {
-			slog.Error("Error closing MongoDB connection", "error", err)
+
+	var emailSender port.Mailer
+	if appConfig.Mail.Host != "" {
+		emailSender = mailer.NewSMTPMailer(appConfig.Mail)
+	} else {
+		slog.Warn("MAIL_HOST is not set, outgoing emails will only be logged")
+		emailSender = mailer.NewLogMailer()
+	}
+
+	var fieldEncryptor port.FieldEncryptor
+	if appConfig.Encryption.KeyFile != "" {
+		fieldEncryptor, err = encryption.NewFieldEncryptor(appConfig.Encryption.KeyFile, appConfig.Encryption.UserFields)
+		if err != nil {
+			slog.Error("Error loading encryption keys", "error", err)
+			os.Exit(1)
 		}
-		slog.Info("MongoDB connection closed.")
-	}()
+	}
 
-	err = util.InitJWTSecretKey(appConfig)
+	stores, err := backend.Open(appConfig, fieldEncryptor)
 	if err != nil {
-		slog.Error("Failed to initialize JWT secret key", "error", err)
+		slog.Error("Error opening the database", "driver", appConfig.Database.Driver, "error", err)
+		os.Exit(1)
+	}
+	defer stores.Close()
+
+	metadataValidator, err := schema.NewMetadataValidator(appConfig.Metadata.UserSchemaFile, appConfig.Metadata.AdminSchemaFile)
+	if err != nil {
+		slog.Error("Error loading metadata schemas", "error", err)
 		os.Exit(1)
 	}
 
-	userRepository := repository.NewUserRepository(mongoClient, appConfig.Mongo.DB_NAME, "user")
-	userService := service.NewUserService(userRepository)
-	userHandler := http.NewUserHandler(userService)
+	auditService := service.NewAuditService(stores.Audit)
+	userService := service.NewUserService(stores.Users, stores.Sessions, stores.Tokens, stores.LoginHistory, stores.Blobs, emailSender, auditService, metadataValidator, appConfig.App.URL)
+	userHandler := http.NewUserHandler(userService, appConfig.Auth.StepUpMaxAge)
 
-	authSvc := service.NewAuthService(userRepository)
+	authSvc := service.NewAuthService(stores.Users, stores.Sessions, stores.Tokens, stores.LoginHistory, emailSender, auditService, appConfig.App.URL, appConfig.Retention.LoginHistorySize)
 	authHandler := http.NewAuthHandler(authSvc)
+	adminHandler := http.NewAdminHandler(authSvc, userService, auditService)
 
 	router, err := http.NewRouter(
 		appConfig.HTTP,
 		authHandler,
 		userHandler,
+		adminHandler,
+		authSvc,
 		userService,
 	)
 	if err != nil {
@@ -84,6 +104,38 @@ func main() {
 		}
 	}()
 
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			<-ticker.C
+			purged, err := userService.PurgeDeletedUsers(context.Background(), appConfig.Retention.DeletedUserGracePeriod)
+			if err != nil {
+				slog.Error("Failed to purge deleted users", "error", err)
+			}
+			if purged > 0 {
+				slog.Info("Purged deleted users", "count", purged)
+			}
+		}
+	}()
+
+	if stores.Reencrypt != nil {
+		go func() {
+			ticker := time.NewTicker(appConfig.Encryption.ReencryptInterval)
+			defer ticker.Stop()
+			for {
+				reencrypted, err := stores.Reencrypt(context.Background())
+				if err != nil {
+					slog.Error("Failed to re-encrypt users", "error", err)
+				}
+				if reencrypted > 0 {
+					slog.Info("Re-encrypted users", "count", reencrypted)
+				}
+				<-ticker.C
+			}
+		}()
+	}
+
 	listenAddr := fmt.Sprintf("%s:%s", appConfig.HTTP.URL, appConfig.HTTP.Port)
 	err = router.Serve(listenAddr)
 	if err != nil {
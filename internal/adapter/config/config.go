@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,14 +14,24 @@ type (
 	Container struct {
 		App          *App
 		HTTP         *HTTP
+		Database     *Database
 		Mongo        *Mongo
+		Postgres     *Postgres
+		SQLite       *SQLite
 		JwtSecretKey *JWT
+		Auth         *Auth
+		Mail         *Mail
+		Retention    *Retention
+		Metadata     *Metadata
+		Storage      *Storage
+		Encryption   *Encryption
 	}
 
 	// App contains all the environment variables for the application
 	App struct {
 		Name string
 		Env  string
+		URL  string
 	}
 
 	// HTTP contains all the environment variables for the http server
@@ -29,15 +42,79 @@ type (
 		AllowedOrigins string
 	}
 
+	// Database contains which storage backend the application runs on
+	Database struct {
+		// Driver is "mongodb", "postgres", "sqlite", or "memory" to keep
+		// everything in memory and lose it on restart, for local development
+		Driver string
+	}
+
 	// Mongo contains all the environment variables for MongoDB
 	Mongo struct {
 		URI     string
 		DB_NAME string
 	}
 
+	// Postgres contains all the environment variables for PostgreSQL
+	Postgres struct {
+		URL string
+	}
+
+	// SQLite contains all the environment variables for SQLite
+	SQLite struct {
+		Path string
+	}
+
 	JWT struct {
 		JWT_SECRET_KEY string
 	}
+
+	// Auth contains the authentication policy
+	Auth struct {
+		// StepUpMaxAge is how recently users must have entered their
+		// password or second factor to use sensitive routes
+		StepUpMaxAge time.Duration
+	}
+
+	// Mail contains all the environment variables for the SMTP relay
+	Mail struct {
+		Host     string
+		Port     string
+		Username string
+		Password string
+		From     string
+	}
+
+	// Retention contains how much account history is kept
+	Retention struct {
+		LoginHistorySize int64
+		// DeletedUserGracePeriod is how long deleted users can be restored
+		DeletedUserGracePeriod time.Duration
+	}
+
+	// Metadata contains where the JSON schemas of user metadata are read from
+	Metadata struct {
+		UserSchemaFile  string
+		AdminSchemaFile string
+	}
+
+	// Storage contains where uploaded files such as avatars are kept
+	Storage struct {
+		// Blob is "local" to keep files in BlobDir or "gridfs" to keep them
+		// in MongoDB
+		Blob    string
+		BlobDir string
+	}
+
+	// Encryption contains the field-level encryption of personal data
+	Encryption struct {
+		// KeyFile turns encryption on when set
+		KeyFile    string
+		UserFields []string
+		// ReencryptInterval is how often users still stored in plaintext or
+		// under an old key are re-encrypted
+		ReencryptInterval time.Duration
+	}
 )
 
 // New creates a new container instance
@@ -52,6 +129,7 @@ func New() (*Container, error) {
 	app := &App{
 		Name: os.Getenv("APP_NAME"),
 		Env:  os.Getenv("APP_ENV"),
+		URL:  os.Getenv("APP_URL"),
 	}
 
 	http := &HTTP{
@@ -61,19 +139,114 @@ func New() (*Container, error) {
 		AllowedOrigins: os.Getenv("HTTP_ALLOWED_ORIGINS"),
 	}
 
+	database := &Database{
+		Driver: getEnv("DB_DRIVER", "mongodb"),
+	}
+
 	mongo := &Mongo{
 		URI:     os.Getenv("DB_URI"),
 		DB_NAME: os.Getenv("DB_NAME"),
 	}
 
+	postgres := &Postgres{
+		URL: os.Getenv("POSTGRES_URL"),
+	}
+
+	sqlite := &SQLite{
+		Path: getEnv("SQLITE_PATH", "data/app.db"),
+	}
+
 	jwt := &JWT{
 		JWT_SECRET_KEY: os.Getenv("JWT_SECRET_KEY"),
 	}
 
+	auth := &Auth{
+		StepUpMaxAge: getEnvDuration("STEP_UP_MAX_AGE", 10*time.Minute),
+	}
+
+	mail := &Mail{
+		Host:     os.Getenv("MAIL_HOST"),
+		Port:     os.Getenv("MAIL_PORT"),
+		Username: os.Getenv("MAIL_USERNAME"),
+		Password: os.Getenv("MAIL_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}
+
+	retention := &Retention{
+		LoginHistorySize:       getEnvInt("LOGIN_HISTORY_SIZE", 50),
+		DeletedUserGracePeriod: getEnvDuration("DELETED_USER_GRACE_PERIOD", 30*24*time.Hour),
+	}
+
+	metadata := &Metadata{
+		UserSchemaFile:  os.Getenv("USER_METADATA_SCHEMA_FILE"),
+		AdminSchemaFile: os.Getenv("ADMIN_METADATA_SCHEMA_FILE"),
+	}
+
+	storage := &Storage{
+		Blob:    getEnv("BLOB_STORAGE", "local"),
+		BlobDir: getEnv("BLOB_STORAGE_DIR", "data/blobs"),
+	}
+
+	encryption := &Encryption{
+		KeyFile:           os.Getenv("ENCRYPTION_KEY_FILE"),
+		UserFields:        getEnvList("ENCRYPTED_USER_FIELDS", "name,email,pending_email,profile.display_name,profile.phone"),
+		ReencryptInterval: getEnvDuration("ENCRYPTION_REENCRYPT_INTERVAL", time.Hour),
+	}
+
 	return &Container{
 		app,
 		http,
+		database,
 		mongo,
+		postgres,
+		sqlite,
 		jwt,
+		auth,
+		mail,
+		retention,
+		metadata,
+		storage,
+		encryption,
 	}, nil
 }
+
+// getEnv reads an environment variable, falling back to def when it is unset
+func getEnv(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// getEnvList reads a comma separated environment variable, falling back to def
+// when it is unset
+func getEnvList(key, def string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key, def), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvInt reads an integer environment variable, falling back to def when it
+// is unset or not a number
+func getEnvInt(key string, def int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// getEnvDuration reads a duration environment variable such as "720h", falling
+// back to def when it is unset, invalid or not positive. Every duration is
+// used as a period or a delay, which cannot be zero or negative.
+func getEnvDuration(key string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return def
+	}
+	return value
+}
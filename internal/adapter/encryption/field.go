@@ -0,0 +1,218 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// valuePrefix starts every encrypted value, followed by the key ID, the
+// wrapped data key and the sealed value, separated by colons.
+const valuePrefix = "enc:v1:"
+
+// keySize is the size of every key, for AES-256 and HMAC-SHA256
+const keySize = 32
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// keyFile is the JSON layout of the keyfile. Keys are base64 encoded.
+type keyFile struct {
+	// Primary is the ID of the key new values are encrypted with
+	Primary string            `json:"primary"`
+	Keys    map[string]string `json:"keys"`
+	// IndexKey computes blind indexes. It cannot be rotated without
+	// the plaintext, so it is kept apart from the encryption keys.
+	IndexKey string `json:"index_key"`
+}
+
+// FieldEncryptor uses envelope encryption: every value is sealed with
+// AES-256-GCM under its own random data key, and the data key is stored
+// next to it, wrapped by a key encryption key from the keyfile. Rotating
+// the primary key only needs the values rewritten, never a shared key
+// re-encrypted everywhere at once.
+type FieldEncryptor struct {
+	primary  string
+	keys     map[string]cipher.AEAD
+	indexKey []byte
+	fields   []string
+}
+
+// NewFieldEncryptor loads the keys from the keyfile at path and encrypts the
+// given user fields, which must be some of domain.EncryptableUserFields.
+func NewFieldEncryptor(path string, fields []string) (*FieldEncryptor, error) {
+	for _, field := range fields {
+		if !slices.Contains(domain.EncryptableUserFields, field) {
+			return nil, fmt.Errorf("field %q cannot be encrypted, expected some of %s", field, strings.Join(domain.EncryptableUserFields, ", "))
+		}
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyfile: %w", err)
+	}
+	var file keyFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse keyfile %s: %w", path, err)
+	}
+
+	e := &FieldEncryptor{primary: file.Primary, keys: map[string]cipher.AEAD{}, fields: fields}
+	for id, encoded := range file.Keys {
+		if !keyIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid key ID %q in keyfile, use letters, digits, - and _", id)
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q in keyfile: %w", id, err)
+		}
+		if e.keys[id], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := e.keys[file.Primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyfile", file.Primary)
+	}
+	if e.indexKey, err = decodeKey(file.IndexKey); err != nil {
+		return nil, fmt.Errorf("index key in keyfile: %w", err)
+	}
+	return e, nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("not valid base64")
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with aead under a random nonce, which it prepends
+// to the ciphertext
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func (e *FieldEncryptor) Encrypts(field string) bool {
+	return slices.Contains(e.fields, field)
+}
+
+// Encrypt seals value with a new data key. The field name is authenticated
+// with the value, so that a ciphertext copied into another field fails to
+// decrypt.
+func (e *FieldEncryptor) Encrypt(field, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+	wrappedKey, err := seal(e.keys[e.primary], dataKey, []byte(e.primary))
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(dataAEAD, []byte(value), []byte(field))
+	if err != nil {
+		return "", err
+	}
+
+	encoding := base64.RawStdEncoding
+	return e.CurrentPrefix() + encoding.EncodeToString(wrappedKey) + ":" + encoding.EncodeToString(sealed), nil
+}
+
+func (e *FieldEncryptor) Decrypt(field, value string) (string, error) {
+	if !strings.HasPrefix(value, valuePrefix) {
+		return value, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(value, valuePrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed encrypted value")
+	}
+	keyID := parts[0]
+	keyAEAD, ok := e.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("value is encrypted with key %q which is not in the keyfile", keyID)
+	}
+	encoding := base64.RawStdEncoding
+	wrappedKey, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("malformed encrypted value")
+	}
+	sealed, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("malformed encrypted value")
+	}
+
+	dataKey, err := open(keyAEAD, wrappedKey, []byte(keyID))
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(dataAEAD, sealed, []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s: %w", field, err)
+	}
+	return string(plaintext), nil
+}
+
+func (e *FieldEncryptor) EncryptedPrefix() string {
+	return valuePrefix
+}
+
+func (e *FieldEncryptor) CurrentPrefix() string {
+	return valuePrefix + e.primary + ":"
+}
+
+// BlindIndex is the HMAC-SHA256 of the field name and value under the index
+// key, so that equal values in different fields do not share an index.
+func (e *FieldEncryptor) BlindIndex(field, value string) string {
+	mac := hmac.New(sha256.New, e.indexKey)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
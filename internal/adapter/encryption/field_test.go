@@ -0,0 +1,153 @@
+package encryption_test
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/encryption"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// testKeys are the keys of a keyfile, by ID
+type testKeys map[string]string
+
+func newTestKeys(t *testing.T, ids ...string) testKeys {
+	t.Helper()
+	keys := testKeys{}
+	for _, id := range append(ids, "index") {
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		require.NoError(t, err)
+		keys[id] = base64.StdEncoding.EncodeToString(key)
+	}
+	return keys
+}
+
+// writeKeyfile writes a keyfile with every key but the index key, encrypting
+// with primary
+func writeKeyfile(t *testing.T, keys testKeys, primary string) string {
+	t.Helper()
+	file := map[string]any{"primary": primary, "keys": map[string]string{}, "index_key": keys["index"]}
+	for id, key := range keys {
+		if id != "index" {
+			file["keys"].(map[string]string)[id] = key
+		}
+	}
+	raw, err := json.Marshal(file)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, raw, 0o600))
+	return path
+}
+
+func newEncryptor(t *testing.T, keys testKeys, primary string) *encryption.FieldEncryptor {
+	t.Helper()
+	encryptor, err := encryption.NewFieldEncryptor(writeKeyfile(t, keys, primary), domain.EncryptableUserFields)
+	require.NoError(t, err)
+	return encryptor
+}
+
+func TestFieldEncryptor_RoundTrip(t *testing.T) {
+	encryptor := newEncryptor(t, newTestKeys(t, "k1"), "k1")
+
+	encrypted, err := encryptor.Encrypt(domain.EncryptedFieldEmail, "jane@example.com")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, "enc:v1:k1:"))
+	assert.NotContains(t, encrypted, "jane")
+
+	// Every value gets its own data key and nonce
+	again, err := encryptor.Encrypt(domain.EncryptedFieldEmail, "jane@example.com")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again)
+
+	decrypted, err := encryptor.Decrypt(domain.EncryptedFieldEmail, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", decrypted)
+
+	// Values stored before encryption was enabled are read as they are
+	plain, err := encryptor.Decrypt(domain.EncryptedFieldEmail, "jane@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "jane@example.com", plain)
+}
+
+func TestFieldEncryptor_EmptyValue(t *testing.T) {
+	encryptor := newEncryptor(t, newTestKeys(t, "k1"), "k1")
+
+	encrypted, err := encryptor.Encrypt(domain.EncryptedFieldPhone, "")
+	require.NoError(t, err)
+	assert.Empty(t, encrypted)
+	decrypted, err := encryptor.Decrypt(domain.EncryptedFieldPhone, "")
+	require.NoError(t, err)
+	assert.Empty(t, decrypted)
+}
+
+func TestFieldEncryptor_ValueMovedToAnotherField(t *testing.T) {
+	encryptor := newEncryptor(t, newTestKeys(t, "k1"), "k1")
+
+	encrypted, err := encryptor.Encrypt(domain.EncryptedFieldEmail, "jane@example.com")
+	require.NoError(t, err)
+
+	_, err = encryptor.Decrypt(domain.EncryptedFieldPendingEmail, encrypted)
+	assert.ErrorContains(t, err, "failed to decrypt pending_email")
+}
+
+func TestFieldEncryptor_UnknownKey(t *testing.T) {
+	keys := newTestKeys(t, "k1", "k2")
+	encrypted, err := newEncryptor(t, keys, "k2").Encrypt(domain.EncryptedFieldName, "Jane Doe")
+	require.NoError(t, err)
+
+	delete(keys, "k2")
+	_, err = newEncryptor(t, keys, "k1").Decrypt(domain.EncryptedFieldName, encrypted)
+	assert.ErrorContains(t, err, `key "k2" which is not in the keyfile`)
+
+	_, err = newEncryptor(t, keys, "k1").Decrypt(domain.EncryptedFieldName, "enc:v1:k1:not-a-value")
+	assert.ErrorContains(t, err, "malformed encrypted value")
+}
+
+func TestFieldEncryptor_Rotation(t *testing.T) {
+	keys := newTestKeys(t, "k1", "k2")
+	encrypted, err := newEncryptor(t, keys, "k1").Encrypt(domain.EncryptedFieldName, "Jane Doe")
+	require.NoError(t, err)
+
+	rotated := newEncryptor(t, keys, "k2")
+	assert.Equal(t, "enc:v1:k2:", rotated.CurrentPrefix())
+	assert.False(t, strings.HasPrefix(encrypted, rotated.CurrentPrefix()))
+	decrypted, err := rotated.Decrypt(domain.EncryptedFieldName, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Doe", decrypted)
+}
+
+func TestFieldEncryptor_BlindIndex(t *testing.T) {
+	keys := newTestKeys(t, "k1", "k2")
+	encryptor := newEncryptor(t, keys, "k1")
+
+	index := encryptor.BlindIndex(domain.EncryptedFieldEmail, "jane@example.com")
+	assert.Len(t, index, 64)
+	assert.Equal(t, index, encryptor.BlindIndex(domain.EncryptedFieldEmail, "jane@example.com"))
+	assert.NotEqual(t, index, encryptor.BlindIndex(domain.EncryptedFieldEmail, "john@example.com"))
+	assert.NotEqual(t, index, encryptor.BlindIndex(domain.EncryptedFieldPendingEmail, "jane@example.com"))
+	// The index key is not rotated with the primary key
+	assert.Equal(t, index, newEncryptor(t, keys, "k2").BlindIndex(domain.EncryptedFieldEmail, "jane@example.com"))
+}
+
+func TestNewFieldEncryptor_InvalidKeyfile(t *testing.T) {
+	keys := newTestKeys(t, "k1")
+
+	_, err := encryption.NewFieldEncryptor(writeKeyfile(t, keys, "k2"), nil)
+	assert.ErrorContains(t, err, `primary key "k2" is not in the keyfile`)
+
+	_, err = encryption.NewFieldEncryptor(writeKeyfile(t, keys, "k1"), []string{"password"})
+	assert.ErrorContains(t, err, `field "password" cannot be encrypted`)
+
+	keys["k1"] = base64.StdEncoding.EncodeToString([]byte("short"))
+	_, err = encryption.NewFieldEncryptor(writeKeyfile(t, keys, "k1"), nil)
+	assert.ErrorContains(t, err, "must be 32 bytes")
+}
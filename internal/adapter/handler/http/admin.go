@@ -0,0 +1,158 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/port"
+)
+
+type AdminHandler struct {
+	authService  port.AuthService
+	userService  port.UserService
+	auditService port.AuditService
+}
+
+func NewAdminHandler(authService port.AuthService, userService port.UserService, auditService port.AuditService) *AdminHandler {
+	return &AdminHandler{
+		authService:  authService,
+		userService:  userService,
+		auditService: auditService,
+	}
+}
+
+func (h *AdminHandler) Impersonate(c *gin.Context) {
+	actorValue, exists := c.Get(authorizationActorKey)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return
+	}
+	actor, _ := actorValue.(*domain.User)
+
+	userID := c.Param("id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	token, session, err := h.authService.Impersonate(c.Request.Context(), actor, userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "failed to impersonate user: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": session.ExpiresAt,
+	})
+}
+
+func (h *AdminHandler) RestoreUser(c *gin.Context) {
+	userID := c.Param("id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	user, err := h.userService.RestoreUser(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "failed to restore user: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+type SetUserStatusRequest struct {
+	Status string     `json:"status" binding:"required,oneof=active suspended banned pending"`
+	Reason string     `json:"reason" binding:"max=500"`
+	Until  *time.Time `json:"until"`
+}
+
+func (h *AdminHandler) SetUserStatus(c *gin.Context) {
+	userID := c.Param("id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	var req SetUserStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.SetUserStatus(c.Request.Context(), userID, version, req.Status, req.Reason, req.Until)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrVersionConflict):
+			abortPreconditionFailed(c)
+		case errors.Is(err, domain.ErrInvalidStatus):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, domain.ErrForbidden):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"error": "failed to change user status: " + err.Error()})
+		}
+		return
+	}
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+type ListAuditQuery struct {
+	ActorID  string    `form:"actor_id"`
+	TargetID string    `form:"target_id"`
+	Action   string    `form:"action"`
+	Outcome  string    `form:"outcome" binding:"omitempty,oneof=success failure"`
+	From     time.Time `form:"from"`
+	To       time.Time `form:"to"`
+	Limit    int64     `form:"limit,default=50" binding:"min=1,max=500"`
+	Offset   int64     `form:"offset,default=0" binding:"min=0"`
+}
+
+func (h *AdminHandler) ListAudit(c *gin.Context) {
+	var query ListAuditQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query parameters: " + err.Error()})
+		return
+	}
+
+	filter := &domain.AuditFilter{
+		ActorID:  query.ActorID,
+		TargetID: query.TargetID,
+		Action:   query.Action,
+		Outcome:  query.Outcome,
+		From:     query.From,
+		To:       query.To,
+	}
+	entries, err := h.auditService.List(c.Request.Context(), filter, query.Limit, query.Offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list audit entries: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
@@ -0,0 +1,281 @@
+package http_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	handlerhttp "github.com/nisibz/go-auth-tests/internal/adapter/handler/http"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockAuditService struct {
+	mock.Mock
+}
+
+func (m *MockAuditService) Record(ctx context.Context, event *domain.AuditEvent) {
+	m.Called(ctx, event)
+}
+
+func (m *MockAuditService) List(ctx context.Context, filter *domain.AuditFilter, limit, offset int64) ([]*domain.AuditEntry, error) {
+	args := m.Called(ctx, filter, limit, offset)
+	return args.Get(0).([]*domain.AuditEntry), args.Error(1)
+}
+
+func (m *MockAuditService) Verify(ctx context.Context) (*domain.AuditVerification, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(*domain.AuditVerification), args.Error(1)
+}
+
+func TestListAudit_Filters(t *testing.T) {
+	mockAudit := new(MockAuditService)
+	handler := handlerhttp.NewAdminHandler(new(MockAuthService), new(MockUserService), mockAudit)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/admin/audit", handler.ListAudit)
+
+	expectedFilter := &domain.AuditFilter{Action: domain.AuditActionLogin, Outcome: domain.AuditOutcomeFailure}
+	entries := []*domain.AuditEntry{{Seq: 2, Action: domain.AuditActionLogin, Outcome: domain.AuditOutcomeFailure}}
+	mockAudit.On("List", mock.Anything, expectedFilter, int64(20), int64(0)).Return(entries, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/audit?action=auth.login&outcome=failure&limit=20", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	mockAudit.AssertExpectations(t)
+}
+
+func TestListAudit_InvalidOutcome(t *testing.T) {
+	mockAudit := new(MockAuditService)
+	handler := handlerhttp.NewAdminHandler(new(MockAuthService), new(MockUserService), mockAudit)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/admin/audit", handler.ListAudit)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/audit?outcome=maybe", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	mockAudit.AssertNotCalled(t, "List")
+}
+
+func TestRestoreUser_EmailTaken(t *testing.T) {
+	mockUser := new(MockUserService)
+	handler := handlerhttp.NewAdminHandler(new(MockAuthService), mockUser, new(MockAuditService))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/admin/users/:id/restore", handler.RestoreUser)
+
+	mockUser.On("RestoreUser", mock.Anything, "60d5ecf0a1b2c3d4e5f6a7b8").Return(nil, domain.ErrEmailTaken)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/60d5ecf0a1b2c3d4e5f6a7b8/restore", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	mockUser.AssertExpectations(t)
+}
+
+func TestSetUserStatus_InvalidStatus(t *testing.T) {
+	mockUser := new(MockUserService)
+	handler := handlerhttp.NewAdminHandler(new(MockAuthService), mockUser, new(MockAuditService))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PUT("/admin/users/:id/status", handler.SetUserStatus)
+
+	body := `{"status": "frozen"}`
+	req := httptest.NewRequest(http.MethodPut, "/admin/users/60d5ecf0a1b2c3d4e5f6a7b8/status", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	mockUser.AssertNotCalled(t, "SetUserStatus")
+}
+
+func TestPatchUserMetadata_InvalidMetadata(t *testing.T) {
+	mockUser := new(MockUserService)
+	handler := handlerhttp.NewAdminHandler(new(MockAuthService), mockUser, new(MockAuditService))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PATCH("/admin/users/:id/metadata", handler.PatchUserMetadata)
+
+	patch := map[string]any{"plan": 42.0}
+	problems := &domain.ProfileValidationError{Problems: []string{"metadata/plan: got number, want string"}}
+	mockUser.On("UpdateAdminMetadata", mock.Anything, "60d5ecf0a1b2c3d4e5f6a7b8", int64(3), patch).Return(nil, problems)
+
+	req := httptest.NewRequest(http.MethodPatch, "/admin/users/60d5ecf0a1b2c3d4e5f6a7b8/metadata", strings.NewReader(`{"plan": 42}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", `"3"`)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "metadata/plan")
+	mockUser.AssertExpectations(t)
+}
+
+func TestPatchUserMetadata_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"user not found", fmt.Errorf("failed to get user for update: %w", domain.ErrUserNotFound), http.StatusNotFound},
+		{"storage failure", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockUser := new(MockUserService)
+			handler := handlerhttp.NewAdminHandler(new(MockAuthService), mockUser, new(MockAuditService))
+
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			router.PATCH("/admin/users/:id/metadata", handler.PatchUserMetadata)
+
+			patch := map[string]any{"plan": "pro"}
+			mockUser.On("UpdateAdminMetadata", mock.Anything, "60d5ecf0a1b2c3d4e5f6a7b8", int64(3), patch).Return(nil, tt.err)
+
+			req := httptest.NewRequest(http.MethodPatch, "/admin/users/60d5ecf0a1b2c3d4e5f6a7b8/metadata", strings.NewReader(`{"plan": "pro"}`))
+			req.Header.Set("Content-Type", "application/merge-patch+json")
+			req.Header.Set("If-Match", `"3"`)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.want, resp.Code)
+			mockUser.AssertExpectations(t)
+		})
+	}
+}
+
+func TestImportUsers_DryRun(t *testing.T) {
+	mockUser := new(MockUserService)
+	handler := handlerhttp.NewAdminHandler(new(MockAuthService), mockUser, new(MockAuditService))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/admin/users/import", handler.ImportUsers)
+
+	expectedOpts := &domain.ImportOptions{
+		Format:      domain.ImportFormatCSV,
+		OnDuplicate: domain.ImportOnDuplicateUpsert,
+		DryRun:      true,
+	}
+	report := &domain.ImportReport{DryRun: true, Created: 1, Rows: []*domain.ImportRowResult{
+		{Line: 2, Email: "jane@example.com", Action: domain.ImportActionCreated},
+	}}
+	mockUser.On("ImportUsers", mock.Anything, mock.Anything, expectedOpts).Return(report, nil)
+
+	body := "name,email\nJane Doe,jane@example.com\n"
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/import?dry_run=true&on_duplicate=upsert", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"dry_run":true`)
+	mockUser.AssertExpectations(t)
+}
+
+func TestImportUsers_UnsupportedMediaType(t *testing.T) {
+	mockUser := new(MockUserService)
+	handler := handlerhttp.NewAdminHandler(new(MockAuthService), mockUser, new(MockAuditService))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/admin/users/import", handler.ImportUsers)
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/import", strings.NewReader(`[]`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+	mockUser.AssertNotCalled(t, "ImportUsers")
+}
+
+func TestExportUsers_Columns(t *testing.T) {
+	mockUser := new(MockUserService)
+	handler := handlerhttp.NewAdminHandler(new(MockAuthService), mockUser, new(MockAuditService))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/admin/users/export", handler.ExportUsers)
+
+	expectedFilter := &domain.UserFilter{Status: domain.UserStatusActive}
+	expectedOpts := &domain.ExportOptions{Format: domain.ExportFormatNDJSON, Columns: []string{"id", "email"}}
+	mockUser.On("ExportUsers", mock.Anything, mock.Anything, expectedFilter, expectedOpts).
+		Return(`{"email":"john@example.com","id":"60d5ecf0a1b2c3d4e5f6a7b8"}`+"\n", int64(1), nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/users/export?format=ndjson&columns=id,email&status=active", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/x-ndjson", resp.Header().Get("Content-Type"))
+	assert.Contains(t, resp.Header().Get("Content-Disposition"), ".ndjson")
+	assert.Contains(t, resp.Body.String(), "john@example.com")
+	mockUser.AssertExpectations(t)
+}
+
+func TestExportUsers_PasswordIsNotAColumn(t *testing.T) {
+	mockUser := new(MockUserService)
+	handler := handlerhttp.NewAdminHandler(new(MockAuthService), mockUser, new(MockAuditService))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/admin/users/export", handler.ExportUsers)
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/users/export?columns=email,password", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	mockUser.AssertNotCalled(t, "ExportUsers")
+}
+
+func TestExportUsers_EncryptedFilter(t *testing.T) {
+	mockUser := new(MockUserService)
+	handler := handlerhttp.NewAdminHandler(new(MockAuthService), mockUser, new(MockAuditService))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/admin/users/export", handler.ExportUsers)
+
+	mockUser.On("ExportUsers", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+		Return(nil, int64(0), fmt.Errorf("failed to export users: %w: email", domain.ErrEncryptedField))
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/users/export?email=john", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Header().Get("Content-Type"), "application/json")
+	assert.Empty(t, resp.Header().Get("Content-Disposition"))
+	mockUser.AssertExpectations(t)
+}
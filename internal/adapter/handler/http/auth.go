@@ -1,10 +1,13 @@
 package http
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
 	"github.com/nisibz/go-auth-tests/internal/core/port"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
 )
 
 type AuthHandler struct {
@@ -20,7 +23,7 @@ func NewAuthHandler(authService port.AuthService) *AuthHandler {
 type RegisterRequest struct {
 	Name     string `json:"name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required,min=8"`
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -34,8 +37,12 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	token, err := h.authService.Register(req.Name, req.Email, req.Password)
+	token, err := h.authService.Register(c.Request.Context(), req.Name, req.Email, req.Password)
 	if err != nil {
+		if errors.Is(err, domain.ErrWeakPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -55,7 +62,171 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := h.authService.Login(req.Email, req.Password)
+	token, err := h.authService.Login(c.Request.Context(), req.Email, req.Password)
+	if err != nil {
+		var mfaRequired *domain.MFARequiredError
+		if errors.As(err, &mfaRequired) {
+			c.JSON(http.StatusOK, gin.H{
+				"mfa_required": true,
+				"mfa_token":    mfaRequired.Token,
+				"mfa_method":   mfaRequired.Method,
+				"mfa_methods":  mfaRequired.Methods,
+			})
+			return
+		}
+		if errors.Is(err, domain.ErrRateLimited) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		if abortIfAccountInactive(c, err) {
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+func (h *AuthHandler) RequestMagicLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.RequestMagicLink(c.Request.Context(), req.Email); err != nil {
+		if errors.Is(err, domain.ErrRateLimited) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send magic link"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "if an account exists for this email, a sign-in link has been sent"})
+}
+
+type ConsumeMagicLinkRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (h *AuthHandler) ConsumeMagicLink(c *gin.Context) {
+	var req ConsumeMagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.authService.ConsumeMagicLink(c.Request.Context(), req.Token)
+	if err != nil {
+		if abortIfAccountInactive(c, err) {
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired sign-in link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+type VerifyMFARequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+	var req VerifyMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.authService.VerifyMFA(c.Request.Context(), req.MFAToken, req.Code)
+	if err != nil {
+		if abortIfAccountInactive(c, err) {
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidMFACode) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "sign-in expired, log in again"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+type ResendMFACodeRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Method   string `json:"method"`
+}
+
+func (h *AuthHandler) ResendMFACode(c *gin.Context) {
+	var req ResendMFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.authService.ResendMFACode(c.Request.Context(), req.MFAToken, req.Method)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrRateLimited):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case errors.Is(err, domain.ErrMFAMethodInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, domain.ErrTokenInvalid), errors.Is(err, domain.ErrTokenUsed):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "sign-in expired, log in again"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to send verification code"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "a new verification code has been sent"})
+}
+
+type ReauthenticateRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+func (h *AuthHandler) Reauthenticate(c *gin.Context) {
+	claimsValue, _ := c.Get(authorizationClaimsKey)
+	claims, _ := claimsValue.(*util.Claims)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "session not found in context"})
+		return
+	}
+
+	var req ReauthenticateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, err := h.authService.Reauthenticate(c.Request.Context(), claims, req.Password)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 		return
@@ -63,3 +234,24 @@ func (h *AuthHandler) Login(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"token": token})
 }
+
+func (h *AuthHandler) StopImpersonation(c *gin.Context) {
+	claimsValue, _ := c.Get(authorizationClaimsKey)
+	claims, _ := claimsValue.(*util.Claims)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "session not found in context"})
+		return
+	}
+
+	err := h.authService.StopImpersonation(c.Request.Context(), claims)
+	if err != nil {
+		if errors.Is(err, domain.ErrNotImpersonating) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to stop impersonation: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
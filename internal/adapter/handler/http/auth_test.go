@@ -1,7 +1,9 @@
 package http_test
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -9,6 +11,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 	handlerhttp "github.com/nisibz/go-auth-tests/internal/adapter/handler/http"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -17,16 +21,55 @@ type MockAuthService struct {
 	mock.Mock
 }
 
-func (m *MockAuthService) Register(name, email, password string) (string, error) {
-	args := m.Called(name, email, password)
+func (m *MockAuthService) Register(ctx context.Context, name, email, password string) (string, error) {
+	args := m.Called(ctx, name, email, password)
 	return args.String(0), args.Error(1)
 }
 
-func (m *MockAuthService) Login(email, password string) (string, error) {
-	args := m.Called(email, password)
+func (m *MockAuthService) Login(ctx context.Context, email, password string) (string, error) {
+	args := m.Called(ctx, email, password)
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockAuthService) RequestMagicLink(ctx context.Context, email string) error {
+	args := m.Called(ctx, email)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) ConsumeMagicLink(ctx context.Context, token string) (string, error) {
+	args := m.Called(ctx, token)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockAuthService) VerifyMFA(ctx context.Context, mfaToken, code string) (string, error) {
+	args := m.Called(ctx, mfaToken, code)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockAuthService) ResendMFACode(ctx context.Context, mfaToken, method string) error {
+	args := m.Called(ctx, mfaToken, method)
+	return args.Error(0)
+}
+
+func (m *MockAuthService) Reauthenticate(ctx context.Context, claims *util.Claims, password string) (string, error) {
+	args := m.Called(ctx, claims, password)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockAuthService) Impersonate(ctx context.Context, actor *domain.User, targetID string) (string, *domain.Session, error) {
+	args := m.Called(ctx, actor, targetID)
+	session := args.Get(1)
+	if session == nil {
+		return args.String(0), nil, args.Error(2)
+	}
+	return args.String(0), session.(*domain.Session), args.Error(2)
+}
+
+func (m *MockAuthService) StopImpersonation(ctx context.Context, claims *util.Claims) error {
+	args := m.Called(ctx, claims)
+	return args.Error(0)
+}
+
 func TestRegister_Success(t *testing.T) {
 	mockService := new(MockAuthService)
 	handler := handlerhttp.NewAuthHandler(mockService)
@@ -35,7 +78,7 @@ func TestRegister_Success(t *testing.T) {
 	router := gin.Default()
 	router.POST("/register", handler.Register)
 
-	mockService.On("Register", "John", "john@example.com", "password123").Return("mocked_token", nil)
+	mockService.On("Register", mock.Anything, "John", "john@example.com", "password123").Return("mocked_token", nil)
 
 	body := `{"name": "John", "email": "john@example.com", "password": "password123"}`
 	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
@@ -66,6 +109,29 @@ func TestRegister_ValidationError(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, resp.Code)
 }
 
+func TestRegister_WeakPassword(t *testing.T) {
+	mockService := new(MockAuthService)
+	handler := handlerhttp.NewAuthHandler(mockService)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/register", handler.Register)
+
+	mockService.On("Register", mock.Anything, "John", "john@example.com", "password").
+		Return("", fmt.Errorf("%w: password must contain both letters and digits", domain.ErrWeakPassword))
+
+	body := `{"name": "John", "email": "john@example.com", "password": "password"}`
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "letters and digits")
+	mockService.AssertExpectations(t)
+}
+
 func TestLogin_Unauthorized(t *testing.T) {
 	mockService := new(MockAuthService)
 	handler := handlerhttp.NewAuthHandler(mockService)
@@ -74,7 +140,7 @@ func TestLogin_Unauthorized(t *testing.T) {
 	router := gin.Default()
 	router.POST("/login", handler.Login)
 
-	mockService.On("Login", "invalid@example.com", "wrongpass").Return("", errors.New("invalid credentials"))
+	mockService.On("Login", mock.Anything, "invalid@example.com", "wrongpass").Return("", errors.New("invalid credentials"))
 
 	body := `{"email": "invalid@example.com", "password": "wrongpass"}`
 	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
@@ -85,3 +151,191 @@ func TestLogin_Unauthorized(t *testing.T) {
 
 	assert.Equal(t, http.StatusUnauthorized, resp.Code)
 }
+
+func TestLogin_MFARequired(t *testing.T) {
+	mockService := new(MockAuthService)
+	handler := handlerhttp.NewAuthHandler(mockService)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/login", handler.Login)
+
+	mfaRequired := &domain.MFARequiredError{Token: "mfa_token", Method: domain.MFAMethodEmail, Methods: []string{domain.MFAMethodEmail}}
+	mockService.On("Login", mock.Anything, "john@example.com", "password123").Return("", mfaRequired)
+
+	body := `{"email": "john@example.com", "password": "password123"}`
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"mfa_token":"mfa_token"`)
+	assert.NotContains(t, resp.Body.String(), `"token"`)
+	mockService.AssertExpectations(t)
+}
+
+func TestLogin_AccountSuspended(t *testing.T) {
+	mockService := new(MockAuthService)
+	handler := handlerhttp.NewAuthHandler(mockService)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/login", handler.Login)
+
+	statusErr := &domain.AccountStatusError{Status: domain.UserStatusSuspended, Reason: "chargeback"}
+	mockService.On("Login", mock.Anything, "john@example.com", "password123").Return("", fmt.Errorf("login failed: %w", statusErr))
+
+	body := `{"email": "john@example.com", "password": "password123"}`
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"status":"suspended"`)
+	assert.Contains(t, resp.Body.String(), `"reason":"chargeback"`)
+}
+
+func TestVerifyMFA_InvalidCode(t *testing.T) {
+	mockService := new(MockAuthService)
+	handler := handlerhttp.NewAuthHandler(mockService)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/mfa/verify", handler.VerifyMFA)
+
+	mockService.On("VerifyMFA", mock.Anything, "mfa_token", "000000").Return("", domain.ErrInvalidMFACode)
+
+	body := `{"mfa_token": "mfa_token", "code": "000000"}`
+	req := httptest.NewRequest(http.MethodPost, "/mfa/verify", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestRequestMagicLink_Accepted(t *testing.T) {
+	mockService := new(MockAuthService)
+	handler := handlerhttp.NewAuthHandler(mockService)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/magic-link", handler.RequestMagicLink)
+
+	mockService.On("RequestMagicLink", mock.Anything, "unknown@example.com").Return(nil)
+
+	body := `{"email": "unknown@example.com"}`
+	req := httptest.NewRequest(http.MethodPost, "/magic-link", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestConsumeMagicLink_Invalid(t *testing.T) {
+	mockService := new(MockAuthService)
+	handler := handlerhttp.NewAuthHandler(mockService)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/magic-link/consume", handler.ConsumeMagicLink)
+
+	mockService.On("ConsumeMagicLink", mock.Anything, "used-token").Return("", errors.New("token has already been used"))
+
+	body := `{"token": "used-token"}`
+	req := httptest.NewRequest(http.MethodPost, "/magic-link/consume", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestReauthenticate_Success(t *testing.T) {
+	mockService := new(MockAuthService)
+	handler := handlerhttp.NewAuthHandler(mockService)
+	user := &domain.User{ID: "123", Email: "alice@example.com"}
+	claims := &util.Claims{UserID: "123", SessionID: "session-1"}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/reauthenticate", handlerhttp.AuthenticateAs(user, claims), handler.Reauthenticate)
+
+	mockService.On("Reauthenticate", mock.Anything, claims, "password123").Return("fresh-token", nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/reauthenticate", strings.NewReader(`{"password": "password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `{"token": "fresh-token"}`, resp.Body.String())
+	mockService.AssertExpectations(t)
+}
+
+func TestReauthenticate_InvalidPassword(t *testing.T) {
+	mockService := new(MockAuthService)
+	handler := handlerhttp.NewAuthHandler(mockService)
+	user := &domain.User{ID: "123", Email: "alice@example.com"}
+	claims := &util.Claims{UserID: "123", SessionID: "session-1"}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/reauthenticate", handlerhttp.AuthenticateAs(user, claims), handler.Reauthenticate)
+
+	mockService.On("Reauthenticate", mock.Anything, claims, "wrong-password").Return("", domain.ErrInvalidCredentials)
+
+	req := httptest.NewRequest(http.MethodPost, "/reauthenticate", strings.NewReader(`{"password": "wrong-password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.NotContains(t, resp.Body.String(), "token")
+	mockService.AssertExpectations(t)
+}
+
+func TestReauthenticate_MissingPassword(t *testing.T) {
+	mockService := new(MockAuthService)
+	handler := handlerhttp.NewAuthHandler(mockService)
+	user := &domain.User{ID: "123", Email: "alice@example.com"}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/reauthenticate", handlerhttp.AuthenticateAs(user, &util.Claims{UserID: "123"}), handler.Reauthenticate)
+
+	req := httptest.NewRequest(http.MethodPost, "/reauthenticate", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	mockService.AssertNotCalled(t, "Reauthenticate")
+}
+
+func TestReauthenticate_NoSession(t *testing.T) {
+	mockService := new(MockAuthService)
+	handler := handlerhttp.NewAuthHandler(mockService)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/reauthenticate", handler.Reauthenticate)
+
+	req := httptest.NewRequest(http.MethodPost, "/reauthenticate", strings.NewReader(`{"password": "password123"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	mockService.AssertNotCalled(t, "Reauthenticate")
+}
@@ -0,0 +1,121 @@
+package http
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// avatarMediaTypes lists the image formats accepted for avatars, as sniffed
+// from the file content rather than trusted from the client
+var avatarMediaTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+func (h *UserHandler) UploadAvatar(c *gin.Context) {
+	userValue, exists := c.Get(authorizationPayloadKey)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return
+	}
+	userFromContext, _ := userValue.(*domain.User)
+
+	// Leave room for the multipart headers around the file
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, domain.MaxAvatarUploadSize+64<<10)
+	file, header, err := c.Request.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "avatar must be at most 5 MB"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "avatar file is required in the multipart field \"avatar\""})
+		return
+	}
+	defer file.Close()
+	if header.Size > domain.MaxAvatarUploadSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "avatar must be at most 5 MB"})
+		return
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "failed to read avatar"})
+		return
+	}
+	if !avatarMediaTypes[http.DetectContentType(head[:n])] {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "avatar must be a JPEG, PNG, GIF or WebP image"})
+		return
+	}
+
+	user, err := h.userService.UploadAvatar(c.Request.Context(), userFromContext.ID, io.MultiReader(bytes.NewReader(head[:n]), file))
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidImage):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to upload avatar: " + err.Error()})
+		}
+		return
+	}
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+func (h *UserHandler) DeleteAvatar(c *gin.Context) {
+	userValue, exists := c.Get(authorizationPayloadKey)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return
+	}
+	userFromContext, _ := userValue.(*domain.User)
+
+	if err := h.userService.DeleteAvatar(c.Request.Context(), userFromContext.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete avatar: " + err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetAvatar serves a user's uploaded avatar. Requests carrying the current
+// version in the v query parameter, as in the profile's avatar_url, can be
+// cached forever since a new upload changes the URL.
+func (h *UserHandler) GetAvatar(c *gin.Context) {
+	size := c.DefaultQuery("size", domain.AvatarSizes[0].Name)
+	if !domain.IsValidAvatarSize(size) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "size must be large, medium or small"})
+		return
+	}
+
+	avatar, err := h.userService.OpenAvatar(c.Request.Context(), c.Param("id"), size)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "avatar not found"})
+		return
+	}
+	defer avatar.Content.Close()
+
+	etag := `"` + avatar.Version + "-" + avatar.Size + `"`
+	c.Header("ETag", etag)
+	if c.Query("v") == avatar.Version {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "public, max-age=300")
+	}
+	c.Header("Last-Modified", avatar.Info.ModTime.UTC().Format(http.TimeFormat))
+	if ifNoneMatch(c, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.DataFromReader(http.StatusOK, avatar.Info.Size, avatar.Info.ContentType, avatar.Content, map[string]string{
+		"X-Content-Type-Options": "nosniff",
+	})
+}
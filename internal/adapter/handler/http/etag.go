@@ -0,0 +1,71 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// userETag is the entity tag of a user, derived from its version.
+func userETag(user *domain.User) string {
+	return `"` + strconv.FormatInt(user.Version, 10) + `"`
+}
+
+// userSummaryETag is the entity tag of the public summary of a user. It is
+// weak so that it can never be used in If-Match.
+func userSummaryETag(user *domain.User) string {
+	return `W/"` + strconv.FormatInt(user.Version, 10) + `-summary"`
+}
+
+// requireIfMatch reads the user version the client expects from the
+// If-Match header. It aborts with 428 when the header is missing and with 412
+// when it cannot match any version, and returns false in both cases. "*"
+// matches any version.
+func requireIfMatch(c *gin.Context) (int64, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" {
+		c.AbortWithStatusJSON(http.StatusPreconditionRequired, gin.H{
+			"error": "If-Match header with the user's ETag is required",
+			"code":  "precondition_required",
+		})
+		return 0, false
+	}
+	if header == "*" {
+		return domain.AnyVersion, true
+	}
+
+	// If-Match uses the strong comparison, so weak tags never match.
+	unquoted, err := strconv.Unquote(header)
+	version, convErr := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || convErr != nil || version < 0 {
+		abortPreconditionFailed(c)
+		return 0, false
+	}
+	return version, true
+}
+
+func abortPreconditionFailed(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusPreconditionFailed, gin.H{
+		"error": domain.ErrVersionConflict.Error(),
+		"code":  "precondition_failed",
+	})
+}
+
+// ifNoneMatch reports whether the If-None-Match header matches etag, using
+// the weak comparison.
+func ifNoneMatch(c *gin.Context, etag string) bool {
+	header := c.GetHeader("If-None-Match")
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
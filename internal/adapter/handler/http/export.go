@@ -0,0 +1,77 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type ExportUsersQuery struct {
+	UserFilterQuery
+	Format string `form:"format,default=csv" binding:"oneof=csv excel ndjson"`
+	// Columns is a comma separated list of the fields to export
+	Columns string `form:"columns"`
+}
+
+// exportContentTypes maps export formats to their media type and file
+// extension
+var exportContentTypes = map[string][2]string{
+	domain.ExportFormatCSV:    {"text/csv; charset=utf-8", "csv"},
+	domain.ExportFormatExcel:  {"text/csv; charset=utf-8", "csv"},
+	domain.ExportFormatNDJSON: {"application/x-ndjson", "ndjson"},
+}
+
+// ExportUsers streams every user matching the filters as a file download.
+// Once the first bytes are sent the status can no longer change, so a
+// failure midway only truncates the file and is logged.
+func (h *AdminHandler) ExportUsers(c *gin.Context) {
+	var query ExportUsersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query parameters: " + err.Error()})
+		return
+	}
+
+	filter, err := query.filter()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	columns, err := domain.ParseExportColumns(query.Columns)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	contentType := exportContentTypes[query.Format]
+	filename := fmt.Sprintf("users-%s.%s", time.Now().UTC().Format("20060102-150405"), contentType[1])
+	c.Header("Content-Type", contentType[0])
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	opts := &domain.ExportOptions{Format: query.Format, Columns: columns}
+	count, err := h.userService.ExportUsers(c.Request.Context(), c.Writer, filter, opts)
+	if err != nil {
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			status := http.StatusInternalServerError
+			if errors.Is(err, domain.ErrEncryptedField) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "User export interrupted", "exported", count, "error", err)
+		c.Abort()
+	}
+}
@@ -0,0 +1,20 @@
+package http
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+// AuthenticateAs stands in for AuthMiddleware in tests, signing the request
+// in as user with the given token claims
+func AuthenticateAs(user *domain.User, claims *util.Claims) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(authorizationPayloadKey, user)
+		c.Set(authorizationActorKey, user)
+		if claims != nil {
+			c.Set(authorizationClaimsKey, claims)
+		}
+		c.Next()
+	}
+}
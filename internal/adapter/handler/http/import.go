@@ -0,0 +1,69 @@
+package http
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// maxImportSize bounds the size of an import file. Files are read as a
+// stream, so this only limits how long a single request can run.
+const maxImportSize = 100 << 20
+
+// importMediaTypes maps the accepted content types to import formats
+var importMediaTypes = map[string]string{
+	"text/csv":             domain.ImportFormatCSV,
+	"application/x-ndjson": domain.ImportFormatNDJSON,
+	"application/ndjson":   domain.ImportFormatNDJSON,
+	"application/jsonl":    domain.ImportFormatNDJSON,
+}
+
+type ImportUsersQuery struct {
+	DryRun      bool   `form:"dry_run"`
+	OnDuplicate string `form:"on_duplicate,default=skip" binding:"oneof=skip upsert"`
+	Invite      bool   `form:"invite"`
+}
+
+func (h *AdminHandler) ImportUsers(c *gin.Context) {
+	var query ImportUsersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query parameters: " + err.Error()})
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.ContentType())
+	format, ok := importMediaTypes[mediaType]
+	if !ok {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "import file must be text/csv or application/x-ndjson"})
+		return
+	}
+
+	opts := &domain.ImportOptions{
+		Format:      format,
+		OnDuplicate: query.OnDuplicate,
+		DryRun:      query.DryRun,
+		SendInvites: query.Invite,
+	}
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	report, err := h.userService.ImportUsers(c.Request.Context(), body, opts)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "import file is too large, split it", "report": report})
+		case errors.Is(err, domain.ErrInvalidImport):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "report": report})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to import users: " + err.Error(), "report": report})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
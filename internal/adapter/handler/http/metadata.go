@@ -0,0 +1,115 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// abortIfInvalidProfile aborts with 400 and returns true when err says a
+// profile or metadata change was rejected, listing every problem found.
+func abortIfInvalidProfile(c *gin.Context, err error) bool {
+	if !errors.Is(err, domain.ErrInvalidProfile) {
+		return false
+	}
+	var validationErr *domain.ProfileValidationError
+	if errors.As(err, &validationErr) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": validationErr.Problems})
+		return true
+	}
+	c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	return true
+}
+
+// GetMetadataSchema returns the JSON schema user metadata must follow. An
+// empty schema accepts any object.
+func (h *UserHandler) GetMetadataSchema(c *gin.Context) {
+	schema := h.userService.MetadataSchema(domain.MetadataSectionUser)
+	if schema == nil {
+		schema = json.RawMessage("{}")
+	}
+	c.Data(http.StatusOK, "application/schema+json", schema)
+}
+
+func (h *AdminHandler) GetUserMetadata(c *gin.Context) {
+	userID := c.Param("id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, domain.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user: " + err.Error()})
+		return
+	}
+
+	metadata := user.AdminMetadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusOK, gin.H{"metadata": metadata})
+}
+
+// PatchUserMetadata applies a JSON merge patch to the admin metadata of a
+// user.
+func (h *AdminHandler) PatchUserMetadata(c *gin.Context) {
+	userID := c.Param("id")
+	if userID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user ID is required"})
+		return
+	}
+
+	if mediaType, _, _ := mime.ParseMediaType(c.ContentType()); mediaType != mediaTypeMergePatch && mediaType != "application/json" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "unsupported patch media type, use " + mediaTypeMergePatch})
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPatchSize))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "patch document is too large"})
+		return
+	}
+	var patch map[string]any
+	if err := json.Unmarshal(body, &patch); err != nil || patch == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "patch must be a JSON object"})
+		return
+	}
+
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.UpdateAdminMetadata(c.Request.Context(), userID, version, patch)
+	if err != nil {
+		if abortIfInvalidProfile(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, domain.ErrVersionConflict):
+			abortPreconditionFailed(c)
+		case errors.Is(err, domain.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update metadata: " + err.Error()})
+		}
+		return
+	}
+
+	metadata := user.AdminMetadata
+	if metadata == nil {
+		metadata = map[string]any{}
+	}
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusOK, gin.H{"metadata": metadata})
+}
@@ -1,21 +1,45 @@
 package http
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
 	"github.com/nisibz/go-auth-tests/internal/core/service"
 	"github.com/nisibz/go-auth-tests/internal/core/util"
+	sloggin "github.com/samber/slog-gin"
 )
 
 const (
 	authorizationHeaderKey  = "Authorization"
 	authorizationTypeBearer = "bearer"
 	authorizationPayloadKey = "authorization_payload_user"
+	authorizationClaimsKey  = "authorization_payload_claims"
+	// authorizationActorKey holds the principal really making the request,
+	// which differs from authorizationPayloadKey while an admin impersonates
+	// a user.
+	authorizationActorKey = "authorization_payload_actor"
 )
 
-func AuthMiddleware(userService *service.UserService) gin.HandlerFunc {
+// RequestInfoMiddleware stores the client IP and user agent in the request
+// context for the audit log. AuthMiddleware later adds the principal.
+func RequestInfoMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info := &domain.RequestInfo{
+			IP:        c.ClientIP(),
+			UserAgent: c.Request.UserAgent(),
+		}
+		c.Request = c.Request.WithContext(domain.WithRequestInfo(c.Request.Context(), info))
+		c.Next()
+	}
+}
+
+func AuthMiddleware(authService *service.AuthService, userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader(authorizationHeaderKey)
 		if len(authHeader) == 0 {
@@ -36,21 +60,145 @@ func AuthMiddleware(userService *service.UserService) gin.HandlerFunc {
 		}
 
 		accessToken := fields[1]
-		userID, err := util.ValidateToken(accessToken)
+		claims, err := util.ValidateToken(accessToken)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token: " + err.Error()})
 			return
 		}
 
-		user, err := userService.GetUserByID(c.Request.Context(), userID)
+		if err := authService.VerifySession(c.Request.Context(), claims); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session expired or revoked"})
+			return
+		}
+
+		user, err := userService.GetUserByID(c.Request.Context(), claims.UserID)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "user not found or unauthorized"})
 			return
 		}
+		if err := authService.CheckAccountStatus(c.Request.Context(), user); err != nil {
+			abortIfAccountInactive(c, err)
+			return
+		}
 
-		user.Password = ""
+		actor := user
+		if claims.IsImpersonation() {
+			actor, err = userService.GetUserByID(c.Request.Context(), claims.Act.Subject)
+			if err != nil || actor.Role != domain.RoleAdmin {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "impersonation is no longer allowed"})
+				return
+			}
+			actor.Password = ""
+			sloggin.AddCustomAttributes(c, slog.String("impersonator_id", actor.ID))
+		}
 
+		info := domain.RequestInfoFrom(c.Request.Context())
+		info.UserID = user.ID
+		if claims.IsImpersonation() {
+			info.ImpersonatorID = actor.ID
+		}
+		c.Request = c.Request.WithContext(domain.WithRequestInfo(c.Request.Context(), info))
+
+		user.Password = ""
 		c.Set(authorizationPayloadKey, user)
+		c.Set(authorizationActorKey, actor)
+		c.Set(authorizationClaimsKey, claims)
+		c.Next()
+	}
+}
+
+// abortIfAccountInactive aborts with 403 and returns true when err says the
+// account is not active, telling the client its status.
+func abortIfAccountInactive(c *gin.Context, err error) bool {
+	var statusErr *domain.AccountStatusError
+	if !errors.As(err, &statusErr) {
+		return false
+	}
+	body := gin.H{
+		"error":  statusErr.Error(),
+		"code":   "account_inactive",
+		"status": statusErr.Status,
+	}
+	if statusErr.Reason != "" {
+		body["reason"] = statusErr.Reason
+	}
+	if statusErr.Until != nil {
+		body["until"] = statusErr.Until
+	}
+	c.AbortWithStatusJSON(http.StatusForbidden, body)
+	return true
+}
+
+// RequireRole only lets the request through when the effective user has the
+// given role. It must run after AuthMiddleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userValue, _ := c.Get(authorizationPayloadKey)
+		user, _ := userValue.(*domain.User)
+		if user == nil || user.Role != role {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+			return
+		}
 		c.Next()
 	}
 }
+
+// DenyImpersonation blocks sensitive routes for admins acting as a user. It
+// must run after AuthMiddleware.
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkNotImpersonating(c) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkNotImpersonating aborts with 403 and returns false when the request is
+// made with an impersonation token.
+func checkNotImpersonating(c *gin.Context) bool {
+	claimsValue, _ := c.Get(authorizationClaimsKey)
+	claims, _ := claimsValue.(*util.Claims)
+	if claims != nil && claims.IsImpersonation() {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"error": "this operation is not allowed while impersonating a user",
+			"code":  "impersonation_forbidden",
+		})
+		return false
+	}
+	return true
+}
+
+// RequireRecentAuth rejects requests whose token was not obtained by actively
+// authenticating within maxAge. It must run after AuthMiddleware.
+func RequireRecentAuth(maxAge time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !checkRecentAuth(c, maxAge) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// checkRecentAuth aborts with a step-up challenge and returns false when the
+// user has not authenticated within maxAge.
+func checkRecentAuth(c *gin.Context, maxAge time.Duration) bool {
+	claimsValue, _ := c.Get(authorizationClaimsKey)
+	claims, _ := claimsValue.(*util.Claims)
+	if claims != nil && claims.AuthenticatedWithin(maxAge) {
+		return true
+	}
+
+	seconds := int(maxAge.Seconds())
+	// Challenge format from RFC 9470 (OAuth 2.0 Step Up Authentication)
+	c.Header("WWW-Authenticate", fmt.Sprintf(
+		`Bearer error="insufficient_user_authentication", error_description="a more recent authentication is required", max_age=%d`,
+		seconds,
+	))
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"error":   "recent authentication required",
+		"code":    "reauthentication_required",
+		"max_age": seconds,
+	})
+	return false
+}
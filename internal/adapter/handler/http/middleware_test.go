@@ -0,0 +1,46 @@
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	handlerhttp "github.com/nisibz/go-auth-tests/internal/adapter/handler/http"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequireRecentAuth_NoRecentAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.DELETE("/users/:id", handlerhttp.RequireRecentAuth(5*time.Minute), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/123", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Header().Get("WWW-Authenticate"), `error="insufficient_user_authentication"`)
+	assert.Contains(t, resp.Header().Get("WWW-Authenticate"), "max_age=300")
+	assert.Contains(t, resp.Body.String(), `"code":"reauthentication_required"`)
+}
+
+func TestRequireRole_Forbidden(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/admin/users/:id/impersonate", handlerhttp.RequireRole(domain.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/admin/users/123/impersonate", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+}
@@ -0,0 +1,291 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"reflect"
+	"strings"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+// Patch document media types
+const (
+	mediaTypeMergePatch = "application/merge-patch+json"
+	mediaTypeJSONPatch  = "application/json-patch+json"
+)
+
+var (
+	errUnsupportedPatch = errors.New("unsupported patch media type, use " + mediaTypeMergePatch + " or " + mediaTypeJSONPatch)
+	errPatchTestFailed  = errors.New("patch test operation failed")
+)
+
+// UserPatchRequest validates the fields of a user patch. Profile and
+// metadata are checked by the user service.
+type UserPatchRequest struct {
+	Name     *string `binding:"omitempty,min=1,max=100"`
+	Email    *string `binding:"omitempty,email"`
+	Profile  *domain.ProfilePatch
+	Metadata map[string]any
+}
+
+// parseUserPatch reads a JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902)
+// document against the user's current profile. A plain application/json body
+// is read as a merge patch.
+func parseUserPatch(contentType string, body []byte, current *domain.User) (*UserPatchRequest, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case mediaTypeMergePatch, "application/json":
+		return parseUserMergePatch(body)
+	case mediaTypeJSONPatch:
+		return parseUserJSONPatch(body, current)
+	default:
+		return nil, errUnsupportedPatch
+	}
+}
+
+func parseUserMergePatch(body []byte) (*UserPatchRequest, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil || doc == nil {
+		return nil, errors.New("patch must be a JSON object")
+	}
+
+	patch := &UserPatchRequest{}
+	for field, raw := range doc {
+		if err := setUserPatchField(patch, field, raw); err != nil {
+			return nil, err
+		}
+	}
+	return patch, nil
+}
+
+type jsonPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// parseUserJSONPatch supports paths to top level fields, to profile fields
+// such as /profile/locale and to metadata keys such as /metadata/team.
+// Metadata values are merged like in a merge patch.
+func parseUserJSONPatch(body []byte, current *domain.User) (*UserPatchRequest, error) {
+	var ops []jsonPatchOperation
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return nil, errors.New("patch must be a JSON array of operations")
+	}
+
+	patch := &UserPatchRequest{}
+	for i, op := range ops {
+		path, ok := parseJSONPointer(op.Path)
+		if !ok || len(path) == 0 || len(path) > 2 {
+			return nil, fmt.Errorf("operation %d: invalid path %q", i, op.Path)
+		}
+		switch op.Op {
+		case "add", "replace":
+			if op.Value == nil {
+				return nil, fmt.Errorf("operation %d: value is required", i)
+			}
+			if err := setUserPatchPath(patch, path, op.Value); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+		case "remove":
+			if err := setUserPatchPath(patch, path, json.RawMessage("null")); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+		case "test":
+			var want any
+			if err := json.Unmarshal(op.Value, &want); err != nil {
+				return nil, fmt.Errorf("operation %d: value must be valid JSON", i)
+			}
+			got, err := userPatchPathValue(patch, path, current)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				return nil, fmt.Errorf("%w: %s is not %s", errPatchTestFailed, op.Path, op.Value)
+			}
+		default:
+			return nil, fmt.Errorf("operation %d: unsupported op %q", i, op.Op)
+		}
+	}
+	return patch, nil
+}
+
+// parseJSONPointer splits a JSON pointer (RFC 6901) into its unescaped
+// segments
+func parseJSONPointer(pointer string) ([]string, bool) {
+	rest, ok := strings.CutPrefix(pointer, "/")
+	if !ok {
+		return nil, false
+	}
+	segments := strings.Split(rest, "/")
+	for i, segment := range segments {
+		segments[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(segment)
+	}
+	return segments, true
+}
+
+func setUserPatchPath(patch *UserPatchRequest, path []string, raw json.RawMessage) error {
+	if len(path) == 1 {
+		return setUserPatchField(patch, path[0], raw)
+	}
+	switch path[0] {
+	case "profile":
+		return setProfilePatchField(patch, path[1], raw)
+	case "metadata":
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return errors.New("metadata values must be valid JSON")
+		}
+		if patch.Metadata == nil {
+			patch.Metadata = map[string]any{}
+		}
+		patch.Metadata[path[1]] = value
+		return nil
+	}
+	return fmt.Errorf("%s cannot be changed", strings.Join(path, "/"))
+}
+
+// setUserPatchField records a new value for a patchable field. Name and email
+// are required, so they cannot be removed, and so can't the profile and
+// metadata objects as a whole.
+func setUserPatchField(patch *UserPatchRequest, field string, raw json.RawMessage) error {
+	isNull := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+
+	switch field {
+	case "profile":
+		if isNull {
+			return errors.New("profile cannot be removed, set its fields to null instead")
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return errors.New("profile must be an object")
+		}
+		for name, value := range fields {
+			if err := setProfilePatchField(patch, name, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "metadata":
+		if isNull {
+			return errors.New("metadata cannot be removed, set its keys to null instead")
+		}
+		var metadata map[string]any
+		if err := json.Unmarshal(raw, &metadata); err != nil {
+			return errors.New("metadata must be an object")
+		}
+		patch.Metadata = metadata
+		return nil
+	}
+
+	var target **string
+	switch field {
+	case "name":
+		target = &patch.Name
+	case "email":
+		target = &patch.Email
+	default:
+		return fmt.Errorf("%s cannot be changed", field)
+	}
+
+	if isNull {
+		return fmt.Errorf("%s cannot be removed", field)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return fmt.Errorf("%s must be a string", field)
+	}
+	*target = &value
+	return nil
+}
+
+// setProfilePatchField records a new value for a profile field, where null
+// clears it
+func setProfilePatchField(patch *UserPatchRequest, field string, raw json.RawMessage) error {
+	if patch.Profile == nil {
+		patch.Profile = &domain.ProfilePatch{}
+	}
+	var target **string
+	switch field {
+	case "display_name":
+		target = &patch.Profile.DisplayName
+	case "locale":
+		target = &patch.Profile.Locale
+	case "timezone":
+		target = &patch.Profile.Timezone
+	case "avatar_url":
+		target = &patch.Profile.AvatarURL
+	case "phone":
+		target = &patch.Profile.Phone
+	default:
+		return fmt.Errorf("profile/%s cannot be changed", field)
+	}
+
+	var value *string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return fmt.Errorf("profile/%s must be a string", field)
+	}
+	if value == nil {
+		value = new(string)
+	}
+	*target = value
+	return nil
+}
+
+// userPatchPathValue returns the value at path, as decoded JSON, with the
+// patch so far applied to current.
+func userPatchPathValue(patch *UserPatchRequest, path []string, current *domain.User) (any, error) {
+	if len(path) == 1 {
+		switch path[0] {
+		case "name":
+			if patch.Name != nil {
+				return *patch.Name, nil
+			}
+			return current.Name, nil
+		case "email":
+			if patch.Email != nil {
+				return *patch.Email, nil
+			}
+			return current.Email, nil
+		}
+		return nil, fmt.Errorf("unknown field %s", path[0])
+	}
+
+	// Round trip through JSON so that values compare like the test's value
+	var document map[string]any
+	switch path[0] {
+	case "profile":
+		profile := current.Profile
+		if patch.Profile != nil {
+			profile = patch.Profile.Apply(profile)
+		}
+		if err := remarshal(UserProfileResponse(profile), &document); err != nil {
+			return nil, err
+		}
+	case "metadata":
+		if err := remarshal(current.Metadata, &document); err != nil {
+			return nil, err
+		}
+		document = util.MergePatch(document, patch.Metadata)
+	default:
+		return nil, fmt.Errorf("unknown field %s", path[0])
+	}
+	value, ok := document[path[1]]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s does not exist", errPatchTestFailed, strings.Join(path, "/"))
+	}
+	return value, nil
+}
+
+func remarshal(from, to any) error {
+	raw, err := json.Marshal(from)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, to)
+}
@@ -0,0 +1,101 @@
+package http
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseUserPatch_MergePatch(t *testing.T) {
+	current := &domain.User{Name: "John Doe", Email: "john@example.com"}
+
+	patch, err := parseUserPatch(mediaTypeMergePatch, []byte(`{"name": "Johnny"}`), current)
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, patch.Name) {
+		assert.Equal(t, "Johnny", *patch.Name)
+	}
+	assert.Nil(t, patch.Email)
+}
+
+func TestParseUserPatch_MergePatchRejectsRemovalAndUnknownFields(t *testing.T) {
+	current := &domain.User{Name: "John Doe", Email: "john@example.com"}
+
+	_, err := parseUserPatch(mediaTypeMergePatch, []byte(`{"name": null}`), current)
+	assert.EqualError(t, err, "name cannot be removed")
+
+	_, err = parseUserPatch(mediaTypeMergePatch, []byte(`{"role": "admin"}`), current)
+	assert.EqualError(t, err, "role cannot be changed")
+}
+
+func TestParseUserPatch_JSONPatch(t *testing.T) {
+	current := &domain.User{Name: "John Doe", Email: "john@example.com"}
+	body := `[
+		{"op": "test", "path": "/name", "value": "John Doe"},
+		{"op": "replace", "path": "/name", "value": "Johnny"}
+	]`
+
+	patch, err := parseUserPatch(mediaTypeJSONPatch, []byte(body), current)
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, patch.Name) {
+		assert.Equal(t, "Johnny", *patch.Name)
+	}
+}
+
+func TestParseUserPatch_JSONPatchTestFails(t *testing.T) {
+	current := &domain.User{Name: "John Doe", Email: "john@example.com"}
+	body := `[{"op": "test", "path": "/name", "value": "Someone Else"}]`
+
+	_, err := parseUserPatch(mediaTypeJSONPatch, []byte(body), current)
+
+	assert.True(t, errors.Is(err, errPatchTestFailed))
+}
+
+func TestParseUserPatch_UnsupportedMediaType(t *testing.T) {
+	_, err := parseUserPatch("text/plain", []byte(`name=Johnny`), &domain.User{})
+
+	assert.True(t, errors.Is(err, errUnsupportedPatch))
+}
+
+func TestParseUserPatch_ProfileAndMetadata(t *testing.T) {
+	current := &domain.User{Name: "John Doe", Email: "john@example.com"}
+	body := `{"profile": {"locale": "fr-FR", "phone": null}, "metadata": {"team": "blue", "legacy": null}}`
+
+	patch, err := parseUserPatch(mediaTypeMergePatch, []byte(body), current)
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, patch.Profile) {
+		assert.Equal(t, "fr-FR", *patch.Profile.Locale)
+		assert.Equal(t, "", *patch.Profile.Phone)
+		assert.Nil(t, patch.Profile.Timezone)
+	}
+	assert.Equal(t, map[string]any{"team": "blue", "legacy": nil}, patch.Metadata)
+
+	_, err = parseUserPatch(mediaTypeMergePatch, []byte(`{"profile": {"role": "admin"}}`), current)
+	assert.EqualError(t, err, "profile/role cannot be changed")
+}
+
+func TestParseUserPatch_JSONPatchNestedPaths(t *testing.T) {
+	current := &domain.User{
+		Profile:  domain.UserProfile{Timezone: "Europe/Paris"},
+		Metadata: map[string]any{"team": "blue"},
+	}
+	body := `[
+		{"op": "test", "path": "/profile/timezone", "value": "Europe/Paris"},
+		{"op": "replace", "path": "/profile/timezone", "value": "Asia/Tokyo"},
+		{"op": "test", "path": "/metadata/team", "value": "blue"},
+		{"op": "remove", "path": "/metadata/team"},
+		{"op": "add", "path": "/metadata/a~1b", "value": 1}
+	]`
+
+	patch, err := parseUserPatch(mediaTypeJSONPatch, []byte(body), current)
+
+	assert.NoError(t, err)
+	if assert.NotNil(t, patch.Profile) {
+		assert.Equal(t, "Asia/Tokyo", *patch.Profile.Timezone)
+	}
+	assert.Equal(t, map[string]any{"team": nil, "a/b": 1.0}, patch.Metadata)
+}
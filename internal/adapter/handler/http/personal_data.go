@@ -0,0 +1,85 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// ExportPersonalData downloads a zip archive of everything stored about the
+// authenticated user.
+func (h *UserHandler) ExportPersonalData(c *gin.Context) {
+	userValue, exists := c.Get(authorizationPayloadKey)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return
+	}
+	userFromContext, _ := userValue.(*domain.User)
+
+	filename := fmt.Sprintf("personal-data-%s.zip", time.Now().UTC().Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Header("Cache-Control", "no-store")
+
+	err := h.userService.ExportPersonalData(c.Request.Context(), userFromContext.ID, c.Writer)
+	if err != nil {
+		if !c.Writer.Written() {
+			c.Writer.Header().Del("Content-Type")
+			c.Writer.Header().Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to export personal data: " + err.Error()})
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "Personal data export interrupted", "user_id", userFromContext.ID, "error", err)
+		c.Abort()
+	}
+}
+
+// RequestErasure emails the authenticated user a link to confirm the
+// permanent deletion of their account.
+func (h *UserHandler) RequestErasure(c *gin.Context) {
+	userValue, exists := c.Get(authorizationPayloadKey)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return
+	}
+	userFromContext, _ := userValue.(*domain.User)
+
+	if err := h.userService.RequestErasure(c.Request.Context(), userFromContext.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to request erasure: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"message": "a confirmation link has been sent to your email address"})
+}
+
+type ErasureConfirmRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (h *UserHandler) ConfirmErasure(c *gin.Context) {
+	var req ErasureConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.userService.ConfirmErasure(c.Request.Context(), req.Token)
+	if err != nil {
+		if errors.Is(err, domain.ErrTokenInvalid) || errors.Is(err, domain.ErrTokenUsed) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to erase account: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,87 @@
+package http
+
+import (
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// UserResponse is the JSON representation of a user. Secrets, lockout state,
+// admin metadata and the version, which is sent as the ETag, are left out.
+type UserResponse struct {
+	ID           string              `json:"id"`
+	Name         string              `json:"name"`
+	Email        string              `json:"email"`
+	Profile      UserProfileResponse `json:"profile"`
+	Metadata     map[string]any      `json:"metadata,omitempty"`
+	PendingEmail string              `json:"pending_email,omitempty"`
+	Role         string              `json:"role,omitempty"`
+	Status       string              `json:"status,omitempty"`
+	StatusReason string              `json:"status_reason,omitempty"`
+	StatusUntil  *time.Time          `json:"status_until,omitempty"`
+	MFAMethods   []string            `json:"mfa_methods,omitempty"`
+	PreferredMFA string              `json:"preferred_mfa,omitempty"`
+	CreatedAt    time.Time           `json:"created_at"`
+	DeletedAt    *time.Time          `json:"deleted_at,omitempty"`
+}
+
+type UserProfileResponse struct {
+	DisplayName string `json:"display_name,omitempty"`
+	Locale      string `json:"locale,omitempty"`
+	Timezone    string `json:"timezone,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Phone       string `json:"phone,omitempty"`
+}
+
+func newUserResponse(user *domain.User) *UserResponse {
+	return &UserResponse{
+		ID:           user.ID,
+		Name:         user.Name,
+		Email:        user.Email,
+		Profile:      UserProfileResponse(user.Profile),
+		Metadata:     user.Metadata,
+		PendingEmail: user.PendingEmail,
+		Role:         user.Role,
+		Status:       user.Status,
+		StatusReason: user.StatusReason,
+		StatusUntil:  user.StatusUntil,
+		MFAMethods:   user.MFAMethods,
+		PreferredMFA: user.PreferredMFA,
+		CreatedAt:    user.CreatedAt,
+		DeletedAt:    user.DeletedAt,
+	}
+}
+
+// UserSummaryResponse is the public representation of a user, returned when
+// someone else than the user or an admin looks them up.
+type UserSummaryResponse struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+}
+
+func newUserSummaryResponse(user *domain.User) *UserSummaryResponse {
+	return &UserSummaryResponse{
+		ID:          user.ID,
+		Name:        user.Name,
+		DisplayName: user.Profile.DisplayName,
+		AvatarURL:   user.Profile.AvatarURL,
+	}
+}
+
+func newUserPageResponse[R any](page *domain.Page[*domain.User], newResponse func(*domain.User) R) *domain.Page[R] {
+	items := make([]R, 0, len(page.Items))
+	for _, user := range page.Items {
+		items = append(items, newResponse(user))
+	}
+	return &domain.Page[R]{
+		Items:      items,
+		Total:      page.Total,
+		Limit:      page.Limit,
+		Offset:     page.Offset,
+		NextCursor: page.NextCursor,
+		PrevCursor: page.PrevCursor,
+		HasMore:    page.HasMore,
+	}
+}
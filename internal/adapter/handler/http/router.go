@@ -7,6 +7,7 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
 	"github.com/nisibz/go-auth-tests/internal/core/service"
 	sloggin "github.com/samber/slog-gin"
 )
@@ -19,6 +20,8 @@ func NewRouter(
 	config *config.HTTP,
 	authHandler *AuthHandler,
 	userHandler *UserHandler,
+	adminHandler *AdminHandler,
+	authService *service.AuthService,
 	userService *service.UserService,
 ) (*Router, error) {
 	if config.Env == "development" {
@@ -33,7 +36,7 @@ func NewRouter(
 	ginConfig.AllowOrigins = originsList
 
 	router := gin.New()
-	router.Use(sloggin.New(slog.Default()), gin.Recovery(), cors.New(ginConfig))
+	router.Use(sloggin.New(slog.Default()), gin.Recovery(), cors.New(ginConfig), RequestInfoMiddleware())
 
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(200, gin.H{"message": "welcome to go-auth-tests"})
@@ -45,15 +48,49 @@ func NewRouter(
 		{
 			authRoutes.POST("/register", authHandler.Register)
 			authRoutes.POST("/login", authHandler.Login)
+			authRoutes.POST("/magic-link", authHandler.RequestMagicLink)
+			authRoutes.POST("/magic-link/consume", authHandler.ConsumeMagicLink)
+			authRoutes.POST("/mfa/verify", authHandler.VerifyMFA)
+			authRoutes.POST("/mfa/resend", authHandler.ResendMFACode)
+			authRoutes.POST("/email-change/confirm", userHandler.ConfirmEmailChange)
+			authRoutes.POST("/email-change/cancel", userHandler.CancelEmailChange)
+			authRoutes.POST("/erasure/confirm", userHandler.ConfirmErasure)
+			authRoutes.POST("/reauthenticate", AuthMiddleware(authService, userService), DenyImpersonation(), authHandler.Reauthenticate)
+			authRoutes.POST("/impersonation/stop", AuthMiddleware(authService, userService), authHandler.StopImpersonation)
 		}
 
+		// Avatars are public so that they can be shown with plain <img> tags
+		api.GET("/users/:id/avatar", userHandler.GetAvatar)
+
 		userRoutes := api.Group("/users")
-		userRoutes.Use(AuthMiddleware(userService))
+		userRoutes.Use(AuthMiddleware(authService, userService))
 		{
 			userRoutes.GET("/:id", userHandler.GetUserByID)
+			userRoutes.GET("/metadata/schema", userHandler.GetMetadataSchema)
 			userRoutes.GET("/", userHandler.ListUsers)
 			userRoutes.PUT("/", userHandler.UpdateUser)
-			userRoutes.DELETE("/:id", userHandler.DeleteUser)
+			userRoutes.PATCH("/me", userHandler.PatchUser)
+			userRoutes.PUT("/me/avatar", userHandler.UploadAvatar)
+			userRoutes.DELETE("/me/avatar", userHandler.DeleteAvatar)
+			userRoutes.PUT("/me/password", DenyImpersonation(), userHandler.ChangePassword)
+			userRoutes.PUT("/me/mfa", DenyImpersonation(), userHandler.UpdateMFASettings)
+			userRoutes.GET("/me/logins", userHandler.ListLoginHistory)
+			userRoutes.GET("/me/export", DenyImpersonation(), RequireRecentAuth(userHandler.stepUpMaxAge), userHandler.ExportPersonalData)
+			userRoutes.POST("/me/erasure", DenyImpersonation(), RequireRecentAuth(userHandler.stepUpMaxAge), userHandler.RequestErasure)
+			userRoutes.DELETE("/:id", DenyImpersonation(), RequireRecentAuth(userHandler.stepUpMaxAge), userHandler.DeleteUser)
+		}
+
+		adminRoutes := api.Group("/admin")
+		adminRoutes.Use(AuthMiddleware(authService, userService), DenyImpersonation(), RequireRole(domain.RoleAdmin))
+		{
+			adminRoutes.POST("/users/import", adminHandler.ImportUsers)
+			adminRoutes.GET("/users/export", adminHandler.ExportUsers)
+			adminRoutes.POST("/users/:id/impersonate", adminHandler.Impersonate)
+			adminRoutes.POST("/users/:id/restore", adminHandler.RestoreUser)
+			adminRoutes.PUT("/users/:id/status", adminHandler.SetUserStatus)
+			adminRoutes.GET("/users/:id/metadata", adminHandler.GetUserMetadata)
+			adminRoutes.PATCH("/users/:id/metadata", adminHandler.PatchUserMetadata)
+			adminRoutes.GET("/audit", adminHandler.ListAudit)
 		}
 	}
 
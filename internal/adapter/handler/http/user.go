@@ -1,19 +1,31 @@
 package http
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/nisibz/go-auth-tests/internal/core/domain"
 	"github.com/nisibz/go-auth-tests/internal/core/port"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
 )
 
 type UserHandler struct {
 	userService port.UserService
+	// stepUpMaxAge is how recently the user must have entered their password
+	// or second factor to change their email, delete their account or use
+	// their personal data routes
+	stepUpMaxAge time.Duration
 }
 
-func NewUserHandler(us port.UserService) *UserHandler {
-	return &UserHandler{userService: us}
+func NewUserHandler(us port.UserService, stepUpMaxAge time.Duration) *UserHandler {
+	return &UserHandler{userService: us, stepUpMaxAge: stepUpMaxAge}
 }
 
 func (h *UserHandler) GetUserByID(c *gin.Context) {
@@ -29,12 +41,76 @@ func (h *UserHandler) GetUserByID(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "user not found: " + err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, user)
+
+	// The summary gets its own tag so that a cached summary is never
+	// revalidated as the full user, or the other way around
+	requester := requestingUser(c)
+	full := requester != nil && (requester.ID == user.ID || requester.Role == domain.RoleAdmin)
+	etag := userETag(user)
+	if !full {
+		etag = userSummaryETag(user)
+	}
+	c.Header("ETag", etag)
+	c.Header("Vary", "Authorization")
+	if ifNoneMatch(c, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	if full {
+		c.JSON(http.StatusOK, newUserResponse(user))
+		return
+	}
+	c.JSON(http.StatusOK, newUserSummaryResponse(user))
+}
+
+// requestingUser returns the effective user set by AuthMiddleware, or nil
+func requestingUser(c *gin.Context) *domain.User {
+	userValue, _ := c.Get(authorizationPayloadKey)
+	user, _ := userValue.(*domain.User)
+	return user
+}
+
+// UserFilterQuery holds the query parameters selecting users, shared by the
+// listing and the export
+type UserFilterQuery struct {
+	// Email and Name match the start of the field, ignoring case
+	Email       string    `form:"email"`
+	Name        string    `form:"name"`
+	Q           string    `form:"q"`
+	CreatedFrom time.Time `form:"created_from"`
+	CreatedTo   time.Time `form:"created_to"`
+	Status      string    `form:"status" binding:"omitempty,oneof=active suspended banned pending"`
+	Role        string    `form:"role" binding:"omitempty,oneof=user admin"`
+	// Sort is a comma separated list of fields, prefixed with - for
+	// descending order, for example "-created_at,name"
+	Sort string `form:"sort"`
+}
+
+// filter converts the query parameters, failing when the sort is invalid
+func (q *UserFilterQuery) filter() (*domain.UserFilter, error) {
+	sort, err := domain.ParseSort(q.Sort, domain.UserSortFields)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.UserFilter{
+		EmailPrefix: q.Email,
+		NamePrefix:  q.Name,
+		Search:      q.Q,
+		CreatedFrom: q.CreatedFrom,
+		CreatedTo:   q.CreatedTo,
+		Status:      q.Status,
+		Role:        q.Role,
+		Sort:        sort,
+	}, nil
 }
 
 type ListUsersQuery struct {
-	Limit  int64 `form:"limit,default=10"`
-	Offset int64 `form:"offset,default=0"`
+	Limit  int64 `form:"limit,default=10" binding:"min=1,max=100"`
+	Offset int64 `form:"offset,default=0" binding:"min=0"`
+	UserFilterQuery
+	// Cursor continues a listing from a next or prev cursor returned by a
+	// previous page, instead of using the offset
+	Cursor string `form:"cursor"`
 }
 
 func (h *UserHandler) ListUsers(c *gin.Context) {
@@ -48,12 +124,65 @@ func (h *UserHandler) ListUsers(c *gin.Context) {
 		return
 	}
 
-	users, err := h.userService.ListUsers(c.Request.Context(), query.Limit, query.Offset)
+	filter, err := query.filter()
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if query.Cursor != "" {
+		cursor := &domain.UserCursor{}
+		if err := util.ParseCursor(query.Cursor, cursor); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid cursor"})
+			return
+		}
+		desc := len(filter.Sort) == 1 && filter.Sort[0].Desc
+		if !domain.SupportsUserCursor(filter.Sort) || cursor.Desc != desc {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "cursor does not match the sort order, cursors only support sorting by created_at"})
+			return
+		}
+		filter.Cursor = cursor
+		query.Offset = 0
+	}
+
+	page, err := h.userService.ListUsers(c.Request.Context(), filter, query.Limit, query.Offset)
+	if err != nil {
+		if errors.Is(err, domain.ErrEncryptedField) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list users: " + err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, users)
+
+	c.Header("X-Total-Count", strconv.FormatInt(page.Total, 10))
+	var links []string
+	if page.NextCursor != "" {
+		links = append(links, cursorLink(c, page.NextCursor, "next"))
+	}
+	if page.PrevCursor != "" {
+		links = append(links, cursorLink(c, page.PrevCursor, "prev"))
+	}
+	if len(links) > 0 {
+		c.Header("Link", strings.Join(links, ", "))
+	}
+	// Only admins see every field of the other users
+	if requester := requestingUser(c); requester != nil && requester.Role == domain.RoleAdmin {
+		c.JSON(http.StatusOK, newUserPageResponse(page, newUserResponse))
+		return
+	}
+	c.JSON(http.StatusOK, newUserPageResponse(page, newUserSummaryResponse))
+}
+
+// cursorLink is a Link header entry pointing at the current request with the
+// given cursor instead of an offset.
+func cursorLink(c *gin.Context, cursor, rel string) string {
+	target := *c.Request.URL
+	values := target.Query()
+	values.Del("offset")
+	values.Set("cursor", cursor)
+	target.RawQuery = values.Encode()
+	return fmt.Sprintf("<%s>; rel=%q", target.RequestURI(), rel)
 }
 
 type UpdateUserRequest struct {
@@ -68,7 +197,7 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 	userFromContext, _ := userValue.(*domain.User)
-	userID := userFromContext.ID.Hex()
+	userID := userFromContext.ID
 
 	var req UpdateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -80,12 +209,267 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
-	user, err := h.userService.UpdateUser(c.Request.Context(), userID, req.Name, req.Email)
+	if req.Email != userFromContext.Email && (!checkNotImpersonating(c) || !checkRecentAuth(c, h.stepUpMaxAge)) {
+		return
+	}
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.userService.UpdateUser(c.Request.Context(), userID, version, req.Name, req.Email)
 	if err != nil {
+		if errors.Is(err, domain.ErrVersionConflict) {
+			abortPreconditionFailed(c)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user: " + err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, user)
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// maxPatchSize bounds the size of a patch document
+const maxPatchSize = 64 << 10
+
+func (h *UserHandler) PatchUser(c *gin.Context) {
+	userValue, exists := c.Get(authorizationPayloadKey)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return
+	}
+	userFromContext, _ := userValue.(*domain.User)
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxPatchSize))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "patch document is too large"})
+		return
+	}
+
+	req, err := parseUserPatch(c.ContentType(), body, userFromContext)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedPatch):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		case errors.Is(err, errPatchTestFailed):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Email != nil && *req.Email != userFromContext.Email && (!checkNotImpersonating(c) || !checkRecentAuth(c, h.stepUpMaxAge)) {
+		return
+	}
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	patch := &domain.UserPatch{
+		Name:     req.Name,
+		Email:    req.Email,
+		Profile:  req.Profile,
+		Metadata: req.Metadata,
+	}
+	user, err := h.userService.PatchUser(c.Request.Context(), userFromContext.ID, version, patch)
+	if err != nil {
+		if abortIfInvalidProfile(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, domain.ErrVersionConflict):
+			abortPreconditionFailed(c)
+		case errors.Is(err, domain.ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user: " + err.Error()})
+		}
+		return
+	}
+	c.Header("ETag", userETag(user))
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+type EmailChangeTokenRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (h *UserHandler) ConfirmEmailChange(c *gin.Context) {
+	var req EmailChangeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userService.ConfirmEmailChange(c.Request.Context(), req.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrTokenInvalid), errors.Is(err, domain.ErrTokenUsed):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, domain.ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to confirm email change: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+func (h *UserHandler) CancelEmailChange(c *gin.Context) {
+	var req EmailChangeTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.userService.CancelEmailChange(c.Request.Context(), req.Token)
+	if err != nil {
+		if errors.Is(err, domain.ErrTokenInvalid) || errors.Is(err, domain.ErrTokenUsed) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to cancel email change: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=8"`
+}
+
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	userValue, exists := c.Get(authorizationPayloadKey)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return
+	}
+	userFromContext, _ := userValue.(*domain.User)
+	claimsValue, _ := c.Get(authorizationClaimsKey)
+	claims, _ := claimsValue.(*util.Claims)
+	if claims == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "session not found in context"})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.userService.ChangePassword(c.Request.Context(), userFromContext.ID, claims.SessionID, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "current password is incorrect"})
+		case errors.Is(err, domain.ErrWeakPassword), errors.Is(err, domain.ErrPasswordReused):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+type UpdateMFASettingsRequest struct {
+	Password  string   `json:"password" binding:"required"`
+	Methods   []string `json:"methods"`
+	Preferred string   `json:"preferred"`
+}
+
+func (h *UserHandler) UpdateMFASettings(c *gin.Context) {
+	userValue, exists := c.Get(authorizationPayloadKey)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return
+	}
+	userFromContext, _ := userValue.(*domain.User)
+
+	var req UpdateMFASettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.userService.UpdateMFASettings(c.Request.Context(), userFromContext.ID, req.Password, req.Methods, req.Preferred)
+	if err != nil {
+		switch {
+		case errors.Is(err, domain.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "password is incorrect"})
+		case errors.Is(err, domain.ErrMFAMethodInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update mfa settings: " + err.Error()})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+type ListLoginHistoryQuery struct {
+	Limit  int64 `form:"limit,default=20" binding:"min=1,max=100"`
+	Offset int64 `form:"offset,default=0" binding:"min=0"`
+}
+
+func (h *UserHandler) ListLoginHistory(c *gin.Context) {
+	userValue, exists := c.Get(authorizationPayloadKey)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return
+	}
+	userFromContext, _ := userValue.(*domain.User)
+
+	var query ListLoginHistoryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		if errMessages := FormatValidationErrors(err); len(errMessages) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errMessages})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid query parameters: " + err.Error()})
+		return
+	}
+
+	events, err := h.userService.ListLoginHistory(c.Request.Context(), userFromContext.ID, query.Limit, query.Offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to list login history: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, events)
 }
 
 func (h *UserHandler) DeleteUser(c *gin.Context) {
@@ -95,8 +479,28 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
-	err := h.userService.DeleteUser(c.Request.Context(), userID)
+	// Users can only delete their own account, admins any account
+	requester := requestingUser(c)
+	if requester == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found in context"})
+		return
+	}
+	if requester.ID != userID && requester.Role != domain.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "insufficient permissions"})
+		return
+	}
+
+	version, ok := requireIfMatch(c)
+	if !ok {
+		return
+	}
+
+	err := h.userService.DeleteUser(c.Request.Context(), userID, version)
 	if err != nil {
+		if errors.Is(err, domain.ErrVersionConflict) {
+			abortPreconditionFailed(c)
+			return
+		}
 
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete user: " + err.Error()})
 		return
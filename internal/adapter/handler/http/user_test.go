@@ -1,19 +1,34 @@
 package http_test
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	handlerhttp "github.com/nisibz/go-auth-tests/internal/adapter/handler/http"
 	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
 
+// stepUpMaxAge is the recent authentication window of the handlers under test
+const stepUpMaxAge = 10 * time.Minute
+
 type MockUserService struct {
 	mock.Mock
 }
@@ -32,18 +47,160 @@ func (m *MockUserService) CreateUser(ctx context.Context, name, email, password
 	return args.Get(0).(*domain.User), args.Error(1)
 }
 
-func (m *MockUserService) ListUsers(ctx context.Context, limit, offset int64) ([]*domain.User, error) {
-	args := m.Called(ctx, limit, offset)
-	return args.Get(0).([]*domain.User), args.Error(1)
+func (m *MockUserService) ListUsers(ctx context.Context, filter *domain.UserFilter, limit, offset int64) (*domain.Page[*domain.User], error) {
+	args := m.Called(ctx, filter, limit, offset)
+	page := args.Get(0)
+	if page == nil {
+		return nil, args.Error(1)
+	}
+	return page.(*domain.Page[*domain.User]), args.Error(1)
 }
 
-func (m *MockUserService) UpdateUser(ctx context.Context, id, name, email string) (*domain.User, error) {
-	args := m.Called(ctx, id, name, email)
-	return args.Get(0).(*domain.User), args.Error(1)
+func (m *MockUserService) UpdateUser(ctx context.Context, id string, version int64, name, email string) (*domain.User, error) {
+	args := m.Called(ctx, id, version, name, email)
+	user := args.Get(0)
+	if user == nil {
+		return nil, args.Error(1)
+	}
+	return user.(*domain.User), args.Error(1)
+}
+
+func (m *MockUserService) ConfirmEmailChange(ctx context.Context, token string) (*domain.User, error) {
+	args := m.Called(ctx, token)
+	user := args.Get(0)
+	if user == nil {
+		return nil, args.Error(1)
+	}
+	return user.(*domain.User), args.Error(1)
+}
+
+func (m *MockUserService) CancelEmailChange(ctx context.Context, token string) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockUserService) ChangePassword(ctx context.Context, id, currentSessionID, currentPassword, newPassword string) error {
+	args := m.Called(ctx, id, currentSessionID, currentPassword, newPassword)
+	return args.Error(0)
+}
+
+func (m *MockUserService) UpdateAdminMetadata(ctx context.Context, id string, version int64, patch map[string]any) (*domain.User, error) {
+	args := m.Called(ctx, id, version, patch)
+	user := args.Get(0)
+	if user == nil {
+		return nil, args.Error(1)
+	}
+	return user.(*domain.User), args.Error(1)
+}
+
+func (m *MockUserService) MetadataSchema(section string) json.RawMessage {
+	args := m.Called(section)
+	schema, _ := args.Get(0).(json.RawMessage)
+	return schema
+}
+
+func (m *MockUserService) ImportUsers(ctx context.Context, r io.Reader, opts *domain.ImportOptions) (*domain.ImportReport, error) {
+	args := m.Called(ctx, r, opts)
+	report := args.Get(0)
+	if report == nil {
+		return nil, args.Error(1)
+	}
+	return report.(*domain.ImportReport), args.Error(1)
+}
+
+func (m *MockUserService) ExportUsers(ctx context.Context, w io.Writer, filter *domain.UserFilter, opts *domain.ExportOptions) (int64, error) {
+	args := m.Called(ctx, w, filter, opts)
+	if content, ok := args.Get(0).(string); ok {
+		io.WriteString(w, content)
+	}
+	return args.Get(1).(int64), args.Error(2)
+}
+
+func (m *MockUserService) UploadAvatar(ctx context.Context, userID string, image io.Reader) (*domain.User, error) {
+	args := m.Called(ctx, userID, image)
+	user := args.Get(0)
+	if user == nil {
+		return nil, args.Error(1)
+	}
+	return user.(*domain.User), args.Error(1)
+}
+
+func (m *MockUserService) DeleteAvatar(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) OpenAvatar(ctx context.Context, userID, size string) (*domain.AvatarFile, error) {
+	args := m.Called(ctx, userID, size)
+	avatar := args.Get(0)
+	if avatar == nil {
+		return nil, args.Error(1)
+	}
+	return avatar.(*domain.AvatarFile), args.Error(1)
+}
+
+func (m *MockUserService) PatchUser(ctx context.Context, id string, version int64, patch *domain.UserPatch) (*domain.User, error) {
+	args := m.Called(ctx, id, version, patch)
+	user := args.Get(0)
+	if user == nil {
+		return nil, args.Error(1)
+	}
+	return user.(*domain.User), args.Error(1)
+}
+
+func (m *MockUserService) ListLoginHistory(ctx context.Context, userID string, limit, offset int64) ([]*domain.LoginEvent, error) {
+	args := m.Called(ctx, userID, limit, offset)
+	events := args.Get(0)
+	if events == nil {
+		return nil, args.Error(1)
+	}
+	return events.([]*domain.LoginEvent), args.Error(1)
 }
 
-func (m *MockUserService) DeleteUser(ctx context.Context, id string) error {
+func (m *MockUserService) RestoreUser(ctx context.Context, id string) (*domain.User, error) {
 	args := m.Called(ctx, id)
+	user := args.Get(0)
+	if user == nil {
+		return nil, args.Error(1)
+	}
+	return user.(*domain.User), args.Error(1)
+}
+
+func (m *MockUserService) SetUserStatus(ctx context.Context, id string, version int64, status, reason string, until *time.Time) (*domain.User, error) {
+	args := m.Called(ctx, id, version, status, reason, until)
+	user := args.Get(0)
+	if user == nil {
+		return nil, args.Error(1)
+	}
+	return user.(*domain.User), args.Error(1)
+}
+
+func (m *MockUserService) UpdateMFASettings(ctx context.Context, id, password string, methods []string, preferred string) (*domain.User, error) {
+	args := m.Called(ctx, id, password, methods, preferred)
+	user := args.Get(0)
+	if user == nil {
+		return nil, args.Error(1)
+	}
+	return user.(*domain.User), args.Error(1)
+}
+
+func (m *MockUserService) DeleteUser(ctx context.Context, id string, version int64) error {
+	args := m.Called(ctx, id, version)
+	return args.Error(0)
+}
+
+func (m *MockUserService) ExportPersonalData(ctx context.Context, userID string, w io.Writer) error {
+	args := m.Called(ctx, userID, w)
+	return args.Error(0)
+}
+
+func (m *MockUserService) RequestErasure(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockUserService) ConfirmErasure(ctx context.Context, token string) error {
+	args := m.Called(ctx, token)
 	return args.Error(0)
 }
 
@@ -54,13 +211,13 @@ func (m *MockUserService) CountUsers(ctx context.Context) (int64, error) {
 
 func TestGetUserByID_Success(t *testing.T) {
 	mockService := new(MockUserService)
-	handler := handlerhttp.NewUserHandler(mockService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
 	router.GET("/users/:id", handler.GetUserByID)
 
-	expectedUser := &domain.User{ID: [12]byte{1, 2, 3}, Name: "Alice", Email: "alice@example.com"}
+	expectedUser := &domain.User{ID: "010203000000000000000000", Name: "Alice", Email: "alice@example.com"}
 	mockService.On("GetUserByID", mock.Anything, "123").Return(expectedUser, nil)
 
 	req := httptest.NewRequest(http.MethodGet, "/users/123", nil)
@@ -71,9 +228,36 @@ func TestGetUserByID_Success(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
+func TestGetUserByID_NotModified(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/users/:id", handlerhttp.AuthenticateAs(&domain.User{ID: "010203000000000000000000"}, nil), handler.GetUserByID)
+
+	expectedUser := &domain.User{ID: "010203000000000000000000", Name: "Alice", Email: "alice@example.com", Version: 3}
+	mockService.On("GetUserByID", mock.Anything, "123").Return(expectedUser, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/123", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, `"3"`, resp.Header().Get("ETag"))
+
+	req = httptest.NewRequest(http.MethodGet, "/users/123", nil)
+	req.Header.Set("If-None-Match", `"3"`)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNotModified, resp.Code)
+	assert.Empty(t, resp.Body.String())
+}
+
 func TestGetUserByID_NotFound(t *testing.T) {
 	mockService := new(MockUserService)
-	handler := handlerhttp.NewUserHandler(mockService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
@@ -87,3 +271,766 @@ func TestGetUserByID_NotFound(t *testing.T) {
 
 	assert.Equal(t, http.StatusNotFound, resp.Code)
 }
+
+func TestGetUserByID_Visibility(t *testing.T) {
+	target := &domain.User{
+		ID:      "010203000000000000000000",
+		Name:    "Alice",
+		Email:   "alice@example.com",
+		Role:    domain.RoleUser,
+		Profile: domain.UserProfile{DisplayName: "Ali", AvatarURL: "/api/users/010203000000000000000000/avatar?v=1", Phone: "+33612345678"},
+		Version: 3,
+	}
+	tests := []struct {
+		name      string
+		requester *domain.User
+		full      bool
+		etag      string
+	}{
+		{"other user", &domain.User{ID: "040506000000000000000000", Role: domain.RoleUser}, false, `W/"3-summary"`},
+		{"same user", &domain.User{ID: target.ID, Role: domain.RoleUser}, true, `"3"`},
+		{"admin", &domain.User{ID: "040506000000000000000000", Role: domain.RoleAdmin}, true, `"3"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockUserService)
+			handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			router.GET("/users/:id", handlerhttp.AuthenticateAs(tt.requester, nil), handler.GetUserByID)
+
+			mockService.On("GetUserByID", mock.Anything, target.ID).Return(target, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/users/"+target.ID, nil)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			assert.Equal(t, tt.etag, resp.Header().Get("ETag"))
+			assert.Equal(t, "Authorization", resp.Header().Get("Vary"))
+
+			// The tag of the other representation must not revalidate this one
+			other := `W/"3-summary"`
+			if !tt.full {
+				other = `"3"`
+			}
+			req = httptest.NewRequest(http.MethodGet, "/users/"+target.ID, nil)
+			req.Header.Set("If-None-Match", other)
+			resp = httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			var body map[string]any
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+			if tt.full {
+				assert.Equal(t, "alice@example.com", body["email"])
+				assert.Equal(t, "+33612345678", body["profile"].(map[string]any)["phone"])
+				return
+			}
+			assert.Equal(t, map[string]any{
+				"id":           target.ID,
+				"name":         "Alice",
+				"display_name": "Ali",
+				"avatar_url":   "/api/users/010203000000000000000000/avatar?v=1",
+			}, body)
+		})
+	}
+}
+
+func TestListUsers_FilterAndSort(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/users", handler.ListUsers)
+
+	expectedFilter := &domain.UserFilter{
+		EmailPrefix: "jo",
+		Role:        domain.RoleAdmin,
+		Sort:        []domain.SortField{{Field: "created_at", Desc: true}, {Field: "name"}},
+	}
+	page := &domain.Page[*domain.User]{
+		Items: []*domain.User{{Name: "John Doe", Email: "john@example.com"}},
+		Total: 42,
+		Limit: 10,
+	}
+	mockService.On("ListUsers", mock.Anything, expectedFilter, int64(10), int64(0)).Return(page, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/users?email=jo&role=admin&sort=-created_at,name", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "42", resp.Header().Get("X-Total-Count"))
+	mockService.AssertExpectations(t)
+}
+
+func TestListUsers_Visibility(t *testing.T) {
+	page := &domain.Page[*domain.User]{
+		Items: []*domain.User{{ID: "010203000000000000000000", Name: "John Doe", Email: "john@example.com", Role: domain.RoleAdmin}},
+		Total: 1,
+		Limit: 10,
+	}
+	tests := []struct {
+		name      string
+		requester *domain.User
+		full      bool
+	}{
+		{"user", &domain.User{ID: "040506000000000000000000", Role: domain.RoleUser}, false},
+		{"admin", &domain.User{ID: "040506000000000000000000", Role: domain.RoleAdmin}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockUserService)
+			handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+			gin.SetMode(gin.TestMode)
+			router := gin.Default()
+			router.GET("/users", handlerhttp.AuthenticateAs(tt.requester, nil), handler.ListUsers)
+
+			mockService.On("ListUsers", mock.Anything, mock.Anything, int64(10), int64(0)).Return(page, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, http.StatusOK, resp.Code)
+			var body struct {
+				Items []map[string]any `json:"items"`
+				Total int64            `json:"total"`
+			}
+			assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+			assert.Equal(t, int64(1), body.Total)
+			if tt.full {
+				assert.Equal(t, "john@example.com", body.Items[0]["email"])
+				assert.Equal(t, domain.RoleAdmin, body.Items[0]["role"])
+				return
+			}
+			assert.Equal(t, []map[string]any{{"id": "010203000000000000000000", "name": "John Doe"}}, body.Items)
+		})
+	}
+}
+
+func TestListUsers_CursorPagination(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/users", handler.ListUsers)
+
+	last := &domain.User{ID: "60d5ecf0a1b2c3d4e5f6a7b8", Name: "Jane Smith", CreatedAt: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)}
+	next, err := util.SignCursor(&domain.UserCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	assert.NoError(t, err)
+
+	mockService.On("ListUsers", mock.Anything, mock.MatchedBy(func(f *domain.UserFilter) bool {
+		return f.Cursor != nil && f.Cursor.ID == last.ID && f.Cursor.CreatedAt.Equal(last.CreatedAt) && !f.Cursor.Backward
+	}), int64(2), int64(0)).Return(&domain.Page[*domain.User]{
+		Items:      []*domain.User{{ID: "60d5ecf0a1b2c3d4e5f6a7b9", Name: "Jim Beam"}},
+		Total:      3,
+		Limit:      2,
+		PrevCursor: "prev-cursor",
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/users?limit=2&offset=4&cursor="+url.QueryEscape(next), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "3", resp.Header().Get("X-Total-Count"))
+	assert.Equal(t, `</users?cursor=prev-cursor&limit=2>; rel="prev"`, resp.Header().Get("Link"))
+	assert.Contains(t, resp.Body.String(), `"prev_cursor":"prev-cursor"`)
+	assert.Contains(t, resp.Body.String(), `"has_more":false`)
+	mockService.AssertExpectations(t)
+}
+
+func TestListUsers_TamperedCursor(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/users", handler.ListUsers)
+
+	req := httptest.NewRequest(http.MethodGet, "/users?cursor=eyJpZCI6IngifQ.c2lnbmF0dXJl", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	mockService.AssertNotCalled(t, "ListUsers")
+}
+
+func TestListUsers_LimitOutOfRange(t *testing.T) {
+	for _, limit := range []string{"0", "-1", "101"} {
+		mockService := new(MockUserService)
+		handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+		gin.SetMode(gin.TestMode)
+		router := gin.Default()
+		router.GET("/users", handler.ListUsers)
+
+		req := httptest.NewRequest(http.MethodGet, "/users?limit="+limit, nil)
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code, "limit=%s", limit)
+		mockService.AssertNotCalled(t, "ListUsers")
+	}
+}
+
+func TestListUsers_InvalidSort(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/users", handler.ListUsers)
+
+	req := httptest.NewRequest(http.MethodGet, "/users?sort=password", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	mockService.AssertNotCalled(t, "ListUsers")
+}
+
+func TestChangePassword_Unauthenticated(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PUT("/users/me/password", handler.ChangePassword)
+
+	body := `{"current_password": "password123", "new_password": "newpassword456"}`
+	req := httptest.NewRequest(http.MethodPut, "/users/me/password", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	mockService.AssertNotCalled(t, "ChangePassword")
+}
+
+func TestDeleteUser_IfMatchRequired(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.DELETE("/users/:id", handlerhttp.AuthenticateAs(&domain.User{ID: "123"}, nil), handler.DeleteUser)
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/123", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusPreconditionRequired, resp.Code)
+	mockService.AssertNotCalled(t, "DeleteUser")
+}
+
+func TestDeleteUser_VersionMismatch(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.DELETE("/users/:id", handlerhttp.AuthenticateAs(&domain.User{ID: "123"}, nil), handler.DeleteUser)
+
+	mockService.On("DeleteUser", mock.Anything, "123", int64(2)).Return(fmt.Errorf("failed to delete user: %w", domain.ErrVersionConflict))
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/123", nil)
+	req.Header.Set("If-Match", `"2"`)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestDeleteUser_OtherUser(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.DELETE("/users/:id", handlerhttp.AuthenticateAs(&domain.User{ID: "456", Role: domain.RoleUser}, nil), handler.DeleteUser)
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/123", nil)
+	req.Header.Set("If-Match", `"2"`)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusForbidden, resp.Code)
+	mockService.AssertNotCalled(t, "DeleteUser")
+}
+
+func TestDeleteUser_Admin(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.DELETE("/users/:id", handlerhttp.AuthenticateAs(&domain.User{ID: "456", Role: domain.RoleAdmin}, nil), handler.DeleteUser)
+
+	mockService.On("DeleteUser", mock.Anything, "123", int64(2)).Return(nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/123", nil)
+	req.Header.Set("If-Match", `"2"`)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestUpdateMe_IfMatchRequired(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+	user := &domain.User{ID: "123", Name: "Alice", Email: "alice@example.com", Version: 2}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PUT("/users/me", handlerhttp.AuthenticateAs(user, nil), handler.UpdateUser)
+
+	body := `{"name": "Alice Smith", "email": "alice@example.com"}`
+	req := httptest.NewRequest(http.MethodPut, "/users/me", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusPreconditionRequired, resp.Code)
+	mockService.AssertNotCalled(t, "UpdateUser")
+}
+
+func TestUpdateMe_StaleIfMatch(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+	user := &domain.User{ID: "123", Name: "Alice", Email: "alice@example.com", Version: 2}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PUT("/users/me", handlerhttp.AuthenticateAs(user, nil), handler.UpdateUser)
+
+	mockService.On("UpdateUser", mock.Anything, "123", int64(1), "Alice Smith", "alice@example.com").
+		Return(nil, fmt.Errorf("failed to update user: %w", domain.ErrVersionConflict))
+
+	body := `{"name": "Alice Smith", "email": "alice@example.com"}`
+	req := httptest.NewRequest(http.MethodPut, "/users/me", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestUpdateMe_EmailChangeStepUpMaxAge(t *testing.T) {
+	user := &domain.User{ID: "123", Name: "Alice", Email: "alice@example.com", Version: 1}
+	claims := &util.Claims{UserID: "123", AuthTime: jwt.NewNumericDate(time.Now().Add(-5 * time.Minute))}
+	body := `{"name": "Alice", "email": "alice.smith@example.com"}`
+
+	// Five minutes ago is recent enough by default, not with a one minute window
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, time.Minute)
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PUT("/users/me", handlerhttp.AuthenticateAs(user, claims), handler.UpdateUser)
+
+	req := httptest.NewRequest(http.MethodPut, "/users/me", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assert.Contains(t, resp.Header().Get("WWW-Authenticate"), "max_age=60")
+	mockService.AssertNotCalled(t, "UpdateUser")
+
+	mockService = new(MockUserService)
+	handler = handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+	router = gin.Default()
+	router.PUT("/users/me", handlerhttp.AuthenticateAs(user, claims), handler.UpdateUser)
+
+	mockService.On("UpdateUser", mock.Anything, "123", int64(1), "Alice", "alice.smith@example.com").
+		Return(&domain.User{ID: "123", Name: "Alice", Email: "alice@example.com", PendingEmail: "alice.smith@example.com", Version: 2}, nil)
+
+	req = httptest.NewRequest(http.MethodPut, "/users/me", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestPatchMe_IfMatchRequired(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+	user := &domain.User{ID: "123", Name: "Alice", Email: "alice@example.com", Version: 2}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PATCH("/users/me", handlerhttp.AuthenticateAs(user, nil), handler.PatchUser)
+
+	req := httptest.NewRequest(http.MethodPatch, "/users/me", strings.NewReader(`{"name": "Alice Smith"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusPreconditionRequired, resp.Code)
+	mockService.AssertNotCalled(t, "PatchUser")
+}
+
+func TestPatchMe_StaleIfMatch(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+	user := &domain.User{ID: "123", Name: "Alice", Email: "alice@example.com", Version: 2}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PATCH("/users/me", handlerhttp.AuthenticateAs(user, nil), handler.PatchUser)
+
+	mockService.On("PatchUser", mock.Anything, "123", int64(1), mock.Anything).
+		Return(nil, fmt.Errorf("failed to update user: %w", domain.ErrVersionConflict))
+
+	req := httptest.NewRequest(http.MethodPatch, "/users/me", strings.NewReader(`{"name": "Alice Smith"}`))
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	req.Header.Set("If-Match", `"1"`)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, resp.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestListLoginHistory_Unauthenticated(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/users/me/logins", handler.ListLoginHistory)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/logins", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	mockService.AssertNotCalled(t, "ListLoginHistory")
+}
+
+func TestListLoginHistory_Success(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+	user := &domain.User{ID: "123", Email: "alice@example.com"}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/users/me/logins", handlerhttp.AuthenticateAs(user, nil), handler.ListLoginHistory)
+
+	events := []*domain.LoginEvent{
+		{ID: "2", UserID: "123", Time: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Reason: "invalid_password", IP: "203.0.113.7", DeviceID: "d1"},
+		{ID: "1", UserID: "123", Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Success: true, Methods: []string{"pwd"}, DeviceID: "d1"},
+	}
+	mockService.On("ListLoginHistory", mock.Anything, "123", int64(5), int64(10)).Return(events, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/logins?limit=5&offset=10", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var body []map[string]any
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Len(t, body, 2)
+	assert.Equal(t, "invalid_password", body[0]["reason"])
+	assert.Equal(t, "203.0.113.7", body[0]["ip"])
+	assert.NotContains(t, body[0], "user_id")
+	mockService.AssertExpectations(t)
+}
+
+func TestListLoginHistory_DefaultPage(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+	user := &domain.User{ID: "123", Email: "alice@example.com"}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/users/me/logins", handlerhttp.AuthenticateAs(user, nil), handler.ListLoginHistory)
+
+	mockService.On("ListLoginHistory", mock.Anything, "123", int64(20), int64(0)).Return([]*domain.LoginEvent{}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/logins", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.JSONEq(t, `[]`, resp.Body.String())
+	mockService.AssertExpectations(t)
+}
+
+func TestListLoginHistory_InvalidLimit(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=101", "offset=-1"} {
+		mockService := new(MockUserService)
+		handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+		user := &domain.User{ID: "123", Email: "alice@example.com"}
+
+		gin.SetMode(gin.TestMode)
+		router := gin.Default()
+		router.GET("/users/me/logins", handlerhttp.AuthenticateAs(user, nil), handler.ListLoginHistory)
+
+		req := httptest.NewRequest(http.MethodGet, "/users/me/logins?"+query, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+		mockService.AssertNotCalled(t, "ListLoginHistory")
+	}
+}
+
+func TestListLoginHistory_ServiceError(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+	user := &domain.User{ID: "123", Email: "alice@example.com"}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/users/me/logins", handlerhttp.AuthenticateAs(user, nil), handler.ListLoginHistory)
+
+	mockService.On("ListLoginHistory", mock.Anything, "123", int64(20), int64(0)).Return(nil, errors.New("database unavailable"))
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/logins", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusInternalServerError, resp.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestConfirmEmailChange_InvalidToken(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/auth/email-change/confirm", handler.ConfirmEmailChange)
+
+	mockService.On("ConfirmEmailChange", mock.Anything, "expired").Return(nil, domain.ErrTokenInvalid)
+
+	body := `{"token": "expired"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth/email-change/confirm", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestExportPersonalData_Unauthenticated(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/users/me/export", handler.ExportPersonalData)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/me/export", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	mockService.AssertNotCalled(t, "ExportPersonalData")
+}
+
+func TestConfirmErasure_Success(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/auth/erasure/confirm", handler.ConfirmErasure)
+
+	mockService.On("ConfirmErasure", mock.Anything, "valid").Return(nil)
+
+	body := `{"token": "valid"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth/erasure/confirm", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestConfirmErasure_UsedToken(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/auth/erasure/confirm", handler.ConfirmErasure)
+
+	mockService.On("ConfirmErasure", mock.Anything, "used").Return(domain.ErrTokenUsed)
+
+	body := `{"token": "used"}`
+	req := httptest.NewRequest(http.MethodPost, "/auth/erasure/confirm", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	mockService.AssertExpectations(t)
+}
+
+func TestGetAvatar_ImmutableWhenVersioned(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/users/:id/avatar", handler.GetAvatar)
+
+	avatar := &domain.AvatarFile{
+		Version: "0a1b2c3d4e5f6a7b",
+		Size:    "small",
+		Info:    &domain.BlobInfo{ContentType: "image/jpeg", Size: 4, ModTime: time.Now()},
+		Content: io.NopCloser(strings.NewReader("jpeg")),
+	}
+	mockService.On("OpenAvatar", mock.Anything, "60d5ecf0a1b2c3d4e5f6a7b8", "small").Return(avatar, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/60d5ecf0a1b2c3d4e5f6a7b8/avatar?size=small&v=0a1b2c3d4e5f6a7b", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "image/jpeg", resp.Header().Get("Content-Type"))
+	assert.Equal(t, `"0a1b2c3d4e5f6a7b-small"`, resp.Header().Get("ETag"))
+	assert.Contains(t, resp.Header().Get("Cache-Control"), "immutable")
+	assert.Equal(t, "jpeg", resp.Body.String())
+	mockService.AssertExpectations(t)
+}
+
+func TestGetAvatar_NotUploaded(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.GET("/users/:id/avatar", handler.GetAvatar)
+
+	mockService.On("OpenAvatar", mock.Anything, "60d5ecf0a1b2c3d4e5f6a7b8", "large").Return(nil, domain.ErrBlobNotFound)
+
+	req := httptest.NewRequest(http.MethodGet, "/users/60d5ecf0a1b2c3d4e5f6a7b8/avatar", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	mockService.AssertExpectations(t)
+}
+
+// avatarRequest builds a PUT /users/me/avatar request uploading content
+func avatarRequest(t *testing.T, content []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("avatar", "avatar.png")
+	assert.NoError(t, err)
+	part.Write(content)
+	assert.NoError(t, writer.Close())
+
+	req := httptest.NewRequest(http.MethodPut, "/users/me/avatar", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	return req
+}
+
+func pngImage(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))))
+	return buf.Bytes()
+}
+
+func TestUploadAvatar_UnsupportedMediaType(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PUT("/users/me/avatar", handlerhttp.AuthenticateAs(&domain.User{ID: "123"}, nil), handler.UploadAvatar)
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, avatarRequest(t, []byte("%PDF-1.7 not an image")))
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.Code)
+	mockService.AssertNotCalled(t, "UploadAvatar")
+}
+
+func TestUploadAvatar_TooLarge(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PUT("/users/me/avatar", handlerhttp.AuthenticateAs(&domain.User{ID: "123"}, nil), handler.UploadAvatar)
+
+	content := append(pngImage(t), make([]byte, domain.MaxAvatarUploadSize)...)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, avatarRequest(t, content))
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.Code)
+	mockService.AssertNotCalled(t, "UploadAvatar")
+}
+
+func TestUploadAvatar_InvalidImage(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.PUT("/users/me/avatar", handlerhttp.AuthenticateAs(&domain.User{ID: "123"}, nil), handler.UploadAvatar)
+
+	mockService.On("UploadAvatar", mock.Anything, "123", mock.Anything).
+		Return(nil, fmt.Errorf("%w: image of 5000x5000 pixels is too large", domain.ErrInvalidImage))
+
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, avatarRequest(t, pngImage(t)))
+
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Contains(t, resp.Body.String(), "too large")
+	mockService.AssertExpectations(t)
+}
+
+func TestDeleteAvatar_NoContent(t *testing.T) {
+	mockService := new(MockUserService)
+	handler := handlerhttp.NewUserHandler(mockService, stepUpMaxAge)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.DELETE("/users/me/avatar", handlerhttp.AuthenticateAs(&domain.User{ID: "123"}, nil), handler.DeleteAvatar)
+
+	mockService.On("DeleteAvatar", mock.Anything, "123").Return(nil)
+
+	req := httptest.NewRequest(http.MethodDelete, "/users/me/avatar", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNoContent, resp.Code)
+	assert.Empty(t, resp.Body.String())
+	mockService.AssertExpectations(t)
+}
@@ -19,6 +19,8 @@ func FormatValidationErrors(err error) []string {
 				msg = fmt.Sprintf("%s must be a valid email address", fieldErr.Field())
 			case "min":
 				msg = fmt.Sprintf("%s must be at least %s characters long", fieldErr.Field(), fieldErr.Param())
+			case "max":
+				msg = fmt.Sprintf("%s must be at most %s characters long", fieldErr.Field(), fieldErr.Param())
 			default:
 				msg = fmt.Sprintf("%s is not valid", fieldErr.Field())
 			}
@@ -0,0 +1,25 @@
+package mailer
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// LogMailer writes emails to the application log instead of delivering them.
+// It is used when no SMTP relay is configured.
+type LogMailer struct{}
+
+func NewLogMailer() *LogMailer {
+	return &LogMailer{}
+}
+
+func (m *LogMailer) Send(ctx context.Context, email *domain.Email) error {
+	slog.InfoContext(ctx, "Email not delivered, no SMTP relay configured",
+		"to", email.To,
+		"subject", email.Subject,
+		"body", email.Body,
+	)
+	return nil
+}
@@ -0,0 +1,52 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// SMTPMailer delivers emails through an SMTP relay
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTPMailer creates a mailer for the configured SMTP relay
+func NewSMTPMailer(config *config.Mail) *SMTPMailer {
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+	return &SMTPMailer{
+		addr: net.JoinHostPort(config.Host, config.Port),
+		auth: auth,
+		from: config.From,
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, email *domain.Email) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", email.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", email.Subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(email.Body)
+
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{email.To}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type section struct {
+	raw    json.RawMessage
+	schema *jsonschema.Schema
+}
+
+// MetadataValidator validates metadata with JSON schemas loaded from files.
+// Sections without a schema accept any object.
+type MetadataValidator struct {
+	sections map[string]*section
+}
+
+// NewMetadataValidator compiles the schemas of the user and admin metadata
+// sections. An empty path leaves the section unconstrained.
+func NewMetadataValidator(userSchemaPath, adminSchemaPath string) (*MetadataValidator, error) {
+	v := &MetadataValidator{sections: map[string]*section{}}
+	paths := map[string]string{
+		domain.MetadataSectionUser:  userSchemaPath,
+		domain.MetadataSectionAdmin: adminSchemaPath,
+	}
+	for name, path := range paths {
+		if path == "" {
+			continue
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s metadata schema: %w", name, err)
+		}
+		s, err := compile(name, raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile %s metadata schema: %w", name, err)
+		}
+		v.sections[name] = s
+	}
+	return v, nil
+}
+
+func compile(name string, raw []byte) (*section, error) {
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	url := "urn:metadata:" + name
+	c := jsonschema.NewCompiler()
+	if err := c.AddResource(url, doc); err != nil {
+		return nil, err
+	}
+	s, err := c.Compile(url)
+	if err != nil {
+		return nil, err
+	}
+	return &section{raw: raw, schema: s}, nil
+}
+
+func (v *MetadataValidator) Validate(name string, metadata map[string]any) error {
+	s, ok := v.sections[name]
+	if !ok {
+		return nil
+	}
+
+	// Round trip through JSON so that the validator only sees the types it
+	// understands
+	raw, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(raw))
+	if err != nil {
+		return err
+	}
+	if doc == nil {
+		doc = map[string]any{}
+	}
+
+	err = s.schema.Validate(doc)
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return err
+	}
+
+	var problems []string
+	for _, unit := range validationErr.BasicOutput().Errors {
+		if unit.Error == nil {
+			continue
+		}
+		location := unit.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		problems = append(problems, fmt.Sprintf("metadata%s: %s", location, unit.Error.String()))
+	}
+	sort.Strings(problems)
+	return &domain.ProfileValidationError{Problems: problems}
+}
+
+func (v *MetadataValidator) Schema(name string) json.RawMessage {
+	if s, ok := v.sections[name]; ok {
+		return s.raw
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+// Package backend opens the storage backend selected by DB_DRIVER, for the
+// HTTP server and the CLI alike
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/local"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/memory"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb/repository"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/postgres"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/sqlite"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/sqlstore"
+	"github.com/nisibz/go-auth-tests/internal/core/port"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// Stores are the repositories of the configured database
+type Stores struct {
+	Users        port.UserRepository
+	Sessions     port.SessionRepository
+	Tokens       port.OneTimeTokenRepository
+	LoginHistory port.LoginHistoryRepository
+	Audit        port.AuditRepository
+	Blobs        port.BlobStore
+	// Reencrypt rewrites users whose fields are not encrypted the way the
+	// configuration asks, nil when the database does not encrypt fields
+	Reencrypt func(ctx context.Context) (int64, error)
+
+	close func()
+}
+
+// Close disconnects from the database
+func (s *Stores) Close() {
+	s.close()
+}
+
+// Open connects to the database selected by DB_DRIVER and opens its stores.
+func Open(appConfig *config.Container, fieldEncryptor port.FieldEncryptor) (*Stores, error) {
+	switch appConfig.Database.Driver {
+	case "mongodb":
+		return openMongo(appConfig, fieldEncryptor)
+	case "postgres", "sqlite":
+		return openSQL(appConfig, fieldEncryptor)
+	case "memory":
+		slog.Warn("DB_DRIVER is memory, all data will be lost when the application stops")
+		if fieldEncryptor != nil {
+			slog.Warn("Field-level encryption does not apply to the memory database")
+		}
+		blobStore, err := openBlobStore(appConfig, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &Stores{
+			Users:        memory.NewUserRepository(),
+			Sessions:     memory.NewSessionRepository(),
+			Tokens:       memory.NewOneTimeTokenRepository(),
+			LoginHistory: memory.NewLoginHistoryRepository(),
+			Audit:        memory.NewAuditRepository(),
+			Blobs:        blobStore,
+			close:        func() {},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown DB_DRIVER %q, use mongodb, postgres, sqlite or memory", appConfig.Database.Driver)
+	}
+}
+
+func openMongo(appConfig *config.Container, fieldEncryptor port.FieldEncryptor) (*Stores, error) {
+	slog.Info("Connecting to MongoDB...")
+	mongoClient, err := mongodb.NewMongoClient(appConfig.Mongo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	slog.Info("Successfully connected to MongoDB")
+
+	closeClient := func() {
+		slog.Info("Closing MongoDB connection...")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := mongoClient.Disconnect(ctx); err != nil {
+			slog.Error("Error closing MongoDB connection", "error", err)
+		}
+		slog.Info("MongoDB connection closed.")
+	}
+
+	dbName := appConfig.Mongo.DB_NAME
+	userRepository := repository.NewUserRepository(mongoClient, dbName, "user", fieldEncryptor)
+	auditRepository := repository.NewAuditRepository(mongoClient, dbName, "audit")
+	loginHistoryRepository := repository.NewLoginHistoryRepository(mongoClient, dbName, "login_history")
+	if err := userRepository.EnsureIndexes(context.Background()); err != nil {
+		closeClient()
+		return nil, fmt.Errorf("failed to create user indexes: %w", err)
+	}
+	if err := auditRepository.EnsureIndexes(context.Background()); err != nil {
+		closeClient()
+		return nil, fmt.Errorf("failed to create audit log indexes: %w", err)
+	}
+	if err := loginHistoryRepository.EnsureIndexes(context.Background()); err != nil {
+		closeClient()
+		return nil, fmt.Errorf("failed to create login history indexes: %w", err)
+	}
+	blobStore, err := openBlobStore(appConfig, mongoClient)
+	if err != nil {
+		closeClient()
+		return nil, err
+	}
+
+	stores := &Stores{
+		Users:        userRepository,
+		Sessions:     repository.NewSessionRepository(mongoClient, dbName, "session"),
+		Tokens:       repository.NewOneTimeTokenRepository(mongoClient, dbName, "one_time_token"),
+		LoginHistory: loginHistoryRepository,
+		Audit:        auditRepository,
+		Blobs:        blobStore,
+		close:        closeClient,
+	}
+	if fieldEncryptor != nil {
+		stores.Reencrypt = userRepository.Reencrypt
+	}
+	return stores, nil
+}
+
+// openSQL opens the sqlstore repositories on PostgreSQL or SQLite
+func openSQL(appConfig *config.Container, fieldEncryptor port.FieldEncryptor) (*Stores, error) {
+	// The email blind index and key rotation are only implemented on MongoDB
+	if fieldEncryptor != nil {
+		return nil, errors.New("field-level encryption needs DB_DRIVER mongodb, unset ENCRYPTION_KEY_FILE")
+	}
+	blobStore, err := openBlobStore(appConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		name    string
+		db      *sql.DB
+		migrate func(ctx context.Context, db *sql.DB) error
+		dialect sqlstore.Dialect
+	)
+	switch appConfig.Database.Driver {
+	case "postgres":
+		name, migrate, dialect = "PostgreSQL", postgres.Migrate, postgres.Dialect{}
+		slog.Info("Connecting to PostgreSQL...")
+		db, err = postgres.NewPostgresClient(appConfig.Postgres)
+	case "sqlite":
+		name, migrate, dialect = "SQLite", sqlite.Migrate, sqlite.Dialect{}
+		slog.Info("Opening SQLite database...", "path", appConfig.SQLite.Path)
+		db, err = sqlite.NewSQLiteClient(appConfig.SQLite)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", name, err)
+	}
+	slog.Info("Successfully connected to " + name)
+
+	if err := migrate(context.Background(), db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate the database: %w", err)
+	}
+
+	return &Stores{
+		Users:        sqlstore.NewUserRepository(db, dialect),
+		Sessions:     sqlstore.NewSessionRepository(db, dialect),
+		Tokens:       sqlstore.NewOneTimeTokenRepository(db, dialect),
+		LoginHistory: sqlstore.NewLoginHistoryRepository(db, dialect),
+		Audit:        sqlstore.NewAuditRepository(db, dialect),
+		Blobs:        blobStore,
+		close: func() {
+			slog.Info("Closing " + name + " connection...")
+			if err := db.Close(); err != nil {
+				slog.Error("Error closing "+name+" connection", "error", err)
+			}
+			slog.Info(name + " connection closed.")
+		},
+	}, nil
+}
+
+// openBlobStore opens the storage of uploaded files. GridFS needs mongoClient,
+// which is nil when the database is not MongoDB.
+func openBlobStore(appConfig *config.Container, mongoClient *mongo.Client) (port.BlobStore, error) {
+	switch appConfig.Storage.Blob {
+	case "gridfs":
+		if mongoClient == nil {
+			return nil, errors.New("BLOB_STORAGE gridfs needs DB_DRIVER mongodb")
+		}
+		return repository.NewGridFSBlobStore(mongoClient, appConfig.Mongo.DB_NAME, "blob"), nil
+	case "local":
+		blobStore, err := local.NewBlobStore(appConfig.Storage.BlobDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open blob storage: %w", err)
+		}
+		return blobStore, nil
+	default:
+		return nil, fmt.Errorf("unknown BLOB_STORAGE %q, use local or gridfs", appConfig.Storage.Blob)
+	}
+}
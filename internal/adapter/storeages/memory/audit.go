@@ -0,0 +1,103 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// AuditRepository keeps the audit log in memory, in sequence order. Like the
+// MongoDB repository it only ever appends, and refuses a sequence number
+// that is already taken.
+type AuditRepository struct {
+	mu      sync.RWMutex
+	entries []*domain.AuditEntry
+}
+
+func NewAuditRepository() *AuditRepository {
+	return &AuditRepository{}
+}
+
+func cloneAuditEntry(entry *domain.AuditEntry) *domain.AuditEntry {
+	clone := *entry
+	clone.Details = maps.Clone(entry.Details)
+	return &clone
+}
+
+func (r *AuditRepository) Append(ctx context.Context, entry *domain.AuditEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i, found := slices.BinarySearchFunc(r.entries, entry.Seq, func(e *domain.AuditEntry, seq int64) int {
+		return cmp.Compare(e.Seq, seq)
+	})
+	if found {
+		return domain.ErrAuditConflict
+	}
+	entry.ID = newID()
+	r.entries = slices.Insert(r.entries, i, cloneAuditEntry(entry))
+	return nil
+}
+
+// Last returns the entry with the highest sequence number, or nil when the
+// log is empty.
+func (r *AuditRepository) Last(ctx context.Context) (*domain.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(r.entries) == 0 {
+		return nil, nil
+	}
+	return cloneAuditEntry(r.entries[len(r.entries)-1]), nil
+}
+
+func matchAuditEntry(entry *domain.AuditEntry, filter *domain.AuditFilter) bool {
+	switch {
+	case filter.ActorID != "" && entry.ActorID != filter.ActorID,
+		filter.TargetID != "" && entry.TargetID != filter.TargetID,
+		filter.Subject != "" && entry.ActorID != filter.Subject && entry.TargetID != filter.Subject,
+		filter.Action != "" && entry.Action != filter.Action,
+		filter.Outcome != "" && entry.Outcome != filter.Outcome,
+		!filter.From.IsZero() && entry.Time.Before(filter.From),
+		!filter.To.IsZero() && entry.Time.After(filter.To):
+		return false
+	}
+	return true
+}
+
+// List returns the entries matching filter, newest first.
+func (r *AuditRepository) List(ctx context.Context, filter *domain.AuditFilter, limit, offset int64) ([]*domain.AuditEntry, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var matching []*domain.AuditEntry
+	for _, entry := range slices.Backward(r.entries) {
+		if matchAuditEntry(entry, filter) {
+			matching = append(matching, entry)
+		}
+	}
+	entries := []*domain.AuditEntry{}
+	for _, entry := range page(matching, limit, offset) {
+		entries = append(entries, cloneAuditEntry(entry))
+	}
+	return entries, nil
+}
+
+// Iterate calls fn for every entry in sequence order, from a snapshot of the
+// log taken when it starts.
+func (r *AuditRepository) Iterate(ctx context.Context, fn func(*domain.AuditEntry) error) error {
+	r.mu.RLock()
+	entries := slices.Clone(r.entries)
+	r.mu.RUnlock()
+
+	for _, entry := range entries {
+		if err := fn(cloneAuditEntry(entry)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// lastID numbers every record created by the stores of this package
+var lastID atomic.Uint64
+
+// newID returns a new ID. IDs are fixed-width hexadecimal, so that like
+// MongoDB ObjectIDs they sort in creation order.
+func newID() string {
+	return fmt.Sprintf("%024x", lastID.Add(1))
+}
+
+func cloneTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	clone := *t
+	return &clone
+}
+
+// page applies offset and limit to items, a limit of 0 meaning no limit
+func page[T any](items []T, limit, offset int64) []T {
+	if offset > 0 {
+		items = items[min(offset, int64(len(items))):]
+	}
+	if limit > 0 && int64(len(items)) > limit {
+		items = items[:limit]
+	}
+	return slices.Clip(items)
+}
@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type LoginHistoryRepository struct {
+	mu     sync.RWMutex
+	events []*domain.LoginEvent
+}
+
+func NewLoginHistoryRepository() *LoginHistoryRepository {
+	return &LoginHistoryRepository{}
+}
+
+func cloneLoginEvent(event *domain.LoginEvent) *domain.LoginEvent {
+	clone := *event
+	clone.Methods = slices.Clone(event.Methods)
+	return &clone
+}
+
+func (r *LoginHistoryRepository) Create(ctx context.Context, event *domain.LoginEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event.ID = newID()
+	r.events = append(r.events, cloneLoginEvent(event))
+	return nil
+}
+
+// byUser returns the events of the user, newest first. The caller must hold
+// the lock.
+func (r *LoginHistoryRepository) byUser(userID string) []*domain.LoginEvent {
+	var events []*domain.LoginEvent
+	for _, event := range r.events {
+		if event.UserID == userID {
+			events = append(events, event)
+		}
+	}
+	slices.SortFunc(events, func(a, b *domain.LoginEvent) int {
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return events
+}
+
+func (r *LoginHistoryRepository) ListByUser(ctx context.Context, userID string, limit, offset int64) ([]*domain.LoginEvent, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	events := []*domain.LoginEvent{}
+	for _, event := range page(r.byUser(userID), limit, offset) {
+		events = append(events, cloneLoginEvent(event))
+	}
+	return events, nil
+}
+
+func (r *LoginHistoryRepository) HasDevice(ctx context.Context, userID, deviceID string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.ContainsFunc(r.events, func(event *domain.LoginEvent) bool {
+		return event.UserID == userID && event.DeviceID == deviceID && event.Success
+	}), nil
+}
+
+func (r *LoginHistoryRepository) CountSuccessful(ctx context.Context, userID string) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	for _, event := range r.events {
+		if event.UserID == userID && event.Success {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *LoginHistoryRepository) Prune(ctx context.Context, userID string, keep int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := r.byUser(userID)
+	if int64(len(events)) <= keep {
+		return nil
+	}
+	pruned := events[keep:]
+	r.events = slices.DeleteFunc(r.events, func(event *domain.LoginEvent) bool {
+		return slices.Contains(pruned, event)
+	})
+	return nil
+}
+
+func (r *LoginHistoryRepository) DeleteByUser(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = slices.DeleteFunc(r.events, func(event *domain.LoginEvent) bool {
+		return event.UserID == userID
+	})
+	return nil
+}
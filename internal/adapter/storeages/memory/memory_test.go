@@ -0,0 +1,20 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/memory"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/storetest"
+)
+
+func TestContract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) *storetest.Repositories {
+		return &storetest.Repositories{
+			Users:        memory.NewUserRepository(),
+			Sessions:     memory.NewSessionRepository(),
+			Tokens:       memory.NewOneTimeTokenRepository(),
+			LoginHistory: memory.NewLoginHistoryRepository(),
+			Audit:        memory.NewAuditRepository(),
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type SessionRepository struct {
+	mu       sync.RWMutex
+	sessions map[string]*domain.Session
+}
+
+func NewSessionRepository() *SessionRepository {
+	return &SessionRepository{sessions: map[string]*domain.Session{}}
+}
+
+func cloneSession(session *domain.Session) *domain.Session {
+	clone := *session
+	clone.RevokedAt = cloneTime(session.RevokedAt)
+	return &clone
+}
+
+func (r *SessionRepository) Create(ctx context.Context, session *domain.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	session.ID = newID()
+	r.sessions[session.ID] = cloneSession(session)
+	return nil
+}
+
+func (r *SessionRepository) GetByID(ctx context.Context, id string) (*domain.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, ok := r.sessions[id]
+	if !ok {
+		return nil, domain.ErrSessionNotFound
+	}
+	return cloneSession(session), nil
+}
+
+func (r *SessionRepository) Revoke(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[id]; ok && session.RevokedAt == nil {
+		now := time.Now()
+		session.RevokedAt = &now
+	}
+	return nil
+}
+
+// RevokeAllForUser revokes every active session of the user except exceptID,
+// which may be empty to revoke them all.
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID, exceptID string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var revoked int64
+	now := time.Now()
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.ID != exceptID && session.RevokedAt == nil {
+			session.RevokedAt = &now
+			revoked++
+		}
+	}
+	return revoked, nil
+}
+
+// ListByUser returns every session of the user, newest first, including
+// revoked and expired ones.
+func (r *SessionRepository) ListByUser(ctx context.Context, userID string) ([]*domain.Session, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sessions := []*domain.Session{}
+	for _, session := range r.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, cloneSession(session))
+		}
+	}
+	slices.SortFunc(sessions, func(a, b *domain.Session) int {
+		return cmp.Compare(b.ID, a.ID)
+	})
+	return sessions, nil
+}
+
+func (r *SessionRepository) DeleteByUser(ctx context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, session := range r.sessions {
+		if session.UserID == userID {
+			delete(r.sessions, id)
+		}
+	}
+	return nil
+}
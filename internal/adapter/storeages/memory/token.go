@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type OneTimeTokenRepository struct {
+	mu     sync.RWMutex
+	tokens map[string]*domain.OneTimeToken
+}
+
+func NewOneTimeTokenRepository() *OneTimeTokenRepository {
+	return &OneTimeTokenRepository{tokens: map[string]*domain.OneTimeToken{}}
+}
+
+func cloneToken(token *domain.OneTimeToken) *domain.OneTimeToken {
+	clone := *token
+	clone.Data = maps.Clone(token.Data)
+	clone.UsedAt = cloneTime(token.UsedAt)
+	return &clone
+}
+
+func (r *OneTimeTokenRepository) Create(ctx context.Context, token *domain.OneTimeToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	token.ID = newID()
+	r.tokens[token.ID] = cloneToken(token)
+	return nil
+}
+
+func (r *OneTimeTokenRepository) GetByHash(ctx context.Context, purpose, tokenHash string) (*domain.OneTimeToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, token := range r.tokens {
+		if token.Purpose == purpose && token.TokenHash == tokenHash {
+			return cloneToken(token), nil
+		}
+	}
+	return nil, domain.ErrTokenNotFound
+}
+
+// MarkUsed consumes the token. It fails with domain.ErrTokenUsed when another
+// request consumed it first.
+func (r *OneTimeTokenRepository) MarkUsed(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok || token.UsedAt != nil {
+		return domain.ErrTokenUsed
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	return nil
+}
+
+// Update replaces the data and expiry of an unused token.
+func (r *OneTimeTokenRepository) Update(ctx context.Context, token *domain.OneTimeToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tokens[token.ID]
+	if !ok || stored.UsedAt != nil {
+		return domain.ErrTokenUsed
+	}
+	stored.Data = maps.Clone(token.Data)
+	stored.ExpiresAt = token.ExpiresAt
+	return nil
+}
+
+// IncrementAttempts atomically counts a failed attempt at using the token and
+// returns the new total.
+func (r *OneTimeTokenRepository) IncrementAttempts(ctx context.Context, id string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[id]
+	if !ok {
+		return 0, domain.ErrTokenNotFound
+	}
+	token.Attempts++
+	return token.Attempts, nil
+}
+
+func (r *OneTimeTokenRepository) DeleteByUser(ctx context.Context, userID string, purposes ...string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, token := range r.tokens {
+		if token.UserID == userID && (len(purposes) == 0 || slices.Contains(purposes, token.Purpose)) {
+			delete(r.tokens, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,422 @@
+package memory
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// UserRepository keeps users in memory, for tests and for running the API
+// without a database. Like the database backends, it refuses to give two
+// live users the same email.
+type UserRepository struct {
+	mu    sync.RWMutex
+	users map[string]*domain.User
+}
+
+func NewUserRepository() *UserRepository {
+	return &UserRepository{users: map[string]*domain.User{}}
+}
+
+// userFields copies each field UserRepository.Update can write
+var userFields = map[string]func(stored, user *domain.User){
+	domain.UserFieldName:              func(stored, user *domain.User) { stored.Name = user.Name },
+	domain.UserFieldEmail:             func(stored, user *domain.User) { stored.Email = user.Email },
+	domain.UserFieldPendingEmail:      func(stored, user *domain.User) { stored.PendingEmail = user.PendingEmail },
+	domain.UserFieldProfile:           func(stored, user *domain.User) { stored.Profile = user.Profile },
+	domain.UserFieldMetadata:          func(stored, user *domain.User) { stored.Metadata = user.Metadata },
+	domain.UserFieldAdminMetadata:     func(stored, user *domain.User) { stored.AdminMetadata = user.AdminMetadata },
+	domain.UserFieldAvatar:            func(stored, user *domain.User) { stored.Avatar = user.Avatar },
+	domain.UserFieldRole:              func(stored, user *domain.User) { stored.Role = user.Role },
+	domain.UserFieldStatus:            func(stored, user *domain.User) { stored.Status = user.Status },
+	domain.UserFieldStatusReason:      func(stored, user *domain.User) { stored.StatusReason = user.StatusReason },
+	domain.UserFieldStatusUntil:       func(stored, user *domain.User) { stored.StatusUntil = user.StatusUntil },
+	domain.UserFieldPassword:          func(stored, user *domain.User) { stored.Password = user.Password },
+	domain.UserFieldPasswordHistory:   func(stored, user *domain.User) { stored.PasswordHistory = user.PasswordHistory },
+	domain.UserFieldPasswordChangedAt: func(stored, user *domain.User) { stored.PasswordChangedAt = user.PasswordChangedAt },
+	"failed_logins":                   func(stored, user *domain.User) { stored.FailedLogins = user.FailedLogins },
+	"locked_until":                    func(stored, user *domain.User) { stored.LockedUntil = user.LockedUntil },
+	domain.UserFieldMFAMethods:        func(stored, user *domain.User) { stored.MFAMethods = user.MFAMethods },
+	domain.UserFieldPreferredMFA:      func(stored, user *domain.User) { stored.PreferredMFA = user.PreferredMFA },
+	"created_at":                      func(stored, user *domain.User) { stored.CreatedAt = user.CreatedAt },
+}
+
+// cloneUser copies user so that callers never share memory with the store
+func cloneUser(user *domain.User) *domain.User {
+	clone := *user
+	clone.Metadata = maps.Clone(user.Metadata)
+	clone.AdminMetadata = maps.Clone(user.AdminMetadata)
+	clone.PasswordHistory = slices.Clone(user.PasswordHistory)
+	clone.MFAMethods = slices.Clone(user.MFAMethods)
+	clone.StatusUntil = cloneTime(user.StatusUntil)
+	clone.PasswordChangedAt = cloneTime(user.PasswordChangedAt)
+	clone.LockedUntil = cloneTime(user.LockedUntil)
+	clone.DeletedAt = cloneTime(user.DeletedAt)
+	return &clone
+}
+
+// emailTaken reports whether a live user other than id has the email. The
+// caller must hold the lock.
+func (r *UserRepository) emailTaken(email, id string) bool {
+	for _, user := range r.users {
+		if user.DeletedAt == nil && user.ID != id && user.Email == email {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.emailTaken(user.Email, "") {
+		return domain.ErrEmailTaken
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	if user.ID == "" {
+		user.ID = newID()
+	}
+	user.Version = 1
+	r.users[user.ID] = cloneUser(user)
+	return nil
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id string) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return nil, domain.ErrUserNotFound
+	}
+	return cloneUser(user), nil
+}
+
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.DeletedAt == nil && user.Email == email {
+			return cloneUser(user), nil
+		}
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+// Update writes the given fields of the user, or all of them when none are
+// listed, and bumps its version. Like in MongoDB, soft deleted users can
+// still be updated.
+func (r *UserRepository) Update(ctx context.Context, user *domain.User, fields ...string) error {
+	if len(fields) == 0 {
+		fields = slices.Collect(maps.Keys(userFields))
+	}
+	for _, field := range fields {
+		if _, ok := userFields[field]; !ok {
+			return fmt.Errorf("unknown user field %q", field)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[user.ID]
+	if !ok && user.Version == domain.AnyVersion {
+		return domain.ErrUserNotFound
+	}
+	if !ok || (user.Version != domain.AnyVersion && stored.Version != user.Version) {
+		return domain.ErrVersionConflict
+	}
+	updated := cloneUser(stored)
+	source := cloneUser(user)
+	for _, field := range fields {
+		userFields[field](updated, source)
+	}
+	if updated.DeletedAt == nil && updated.Email != stored.Email && r.emailTaken(updated.Email, user.ID) {
+		return domain.ErrEmailTaken
+	}
+	updated.Version++
+	r.users[user.ID] = updated
+	user.Version = updated.Version
+	return nil
+}
+
+// IncrementFailedLogins atomically counts a wrong password and returns the
+// new total.
+func (r *UserRepository) IncrementFailedLogins(ctx context.Context, id string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return 0, domain.ErrUserNotFound
+	}
+	user.FailedLogins++
+	return user.FailedLogins, nil
+}
+
+func (r *UserRepository) ResetFailedLogins(ctx context.Context, id string, lockedUntil *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return domain.ErrUserNotFound
+	}
+	user.FailedLogins = 0
+	user.LockedUntil = cloneTime(lockedUntil)
+	return nil
+}
+
+func (r *UserRepository) Delete(ctx context.Context, id string, version int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt != nil {
+		return domain.ErrUserNotFound
+	}
+	if version != domain.AnyVersion && user.Version != version {
+		return domain.ErrVersionConflict
+	}
+	now := time.Now()
+	user.DeletedAt = &now
+	user.Version++
+	return nil
+}
+
+func (r *UserRepository) GetDeletedByID(ctx context.Context, id string) (*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil {
+		return nil, domain.ErrUserNotFound
+	}
+	return cloneUser(user), nil
+}
+
+func (r *UserRepository) Restore(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil {
+		return domain.ErrUserNotFound
+	}
+	if r.emailTaken(user.Email, id) {
+		return domain.ErrEmailTaken
+	}
+	user.DeletedAt = nil
+	user.Version++
+	return nil
+}
+
+func (r *UserRepository) ListDeletedBefore(ctx context.Context, before time.Time, limit int64) ([]*domain.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var users []*domain.User
+	for _, user := range r.users {
+		if user.DeletedAt != nil && user.DeletedAt.Before(before) {
+			users = append(users, cloneUser(user))
+		}
+	}
+	slices.SortFunc(users, func(a, b *domain.User) int {
+		return cmp.Or(a.DeletedAt.Compare(*b.DeletedAt), cmp.Compare(a.ID, b.ID))
+	})
+	return page(users, limit, 0), nil
+}
+
+func (r *UserRepository) Purge(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt == nil {
+		return domain.ErrUserNotFound
+	}
+	delete(r.users, id)
+	return nil
+}
+
+// matchUser reports whether a live user matches filter. Search looks for
+// any of its words among the words of the name and email, ignoring case,
+// like a MongoDB text index without a language.
+func matchUser(user *domain.User, filter *domain.UserFilter) bool {
+	if user.DeletedAt != nil {
+		return false
+	}
+	if filter == nil {
+		return true
+	}
+	hasPrefix := func(s, prefix string) bool {
+		return strings.HasPrefix(strings.ToLower(s), strings.ToLower(prefix))
+	}
+	if filter.EmailPrefix != "" && !hasPrefix(user.Email, filter.EmailPrefix) {
+		return false
+	}
+	if filter.NamePrefix != "" && !hasPrefix(user.Name, filter.NamePrefix) {
+		return false
+	}
+	if filter.Search != "" && !matchSearch(user, filter.Search) {
+		return false
+	}
+	if !filter.CreatedFrom.IsZero() && user.CreatedAt.Before(filter.CreatedFrom) {
+		return false
+	}
+	if !filter.CreatedTo.IsZero() && user.CreatedAt.After(filter.CreatedTo) {
+		return false
+	}
+	// Users without a status or role are active users
+	if filter.Status != "" && cmp.Or(user.Status, domain.UserStatusActive) != filter.Status {
+		return false
+	}
+	if filter.Role != "" && cmp.Or(user.Role, domain.RoleUser) != filter.Role {
+		return false
+	}
+	return true
+}
+
+func matchSearch(user *domain.User, search string) bool {
+	split := func(s string) []string {
+		return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+	}
+	words := append(split(user.Name), split(user.Email)...)
+	for _, term := range split(search) {
+		if slices.Contains(words, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareUsers orders users by the sort of filter, by creation by default,
+// then by ID so that the order is stable
+func compareUsers(filter *domain.UserFilter) func(a, b *domain.User) int {
+	sort := []domain.SortField{{Field: "created_at"}}
+	if filter != nil && len(filter.Sort) > 0 {
+		sort = filter.Sort
+	}
+	return func(a, b *domain.User) int {
+		for _, field := range sort {
+			var c int
+			switch field.Field {
+			case "name":
+				c = strings.Compare(a.Name, b.Name)
+			case "email":
+				c = strings.Compare(a.Email, b.Email)
+			case "created_at":
+				c = a.CreatedAt.Compare(b.CreatedAt)
+			}
+			if field.Desc {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.ID, b.ID)
+	}
+}
+
+// list returns the users matching filter in listing order, with the cursor
+// applied, and how many users match it ignoring the cursor. The caller must
+// hold the lock.
+func (r *UserRepository) list(filter *domain.UserFilter, limit, offset int64) ([]*domain.User, int64) {
+	var users []*domain.User
+	for _, user := range r.users {
+		if matchUser(user, filter) {
+			users = append(users, user)
+		}
+	}
+	total := int64(len(users))
+
+	if filter == nil || filter.Cursor == nil {
+		slices.SortFunc(users, compareUsers(filter))
+		return page(users, limit, offset), total
+	}
+
+	// Walking forward through an ascending listing or backward through a
+	// descending one both mean looking at greater keys.
+	cursor := filter.Cursor
+	direction := 1
+	if cursor.Desc != cursor.Backward {
+		direction = -1
+	}
+	position := func(user *domain.User) int {
+		return cmp.Or(user.CreatedAt.Compare(cursor.CreatedAt), strings.Compare(user.ID, cursor.ID))
+	}
+	users = slices.DeleteFunc(users, func(user *domain.User) bool {
+		return position(user)*direction <= 0
+	})
+	slices.SortFunc(users, func(a, b *domain.User) int {
+		return direction * cmp.Or(a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+	})
+	users = page(users, limit, 0)
+	// A backward page is read in reverse, put it back in listing order.
+	if cursor.Backward {
+		slices.Reverse(users)
+	}
+	return users, total
+}
+
+func (r *UserRepository) List(ctx context.Context, filter *domain.UserFilter, limit, offset int64) ([]*domain.User, error) {
+	users, _, err := r.ListAndCount(ctx, filter, limit, offset)
+	return users, err
+}
+
+func (r *UserRepository) Count(ctx context.Context, filter *domain.UserFilter) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	for _, user := range r.users {
+		if matchUser(user, filter) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *UserRepository) ListAndCount(ctx context.Context, filter *domain.UserFilter, limit, offset int64) ([]*domain.User, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users, total := r.list(filter, limit, offset)
+	clones := make([]*domain.User, 0, len(users))
+	for _, user := range users {
+		clones = append(clones, cloneUser(user))
+	}
+	return clones, total, nil
+}
+
+// ForEach calls fn with a snapshot of the users taken when it starts, so
+// that fn can write to the repository.
+func (r *UserRepository) ForEach(ctx context.Context, filter *domain.UserFilter, fn func(*domain.User) error) error {
+	users, err := r.List(ctx, filter, 0, 0)
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		user.Password = ""
+		user.PasswordHistory = nil
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return nil
+}
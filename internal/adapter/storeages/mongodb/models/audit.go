@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type AuditEntry struct {
+	ID        bson.ObjectID     `bson:"_id,omitempty"`
+	Seq       int64             `bson:"seq"`
+	Time      time.Time         `bson:"time"`
+	ActorID   string            `bson:"actor_id,omitempty"`
+	TargetID  string            `bson:"target_id,omitempty"`
+	Action    string            `bson:"action"`
+	Outcome   string            `bson:"outcome"`
+	IP        string            `bson:"ip,omitempty"`
+	UserAgent string            `bson:"user_agent,omitempty"`
+	Details   map[string]string `bson:"details,omitempty"`
+	PrevHash  string            `bson:"prev_hash"`
+	Hash      string            `bson:"hash"`
+}
+
+func NewAuditEntry(entry *domain.AuditEntry) (*AuditEntry, error) {
+	id, err := objectID(entry.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditEntry{
+		ID:        id,
+		Seq:       entry.Seq,
+		Time:      entry.Time,
+		ActorID:   entry.ActorID,
+		TargetID:  entry.TargetID,
+		Action:    entry.Action,
+		Outcome:   entry.Outcome,
+		IP:        entry.IP,
+		UserAgent: entry.UserAgent,
+		Details:   entry.Details,
+		PrevHash:  entry.PrevHash,
+		Hash:      entry.Hash,
+	}, nil
+}
+
+func (e *AuditEntry) ToDomain() *domain.AuditEntry {
+	return &domain.AuditEntry{
+		ID:        hex(e.ID),
+		Seq:       e.Seq,
+		Time:      e.Time,
+		ActorID:   e.ActorID,
+		TargetID:  e.TargetID,
+		Action:    e.Action,
+		Outcome:   e.Outcome,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Details:   e.Details,
+		PrevHash:  e.PrevHash,
+		Hash:      e.Hash,
+	}
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"crypto/sha256"
+
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// roundTrip stores entry as MongoDB would and reads it back
+func roundTrip(t *testing.T, entry *domain.AuditEntry) *domain.AuditEntry {
+	t.Helper()
+	stored, err := NewAuditEntry(entry)
+	require.NoError(t, err)
+	raw, err := bson.Marshal(stored)
+	require.NoError(t, err)
+	var read AuditEntry
+	require.NoError(t, bson.Unmarshal(raw, &read))
+	return read.ToDomain()
+}
+
+func TestAuditEntry_HashSurvivesRoundTrip(t *testing.T) {
+	for name, details := range map[string]map[string]string{
+		"nil details":   nil,
+		"empty details": {},
+		"details":       {"email_change": "requested"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			entry := &domain.AuditEntry{
+				Seq:      4,
+				Time:     time.Date(2024, 1, 2, 3, 4, 5, 678_000_000, time.UTC),
+				ActorID:  "010203000000000000000000",
+				Action:   domain.AuditActionUserUpdate,
+				Outcome:  domain.AuditOutcomeSuccess,
+				Details:  details,
+				PrevHash: "previous",
+			}
+			entry.Hash = entry.ComputeHash()
+
+			read := roundTrip(t, entry)
+			assert.Equal(t, entry.Hash, read.ComputeHash())
+			assert.True(t, read.HashMatches())
+		})
+	}
+}
+
+// legacyHash is the hash entries used to get when they were written with
+// empty details, which hashed them as {} rather than null
+func legacyHash(e *domain.AuditEntry) string {
+	payload, _ := json.Marshal(struct {
+		Seq       int64             `json:"seq"`
+		Time      string            `json:"time"`
+		ActorID   string            `json:"actor_id"`
+		TargetID  string            `json:"target_id"`
+		Action    string            `json:"action"`
+		Outcome   string            `json:"outcome"`
+		IP        string            `json:"ip"`
+		UserAgent string            `json:"user_agent"`
+		Details   map[string]string `json:"details"`
+		PrevHash  string            `json:"prev_hash"`
+	}{e.Seq, e.Time.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano), e.ActorID, e.TargetID, e.Action, e.Outcome, e.IP, e.UserAgent, map[string]string{}, e.PrevHash})
+	sum := sha256.Sum256(payload)
+	return fmt.Sprintf("%x", sum)
+}
+
+func TestAuditEntry_LegacyEmptyDetailsHash(t *testing.T) {
+	entry := &domain.AuditEntry{
+		Seq:      7,
+		Time:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		TargetID: "010203000000000000000000",
+		Action:   domain.AuditActionUserUpdate,
+		Outcome:  domain.AuditOutcomeSuccess,
+		Details:  map[string]string{},
+		PrevHash: "previous",
+	}
+	entry.Hash = legacyHash(entry)
+
+	read := roundTrip(t, entry)
+	assert.Nil(t, read.Details)
+	assert.True(t, read.HashMatches())
+
+	read.Details = map[string]string{"email_change": "requested"}
+	assert.False(t, read.HashMatches(), "details added after the fact")
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// objectID parses a domain ID. An empty ID is the zero ObjectID, which
+// InsertOne replaces with a new one.
+func objectID(id string) (bson.ObjectID, error) {
+	if id == "" {
+		return bson.ObjectID{}, nil
+	}
+	oid, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return bson.ObjectID{}, fmt.Errorf("invalid id format: %w", err)
+	}
+	return oid, nil
+}
+
+// hex formats an ObjectID as a domain ID, leaving the zero ObjectID empty
+func hex(oid bson.ObjectID) string {
+	if oid.IsZero() {
+		return ""
+	}
+	return oid.Hex()
+}
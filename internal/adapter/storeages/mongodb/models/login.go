@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type LoginEvent struct {
+	ID        bson.ObjectID `bson:"_id,omitempty"`
+	UserID    bson.ObjectID `bson:"user_id"`
+	Time      time.Time     `bson:"time"`
+	Success   bool          `bson:"success"`
+	Reason    string        `bson:"reason,omitempty"`
+	Methods   []string      `bson:"methods,omitempty"`
+	IP        string        `bson:"ip,omitempty"`
+	UserAgent string        `bson:"user_agent,omitempty"`
+	DeviceID  string        `bson:"device_id"`
+}
+
+func NewLoginEvent(event *domain.LoginEvent) (*LoginEvent, error) {
+	id, err := objectID(event.ID)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := objectID(event.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &LoginEvent{
+		ID:        id,
+		UserID:    userID,
+		Time:      event.Time,
+		Success:   event.Success,
+		Reason:    event.Reason,
+		Methods:   event.Methods,
+		IP:        event.IP,
+		UserAgent: event.UserAgent,
+		DeviceID:  event.DeviceID,
+	}, nil
+}
+
+func (e *LoginEvent) ToDomain() *domain.LoginEvent {
+	return &domain.LoginEvent{
+		ID:        hex(e.ID),
+		UserID:    hex(e.UserID),
+		Time:      e.Time,
+		Success:   e.Success,
+		Reason:    e.Reason,
+		Methods:   e.Methods,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		DeviceID:  e.DeviceID,
+	}
+}
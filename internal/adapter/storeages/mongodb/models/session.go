@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type Session struct {
+	ID             bson.ObjectID  `bson:"_id,omitempty"`
+	UserID         bson.ObjectID  `bson:"user_id"`
+	CreatedAt      time.Time      `bson:"created_at"`
+	ExpiresAt      time.Time      `bson:"expires_at"`
+	RevokedAt      *time.Time     `bson:"revoked_at,omitempty"`
+	ImpersonatorID *bson.ObjectID `bson:"impersonator_id,omitempty"`
+}
+
+func NewSession(session *domain.Session) (*Session, error) {
+	id, err := objectID(session.ID)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := objectID(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	model := &Session{
+		ID:        id,
+		UserID:    userID,
+		CreatedAt: session.CreatedAt,
+		ExpiresAt: session.ExpiresAt,
+		RevokedAt: session.RevokedAt,
+	}
+	if session.ImpersonatorID != "" {
+		impersonatorID, err := objectID(session.ImpersonatorID)
+		if err != nil {
+			return nil, err
+		}
+		model.ImpersonatorID = &impersonatorID
+	}
+	return model, nil
+}
+
+func (s *Session) ToDomain() *domain.Session {
+	session := &domain.Session{
+		ID:        hex(s.ID),
+		UserID:    hex(s.UserID),
+		CreatedAt: s.CreatedAt,
+		ExpiresAt: s.ExpiresAt,
+		RevokedAt: s.RevokedAt,
+	}
+	if s.ImpersonatorID != nil {
+		session.ImpersonatorID = hex(*s.ImpersonatorID)
+	}
+	return session
+}
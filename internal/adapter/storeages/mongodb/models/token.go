@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type OneTimeToken struct {
+	ID        bson.ObjectID     `bson:"_id,omitempty"`
+	UserID    bson.ObjectID     `bson:"user_id"`
+	Purpose   string            `bson:"purpose"`
+	TokenHash string            `bson:"token_hash"`
+	Data      map[string]string `bson:"data,omitempty"`
+	Attempts  int               `bson:"attempts,omitempty"`
+	CreatedAt time.Time         `bson:"created_at"`
+	ExpiresAt time.Time         `bson:"expires_at"`
+	UsedAt    *time.Time        `bson:"used_at,omitempty"`
+}
+
+func NewOneTimeToken(token *domain.OneTimeToken) (*OneTimeToken, error) {
+	id, err := objectID(token.ID)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := objectID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	return &OneTimeToken{
+		ID:        id,
+		UserID:    userID,
+		Purpose:   token.Purpose,
+		TokenHash: token.TokenHash,
+		Data:      token.Data,
+		Attempts:  token.Attempts,
+		CreatedAt: token.CreatedAt,
+		ExpiresAt: token.ExpiresAt,
+		UsedAt:    token.UsedAt,
+	}, nil
+}
+
+func (t *OneTimeToken) ToDomain() *domain.OneTimeToken {
+	return &domain.OneTimeToken{
+		ID:        hex(t.ID),
+		UserID:    hex(t.UserID),
+		Purpose:   t.Purpose,
+		TokenHash: t.TokenHash,
+		Data:      t.Data,
+		Attempts:  t.Attempts,
+		CreatedAt: t.CreatedAt,
+		ExpiresAt: t.ExpiresAt,
+		UsedAt:    t.UsedAt,
+	}
+}
@@ -4,12 +4,148 @@ import (
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
 )
 
+// User is how a domain.User is stored
 type User struct {
-	ID        bson.ObjectID `bson:"_id,omitempty" json:"id"`
-	Name      string        `bson:"name" json:"name"`
-	Email     string        `bson:"email" json:"email"`
-	Password  string        `bson:"password" json:"-"`
-	CreatedAt time.Time     `bson:"created_at" json:"created_at"`
+	ID                bson.ObjectID  `bson:"_id,omitempty"`
+	Name              string         `bson:"name"`
+	Email             string         `bson:"email"`
+	Profile           UserProfile    `bson:"profile,omitempty"`
+	Metadata          map[string]any `bson:"metadata,omitempty"`
+	AdminMetadata     map[string]any `bson:"admin_metadata,omitempty"`
+	PendingEmail      string         `bson:"pending_email,omitempty"`
+	Role              string         `bson:"role,omitempty"`
+	Status            string         `bson:"status,omitempty"`
+	StatusReason      string         `bson:"status_reason,omitempty"`
+	StatusUntil       *time.Time     `bson:"status_until,omitempty"`
+	Password          string         `bson:"password"`
+	PasswordHistory   []string       `bson:"password_history,omitempty"`
+	PasswordChangedAt *time.Time     `bson:"password_changed_at,omitempty"`
+	FailedLogins      int            `bson:"failed_logins,omitempty"`
+	LockedUntil       *time.Time     `bson:"locked_until,omitempty"`
+	MFAMethods        []string       `bson:"mfa_methods,omitempty"`
+	PreferredMFA      string         `bson:"preferred_mfa,omitempty"`
+	CreatedAt         time.Time      `bson:"created_at"`
+	Version           int64          `bson:"version,omitempty"`
+	DeletedAt         *time.Time     `bson:"deleted_at,omitempty"`
+	Avatar            string         `bson:"avatar,omitempty"`
+	// EmailIndex is a blind index of the email, set when emails are stored
+	// encrypted so that users can still be found by email
+	EmailIndex string `bson:"email_index,omitempty"`
+}
+
+type UserProfile struct {
+	DisplayName string `bson:"display_name,omitempty"`
+	Locale      string `bson:"locale,omitempty"`
+	Timezone    string `bson:"timezone,omitempty"`
+	AvatarURL   string `bson:"avatar_url,omitempty"`
+	Phone       string `bson:"phone,omitempty"`
+}
+
+func NewUser(user *domain.User) (*User, error) {
+	id, err := objectID(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &User{
+		ID:                id,
+		Name:              user.Name,
+		Email:             user.Email,
+		Profile:           UserProfile(user.Profile),
+		Metadata:          user.Metadata,
+		AdminMetadata:     user.AdminMetadata,
+		PendingEmail:      user.PendingEmail,
+		Role:              user.Role,
+		Status:            user.Status,
+		StatusReason:      user.StatusReason,
+		StatusUntil:       user.StatusUntil,
+		Password:          user.Password,
+		PasswordHistory:   user.PasswordHistory,
+		PasswordChangedAt: user.PasswordChangedAt,
+		FailedLogins:      user.FailedLogins,
+		LockedUntil:       user.LockedUntil,
+		MFAMethods:        user.MFAMethods,
+		PreferredMFA:      user.PreferredMFA,
+		CreatedAt:         user.CreatedAt,
+		Version:           user.Version,
+		DeletedAt:         user.DeletedAt,
+		Avatar:            user.Avatar,
+	}, nil
+}
+
+func (u *User) ToDomain() *domain.User {
+	return &domain.User{
+		ID:                hex(u.ID),
+		Name:              u.Name,
+		Email:             u.Email,
+		Profile:           domain.UserProfile(u.Profile),
+		Metadata:          jsonObject(u.Metadata),
+		AdminMetadata:     jsonObject(u.AdminMetadata),
+		PendingEmail:      u.PendingEmail,
+		Role:              u.Role,
+		Status:            u.Status,
+		StatusReason:      u.StatusReason,
+		StatusUntil:       u.StatusUntil,
+		Password:          u.Password,
+		PasswordHistory:   u.PasswordHistory,
+		PasswordChangedAt: u.PasswordChangedAt,
+		FailedLogins:      u.FailedLogins,
+		LockedUntil:       u.LockedUntil,
+		MFAMethods:        u.MFAMethods,
+		PreferredMFA:      u.PreferredMFA,
+		CreatedAt:         u.CreatedAt,
+		Version:           u.Version,
+		DeletedAt:         u.DeletedAt,
+		Avatar:            u.Avatar,
+	}
+}
+
+// jsonObject converts a document decoded from BSON into the values
+// encoding/json would decode it to, so that metadata looks the same whatever
+// the store: nested documents become maps, arrays slices and integers
+// float64.
+func jsonObject(document map[string]any) map[string]any {
+	if document == nil {
+		return nil
+	}
+	object := make(map[string]any, len(document))
+	for key, value := range document {
+		object[key] = jsonValue(value)
+	}
+	return object
+}
+
+func jsonValue(value any) any {
+	switch value := value.(type) {
+	case bson.D:
+		object := make(map[string]any, len(value))
+		for _, element := range value {
+			object[element.Key] = jsonValue(element.Value)
+		}
+		return object
+	case bson.M:
+		return jsonObject(value)
+	case map[string]any:
+		return jsonObject(value)
+	case bson.A:
+		return jsonArray(value)
+	case []any:
+		return jsonArray(value)
+	case int32:
+		return float64(value)
+	case int64:
+		return float64(value)
+	}
+	return value
+}
+
+func jsonArray(array []any) []any {
+	values := make([]any, len(array))
+	for i, value := range array {
+		values[i] = jsonValue(value)
+	}
+	return values
 }
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+func TestUserToDomain_Metadata(t *testing.T) {
+	raw, err := bson.Marshal(bson.M{
+		"name": "Jane Doe",
+		"metadata": bson.M{
+			"newsletter": true,
+			"score":      int32(3),
+			"visits":     int64(12),
+			"ratio":      0.5,
+			"address":    bson.M{"city": "Paris", "codes": bson.A{int32(75), "FR"}},
+		},
+		"admin_metadata": bson.M{"tags": bson.A{bson.M{"name": "vip"}}},
+	})
+	require.NoError(t, err)
+	var stored User
+	require.NoError(t, bson.Unmarshal(raw, &stored))
+
+	user := stored.ToDomain()
+	assert.Equal(t, map[string]any{
+		"newsletter": true,
+		"score":      float64(3),
+		"visits":     float64(12),
+		"ratio":      0.5,
+		"address":    map[string]any{"city": "Paris", "codes": []any{float64(75), "FR"}},
+	}, user.Metadata)
+	assert.Equal(t, map[string]any{"tags": []any{map[string]any{"name": "vip"}}}, user.AdminMetadata)
+
+	assert.Nil(t, (&User{}).ToDomain().Metadata)
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb/models"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// AuditRepository stores the audit log. It only ever inserts; the unique
+// index on seq makes concurrent writers race for the next number instead of
+// forking the hash chain.
+type AuditRepository struct {
+	collection *mongo.Collection
+}
+
+func NewAuditRepository(client *mongo.Client, dbName, collectionName string) *AuditRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &AuditRepository{collection: collection}
+}
+
+// EnsureIndexes creates the indexes the audit log relies on
+func (r *AuditRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "seq", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "seq", Value: -1}}},
+		{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "seq", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "seq", Value: -1}}},
+		{Keys: bson.D{{Key: "time", Value: -1}}},
+	})
+	return err
+}
+
+func (r *AuditRepository) Append(ctx context.Context, entry *domain.AuditEntry) error {
+	model, err := models.NewAuditEntry(entry)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.InsertOne(ctx, model)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return domain.ErrAuditConflict
+		}
+		return err
+	}
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		entry.ID = oid.Hex()
+	} else {
+		return errors.New("failed to convert InsertedID to ObjectID")
+	}
+	return nil
+}
+
+// Last returns the entry with the highest sequence number, or nil when the
+// log is empty.
+func (r *AuditRepository) Last(ctx context.Context) (*domain.AuditEntry, error) {
+	opts := options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}})
+	var entry models.AuditEntry
+	err := r.collection.FindOne(ctx, bson.M{}, opts).Decode(&entry)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return entry.ToDomain(), nil
+}
+
+func (r *AuditRepository) List(ctx context.Context, filter *domain.AuditFilter, limit, offset int64) ([]*domain.AuditEntry, error) {
+	query := bson.M{}
+	if filter.ActorID != "" {
+		query["actor_id"] = filter.ActorID
+	}
+	if filter.TargetID != "" {
+		query["target_id"] = filter.TargetID
+	}
+	if filter.Subject != "" {
+		query["$or"] = bson.A{bson.M{"actor_id": filter.Subject}, bson.M{"target_id": filter.Subject}}
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.Outcome != "" {
+		query["outcome"] = filter.Outcome
+	}
+	timeRange := bson.M{}
+	if !filter.From.IsZero() {
+		timeRange["$gte"] = filter.From
+	}
+	if !filter.To.IsZero() {
+		timeRange["$lte"] = filter.To
+	}
+	if len(timeRange) > 0 {
+		query["time"] = timeRange
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	if offset > 0 {
+		opts.SetSkip(offset)
+	}
+
+	cursor, err := r.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []*domain.AuditEntry{}
+	for cursor.Next(ctx) {
+		var entry models.AuditEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry.ToDomain())
+	}
+	return entries, cursor.Err()
+}
+
+func (r *AuditRepository) Iterate(ctx context.Context, fn func(*domain.AuditEntry) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "seq", Value: 1}})
+	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var entry models.AuditEntry
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+		if err := fn(entry.ToDomain()); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
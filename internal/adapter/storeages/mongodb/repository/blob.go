@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// GridFSBlobStore keeps blobs in a GridFS bucket, using the key as file name
+type GridFSBlobStore struct {
+	bucket *mongo.GridFSBucket
+}
+
+func NewGridFSBlobStore(client *mongo.Client, dbName, bucketName string) *GridFSBlobStore {
+	bucket := client.Database(dbName).GridFSBucket(options.GridFSBucket().SetName(bucketName))
+	return &GridFSBlobStore{bucket: bucket}
+}
+
+type blobMetadata struct {
+	ContentType string `bson:"content_type"`
+}
+
+func (s *GridFSBlobStore) Put(ctx context.Context, key, contentType string, data io.Reader) error {
+	opts := options.GridFSUpload().SetMetadata(blobMetadata{ContentType: contentType})
+	id, err := s.bucket.UploadFromStream(ctx, key, data, opts)
+	if err != nil {
+		return err
+	}
+	// Older revisions go once the new one is complete, so that a failed
+	// upload leaves the previous blob readable
+	return s.deleteByName(ctx, key, id)
+}
+
+func (s *GridFSBlobStore) Open(ctx context.Context, key string) (io.ReadCloser, *domain.BlobInfo, error) {
+	stream, err := s.bucket.OpenDownloadStreamByName(ctx, key)
+	if err != nil {
+		if errors.Is(err, mongo.ErrFileNotFound) {
+			return nil, nil, domain.ErrBlobNotFound
+		}
+		return nil, nil, err
+	}
+
+	file := stream.GetFile()
+	var metadata blobMetadata
+	if len(file.Metadata) > 0 {
+		if err := bson.Unmarshal(file.Metadata, &metadata); err != nil {
+			stream.Close()
+			return nil, nil, err
+		}
+	}
+	if metadata.ContentType == "" {
+		metadata.ContentType = "application/octet-stream"
+	}
+	return stream, &domain.BlobInfo{ContentType: metadata.ContentType, Size: file.Length, ModTime: file.UploadDate}, nil
+}
+
+func (s *GridFSBlobStore) Delete(ctx context.Context, key string) error {
+	return s.deleteByName(ctx, key, nil)
+}
+
+// deleteByName removes every revision of the file named key except keep
+func (s *GridFSBlobStore) deleteByName(ctx context.Context, key string, keep any) error {
+	cursor, err := s.bucket.Find(ctx, bson.M{"filename": key})
+	if err != nil {
+		return err
+	}
+	var files []struct {
+		ID bson.ObjectID `bson:"_id"`
+	}
+	if err := cursor.All(ctx, &files); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if file.ID == keep {
+			continue
+		}
+		if err := s.bucket.Delete(ctx, file.ID); err != nil && !errors.Is(err, mongo.ErrFileNotFound) {
+			return err
+		}
+	}
+	return nil
+}
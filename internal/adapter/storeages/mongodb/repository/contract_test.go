@@ -0,0 +1,50 @@
+package repository_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb/repository"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/storetest"
+)
+
+// TestContract runs against the MongoDB server at MONGO_TEST_URI, in a new
+// database per test that is dropped afterwards.
+func TestContract(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+	client, err := mongodb.NewMongoClient(&config.Mongo{URI: uri})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		client.Disconnect(context.Background())
+	})
+
+	storetest.Run(t, func(t *testing.T) *storetest.Repositories {
+		ctx := context.Background()
+		dbName := fmt.Sprintf("contract_%d", time.Now().UnixNano())
+		t.Cleanup(func() {
+			client.Database(dbName).Drop(context.Background())
+		})
+
+		users := repository.NewUserRepository(client, dbName, "user", nil)
+		require.NoError(t, users.EnsureIndexes(ctx))
+		audit := repository.NewAuditRepository(client, dbName, "audit")
+		require.NoError(t, audit.EnsureIndexes(ctx))
+		return &storetest.Repositories{
+			Users:        users,
+			Sessions:     repository.NewSessionRepository(client, dbName, "session"),
+			Tokens:       repository.NewOneTimeTokenRepository(client, dbName, "one_time_token"),
+			LoginHistory: repository.NewLoginHistoryRepository(client, dbName, "login_history"),
+			Audit:        audit,
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb/models"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type LoginHistoryRepository struct {
+	collection *mongo.Collection
+}
+
+func NewLoginHistoryRepository(client *mongo.Client, dbName, collectionName string) *LoginHistoryRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &LoginHistoryRepository{collection: collection}
+}
+
+// EnsureIndexes creates the indexes the login history relies on
+func (r *LoginHistoryRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "device_id", Value: 1}, {Key: "success", Value: 1}}},
+	})
+	return err
+}
+
+func (r *LoginHistoryRepository) Create(ctx context.Context, event *domain.LoginEvent) error {
+	model, err := models.NewLoginEvent(event)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.InsertOne(ctx, model)
+	if err != nil {
+		return err
+	}
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		event.ID = oid.Hex()
+	} else {
+		return errors.New("failed to convert InsertedID to ObjectID")
+	}
+	return nil
+}
+
+func (r *LoginHistoryRepository) ListByUser(ctx context.Context, userID string, limit, offset int64) ([]*domain.LoginEvent, error) {
+	userObjectID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id format: %w", err)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+	if offset > 0 {
+		opts.SetSkip(offset)
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userObjectID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	events := []*domain.LoginEvent{}
+	for cursor.Next(ctx) {
+		var event models.LoginEvent
+		if err := cursor.Decode(&event); err != nil {
+			return nil, err
+		}
+		events = append(events, event.ToDomain())
+	}
+	return events, cursor.Err()
+}
+
+func (r *LoginHistoryRepository) HasDevice(ctx context.Context, userID, deviceID string) (bool, error) {
+	userObjectID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return false, fmt.Errorf("invalid user id format: %w", err)
+	}
+	filter := bson.M{"user_id": userObjectID, "device_id": deviceID, "success": true}
+	err = r.collection.FindOne(ctx, filter).Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *LoginHistoryRepository) CountSuccessful(ctx context.Context, userID string) (int64, error) {
+	userObjectID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user id format: %w", err)
+	}
+	return r.collection.CountDocuments(ctx, bson.M{"user_id": userObjectID, "success": true})
+}
+
+func (r *LoginHistoryRepository) Prune(ctx context.Context, userID string, keep int64) error {
+	userObjectID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user id format: %w", err)
+	}
+
+	// Find the oldest event to keep, then delete everything before it.
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}}).SetSkip(keep - 1)
+	var oldestKept models.LoginEvent
+	err = r.collection.FindOne(ctx, bson.M{"user_id": userObjectID}, opts).Decode(&oldestKept)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		return err
+	}
+
+	_, err = r.collection.DeleteMany(ctx, bson.M{"user_id": userObjectID, "_id": bson.M{"$lt": oldestKept.ID}})
+	return err
+}
+
+func (r *LoginHistoryRepository) DeleteByUser(ctx context.Context, userID string) error {
+	userObjectID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user id format: %w", err)
+	}
+	_, err = r.collection.DeleteMany(ctx, bson.M{"user_id": userObjectID})
+	return err
+}
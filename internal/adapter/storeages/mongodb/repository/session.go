@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb/models"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type SessionRepository struct {
+	collection *mongo.Collection
+}
+
+func NewSessionRepository(client *mongo.Client, dbName, collectionName string) *SessionRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &SessionRepository{collection: collection}
+}
+
+func (r *SessionRepository) Create(ctx context.Context, session *domain.Session) error {
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	model, err := models.NewSession(session)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.InsertOne(ctx, model)
+	if err != nil {
+		return err
+	}
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		session.ID = oid.Hex()
+	} else {
+		return errors.New("failed to convert InsertedID to ObjectID")
+	}
+	return nil
+}
+
+func (r *SessionRepository) GetByID(ctx context.Context, id string) (*domain.Session, error) {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id format: %w", err)
+	}
+
+	var session models.Session
+	err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&session)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, domain.ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return session.ToDomain(), nil
+}
+
+func (r *SessionRepository) Revoke(ctx context.Context, id string) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid id format: %w", err)
+	}
+	filter := bson.M{"_id": objectID, "revoked_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"revoked_at": time.Now()}}
+	_, err = r.collection.UpdateOne(ctx, filter, update)
+	return err
+}
+
+// RevokeAllForUser revokes every active session of the user except exceptID,
+// which may be empty to revoke them all.
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID, exceptID string) (int64, error) {
+	userObjectID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user id format: %w", err)
+	}
+	filter := bson.M{"user_id": userObjectID, "revoked_at": bson.M{"$exists": false}}
+	if exceptID != "" {
+		exceptObjectID, err := bson.ObjectIDFromHex(exceptID)
+		if err != nil {
+			return 0, fmt.Errorf("invalid session id format: %w", err)
+		}
+		filter["_id"] = bson.M{"$ne": exceptObjectID}
+	}
+	update := bson.M{"$set": bson.M{"revoked_at": time.Now()}}
+	result, err := r.collection.UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// ListByUser returns every session of the user, newest first, including
+// revoked and expired ones.
+func (r *SessionRepository) ListByUser(ctx context.Context, userID string) ([]*domain.Session, error) {
+	userObjectID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user id format: %w", err)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}})
+	cursor, err := r.collection.Find(ctx, bson.M{"user_id": userObjectID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []*domain.Session{}
+	for cursor.Next(ctx) {
+		var session models.Session
+		if err := cursor.Decode(&session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session.ToDomain())
+	}
+	return sessions, cursor.Err()
+}
+
+func (r *SessionRepository) DeleteByUser(ctx context.Context, userID string) error {
+	userObjectID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user id format: %w", err)
+	}
+	_, err = r.collection.DeleteMany(ctx, bson.M{"user_id": userObjectID})
+	return err
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb/models"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type OneTimeTokenRepository struct {
+	collection *mongo.Collection
+}
+
+func NewOneTimeTokenRepository(client *mongo.Client, dbName, collectionName string) *OneTimeTokenRepository {
+	collection := client.Database(dbName).Collection(collectionName)
+	return &OneTimeTokenRepository{collection: collection}
+}
+
+func (r *OneTimeTokenRepository) Create(ctx context.Context, token *domain.OneTimeToken) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	model, err := models.NewOneTimeToken(token)
+	if err != nil {
+		return err
+	}
+	result, err := r.collection.InsertOne(ctx, model)
+	if err != nil {
+		return err
+	}
+	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
+		token.ID = oid.Hex()
+	} else {
+		return errors.New("failed to convert InsertedID to ObjectID")
+	}
+	return nil
+}
+
+func (r *OneTimeTokenRepository) GetByHash(ctx context.Context, purpose, tokenHash string) (*domain.OneTimeToken, error) {
+	var token models.OneTimeToken
+	err := r.collection.FindOne(ctx, bson.M{"purpose": purpose, "token_hash": tokenHash}).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, domain.ErrTokenNotFound
+		}
+		return nil, err
+	}
+	return token.ToDomain(), nil
+}
+
+// MarkUsed consumes the token. It fails with domain.ErrTokenUsed when another
+// request consumed it first.
+func (r *OneTimeTokenRepository) MarkUsed(ctx context.Context, id string) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid id format: %w", err)
+	}
+	filter := bson.M{"_id": objectID, "used_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{"used_at": time.Now()}}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return domain.ErrTokenUsed
+	}
+	return nil
+}
+
+// Update replaces the data and expiry of an unused token.
+func (r *OneTimeTokenRepository) Update(ctx context.Context, token *domain.OneTimeToken) error {
+	objectID, err := bson.ObjectIDFromHex(token.ID)
+	if err != nil {
+		return fmt.Errorf("invalid id format: %w", err)
+	}
+	filter := bson.M{"_id": objectID, "used_at": bson.M{"$exists": false}}
+	update := bson.M{"$set": bson.M{
+		"data":       token.Data,
+		"expires_at": token.ExpiresAt,
+	}}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrTokenUsed
+	}
+	return nil
+}
+
+// IncrementAttempts atomically counts a failed attempt at using the token and
+// returns the new total.
+func (r *OneTimeTokenRepository) IncrementAttempts(ctx context.Context, id string) (int, error) {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id format: %w", err)
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	var token models.OneTimeToken
+	err = r.collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID}, bson.M{"$inc": bson.M{"attempts": 1}}, opts).Decode(&token)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, domain.ErrTokenNotFound
+		}
+		return 0, err
+	}
+	return token.Attempts, nil
+}
+
+func (r *OneTimeTokenRepository) DeleteByUser(ctx context.Context, userID string, purposes ...string) error {
+	userObjectID, err := bson.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user id format: %w", err)
+	}
+	filter := bson.M{"user_id": userObjectID}
+	if len(purposes) > 0 {
+		filter["purpose"] = bson.M{"$in": purposes}
+	}
+	_, err = r.collection.DeleteMany(ctx, filter)
+	return err
+}
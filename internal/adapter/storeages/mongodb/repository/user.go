@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"regexp"
+	"slices"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -11,119 +13,537 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 
 	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb/models"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/port"
 )
 
-var ErrUserNotFound = errors.New("user not found")
-
 type UserRepository struct {
 	collection *mongo.Collection
+	// encryptor encrypts personal data fields, nil stores them in plaintext
+	encryptor port.FieldEncryptor
 }
 
-func NewUserRepository(client *mongo.Client, dbName, collectionName string) *UserRepository {
+func NewUserRepository(client *mongo.Client, dbName, collectionName string, encryptor port.FieldEncryptor) *UserRepository {
 	collection := client.Database(dbName).Collection(collectionName)
-	return &UserRepository{collection: collection}
+	return &UserRepository{collection: collection, encryptor: encryptor}
 }
 
-func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
+// EnsureIndexes creates the indexes used to look up, filter and sort users
+func (r *UserRepository) EnsureIndexes(ctx context.Context) error {
+	_, err := r.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			// Unique among live users: they all lack deleted_at, while soft
+			// deleted users each have their own deletion time.
+			Keys: bson.D{{Key: "email", Value: 1}, {Key: "deleted_at", Value: 1}},
+			Options: options.Index().SetName("email_live").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"email": bson.M{"$gt": ""}}),
+		},
+		{
+			// Encrypted emails differ on every write, so the blind index is
+			// what catches two live users with the same email.
+			Keys: bson.D{{Key: "email_index", Value: 1}, {Key: "deleted_at", Value: 1}},
+			Options: options.Index().SetName("email_index_live").SetUnique(true).
+				SetPartialFilterExpression(bson.M{"email_index": bson.M{"$type": "string"}}),
+		},
+		{Keys: bson.D{{Key: "name", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "role", Value: 1}}},
+		{Keys: bson.D{{Key: "deleted_at", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "name", Value: "text"}, {Key: "email", Value: "text"}},
+			// No stemming or stop words, names and emails are not prose.
+			Options: options.Index().SetName("user_search").SetDefaultLanguage("none"),
+		},
+	})
+	return err
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
 	if user.CreatedAt.IsZero() {
 		user.CreatedAt = time.Now()
 	}
-	result, err := r.collection.InsertOne(ctx, user)
+	user.Version = 1
+	stored, err := r.encryptUser(user)
 	if err != nil {
 		return err
 	}
+	result, err := r.collection.InsertOne(ctx, stored)
+	if err != nil {
+		return mapDuplicateEmail(err)
+	}
 	if oid, ok := result.InsertedID.(bson.ObjectID); ok {
-		user.ID = oid
+		user.ID = oid.Hex()
 	} else {
 		return errors.New("failed to convert InsertedID to ObjectID")
 	}
 	return nil
 }
 
-func (r *UserRepository) GetByID(ctx context.Context, id string) (*models.User, error) {
+func (r *UserRepository) GetByID(ctx context.Context, id string) (*domain.User, error) {
 	objectID, err := bson.ObjectIDFromHex(id)
 	if err != nil {
 		return nil, fmt.Errorf("invalid id format: %w", err)
 	}
 
 	var user models.User
-	err = r.collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	err = r.collection.FindOne(ctx, bson.M{"_id": objectID, "deleted_at": nil}).Decode(&user)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, ErrUserNotFound
+			return nil, domain.ErrUserNotFound
 		}
 		return nil, err
 	}
-	return &user, nil
+	return r.decryptUser(&user)
 }
 
-func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+// GetByEmail finds users by the blind index when emails are encrypted, or by
+// the plaintext email of users not yet encrypted.
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	query := bson.M{"email": email, "deleted_at": nil}
+	if r.encryptsEmail() {
+		index := r.encryptor.BlindIndex(domain.EncryptedFieldEmail, email)
+		query = bson.M{"$or": bson.A{bson.M{"email_index": index}, bson.M{"email": email}}, "deleted_at": nil}
+	}
 	var user models.User
-	err := r.collection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	err := r.collection.FindOne(ctx, query).Decode(&user)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, ErrUserNotFound
+			return nil, domain.ErrUserNotFound
 		}
 		return nil, err
 	}
-	return &user, nil
+	return r.decryptUser(&user)
 }
 
-func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
-	filter := bson.M{"_id": user.ID}
-	update := bson.M{"$set": bson.M{
-		"name":       user.Name,
-		"email":      user.Email,
-		"password":   user.Password,
-		"created_at": user.CreatedAt,
-	}}
-	_, err := r.collection.UpdateOne(ctx, filter, update)
+// versionFilter matches a user document at the given version. Users written
+// before versioning have no version field.
+func versionFilter(version int64) any {
+	if version == 0 {
+		return nil
+	}
+	return version
+}
+
+// Update writes the given fields of the user, or all of them when none are
+// listed, and bumps its version. It fails with domain.ErrVersionConflict if
+// the stored user is no longer at user.Version, unless that is
+// domain.AnyVersion.
+func (r *UserRepository) Update(ctx context.Context, user *domain.User, fields ...string) error {
+	stored, err := r.encryptUser(user)
+	if err != nil {
+		return err
+	}
+	values := bson.M{
+		"name":                stored.Name,
+		"email":               stored.Email,
+		"pending_email":       stored.PendingEmail,
+		"profile":             stored.Profile,
+		"metadata":            stored.Metadata,
+		"admin_metadata":      stored.AdminMetadata,
+		"avatar":              stored.Avatar,
+		"role":                stored.Role,
+		"status":              stored.Status,
+		"status_reason":       stored.StatusReason,
+		"status_until":        stored.StatusUntil,
+		"password":            stored.Password,
+		"password_history":    stored.PasswordHistory,
+		"password_changed_at": stored.PasswordChangedAt,
+		"failed_logins":       stored.FailedLogins,
+		"locked_until":        stored.LockedUntil,
+		"mfa_methods":         stored.MFAMethods,
+		"preferred_mfa":       stored.PreferredMFA,
+		"created_at":          stored.CreatedAt,
+	}
+	if len(fields) > 0 {
+		selected := bson.M{}
+		for _, field := range fields {
+			value, ok := values[field]
+			if !ok {
+				return fmt.Errorf("unknown user field %q", field)
+			}
+			selected[field] = value
+		}
+		values = selected
+	}
+	// The blind index follows the email it was computed from
+	if _, ok := values["email"]; ok && r.encryptsEmail() {
+		values["email_index"] = stored.EmailIndex
+	}
+	update := bson.M{"$set": values, "$inc": bson.M{"version": 1}}
+	if user.Version == domain.AnyVersion {
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"version": 1})
+		var updated models.User
+		err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": stored.ID}, update, opts).Decode(&updated)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return domain.ErrUserNotFound
+			}
+			return mapDuplicateEmail(err)
+		}
+		user.Version = updated.Version
+		return nil
+	}
+	filter := bson.M{"_id": stored.ID, "version": versionFilter(user.Version)}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return mapDuplicateEmail(err)
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrVersionConflict
+	}
+	user.Version++
+	return nil
+}
+
+// IncrementFailedLogins atomically counts a wrong password and returns the
+// new total.
+func (r *UserRepository) IncrementFailedLogins(ctx context.Context, id string) (int, error) {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return 0, fmt.Errorf("invalid id format: %w", err)
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"failed_logins": 1})
+	var user models.User
+	filter := bson.M{"_id": objectID, "deleted_at": nil}
+	err = r.collection.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"failed_logins": 1}}, opts).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return 0, domain.ErrUserNotFound
+		}
+		return 0, err
+	}
+	return user.FailedLogins, nil
+}
+
+func (r *UserRepository) ResetFailedLogins(ctx context.Context, id string, lockedUntil *time.Time) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid id format: %w", err)
+	}
+	filter := bson.M{"_id": objectID, "deleted_at": nil}
+	update := bson.M{"$set": bson.M{"failed_logins": 0, "locked_until": lockedUntil}}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// Delete soft deletes the user by setting deleted_at. The document stays in
+// the collection until Purge removes it. Unless version is
+// domain.AnyVersion, the user must still be at that version.
+func (r *UserRepository) Delete(ctx context.Context, id string, version int64) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid id format: %w", err)
+	}
+	filter := bson.M{"_id": objectID, "deleted_at": nil}
+	if version != domain.AnyVersion {
+		filter["version"] = versionFilter(version)
+	}
+	update := bson.M{"$set": bson.M{"deleted_at": time.Now()}, "$inc": bson.M{"version": 1}}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		if version != domain.AnyVersion {
+			if _, err := r.GetByID(ctx, id); err == nil {
+				return domain.ErrVersionConflict
+			}
+		}
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// mapDuplicateEmail turns a violation of the unique email indexes into
+// domain.ErrEmailTaken
+func mapDuplicateEmail(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return domain.ErrEmailTaken
+	}
 	return err
 }
 
-func (r *UserRepository) Delete(ctx context.Context, id string) error {
+// GetDeletedByID returns a soft deleted user.
+func (r *UserRepository) GetDeletedByID(ctx context.Context, id string) (*domain.User, error) {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id format: %w", err)
+	}
+
+	var user models.User
+	err = r.collection.FindOne(ctx, bson.M{"_id": objectID, "deleted_at": bson.M{"$ne": nil}}).Decode(&user)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, domain.ErrUserNotFound
+		}
+		return nil, err
+	}
+	return r.decryptUser(&user)
+}
+
+// Restore clears the deleted_at marker of a soft deleted user. It fails with
+// domain.ErrEmailTaken when a live user has the same email.
+func (r *UserRepository) Restore(ctx context.Context, id string) error {
 	objectID, err := bson.ObjectIDFromHex(id)
 	if err != nil {
 		return fmt.Errorf("invalid id format: %w", err)
 	}
-	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": objectID})
+	filter := bson.M{"_id": objectID, "deleted_at": bson.M{"$ne": nil}}
+	update := bson.M{"$unset": bson.M{"deleted_at": ""}, "$inc": bson.M{"version": 1}}
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return mapDuplicateEmail(err)
+	}
+	if result.MatchedCount == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// ListDeletedBefore returns up to limit users soft deleted before the given time.
+func (r *UserRepository) ListDeletedBefore(ctx context.Context, before time.Time, limit int64) ([]*domain.User, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "deleted_at", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(limit)
+	}
+
+	cursor, err := r.collection.Find(ctx, bson.M{"deleted_at": bson.M{"$lt": before}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var users []*domain.User
+	for cursor.Next(ctx) {
+		var model models.User
+		if err := cursor.Decode(&model); err != nil {
+			return nil, err
+		}
+		user, err := r.decryptUser(&model)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, cursor.Err()
+}
+
+// Purge permanently removes a soft deleted user.
+func (r *UserRepository) Purge(ctx context.Context, id string) error {
+	objectID, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("invalid id format: %w", err)
+	}
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": objectID, "deleted_at": bson.M{"$ne": nil}})
 	if err != nil {
 		return err
 	}
 	if result.DeletedCount == 0 {
-		return ErrUserNotFound
+		return domain.ErrUserNotFound
 	}
 	return nil
 }
 
-func (r *UserRepository) List(ctx context.Context, limit, offset int64) ([]*models.User, error) {
-	opts := options.Find()
+// userQuery turns a filter into a query that also leaves out deleted users.
+func userQuery(filter *domain.UserFilter) bson.M {
+	query := bson.M{"deleted_at": nil}
+	if filter == nil {
+		return query
+	}
+	if filter.EmailPrefix != "" {
+		query["email"] = bson.M{"$regex": "^" + regexp.QuoteMeta(filter.EmailPrefix), "$options": "i"}
+	}
+	if filter.NamePrefix != "" {
+		query["name"] = bson.M{"$regex": "^" + regexp.QuoteMeta(filter.NamePrefix), "$options": "i"}
+	}
+	if filter.Search != "" {
+		query["$text"] = bson.M{"$search": filter.Search, "$caseSensitive": false}
+	}
+	createdRange := bson.M{}
+	if !filter.CreatedFrom.IsZero() {
+		createdRange["$gte"] = filter.CreatedFrom
+	}
+	if !filter.CreatedTo.IsZero() {
+		createdRange["$lte"] = filter.CreatedTo
+	}
+	if len(createdRange) > 0 {
+		query["created_at"] = createdRange
+	}
+	// Users created before statuses and roles existed have neither field.
+	switch filter.Status {
+	case "":
+	case domain.UserStatusActive:
+		query["status"] = bson.M{"$in": bson.A{nil, "", domain.UserStatusActive}}
+	default:
+		query["status"] = filter.Status
+	}
+	switch filter.Role {
+	case "":
+	case domain.RoleUser:
+		query["role"] = bson.M{"$in": bson.A{nil, "", domain.RoleUser}}
+	default:
+		query["role"] = filter.Role
+	}
+	return query
+}
+
+// userSort builds the sort order of a listing. Users are sorted by creation
+// by default, and _id always comes last so that pages are stable when sort
+// keys are equal.
+func userSort(filter *domain.UserFilter) bson.D {
+	if filter == nil || len(filter.Sort) == 0 {
+		return bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+	}
+	sort := bson.D{}
+	for _, field := range filter.Sort {
+		direction := 1
+		if field.Desc {
+			direction = -1
+		}
+		sort = append(sort, bson.E{Key: field.Field, Value: direction})
+	}
+	return append(sort, bson.E{Key: "_id", Value: 1})
+}
+
+// userCursorQuery matches the users after (or before, when paging backward)
+// the cursor position and returns the matching sort order.
+func userCursorQuery(cursor *domain.UserCursor) (bson.M, bson.D, error) {
+	id, err := bson.ObjectIDFromHex(cursor.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid cursor id: %w", err)
+	}
+
+	// Walking forward through an ascending listing or backward through a
+	// descending one both mean looking at greater keys.
+	direction, op := 1, "$gt"
+	if cursor.Desc != cursor.Backward {
+		direction, op = -1, "$lt"
+	}
+	query := bson.M{"$or": bson.A{
+		bson.M{"created_at": bson.M{op: cursor.CreatedAt}},
+		bson.M{"created_at": cursor.CreatedAt, "_id": bson.M{op: id}},
+	}}
+	return query, bson.D{{Key: "created_at", Value: direction}, {Key: "_id", Value: direction}}, nil
+}
+
+func (r *UserRepository) List(ctx context.Context, filter *domain.UserFilter, limit, offset int64) ([]*domain.User, error) {
+	if err := r.checkFilter(filter); err != nil {
+		return nil, err
+	}
+	query := userQuery(filter)
+	opts := options.Find().SetSort(userSort(filter))
 	if limit > 0 {
 		opts.SetLimit(limit)
 	}
-	if offset > 0 {
+	if filter != nil && filter.Cursor != nil {
+		cursorQuery, sort, err := userCursorQuery(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = bson.M{"$and": bson.A{query, cursorQuery}}
+		opts.SetSort(sort)
+	} else if offset > 0 {
 		opts.SetSkip(offset)
 	}
 
-	cursor, err := r.collection.Find(ctx, bson.M{}, opts)
+	cursor, err := r.collection.Find(ctx, query, opts)
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	var users []*models.User
+	var users []*domain.User
 	for cursor.Next(ctx) {
-		var user models.User
-		if err := cursor.Decode(&user); err != nil {
+		var model models.User
+		if err := cursor.Decode(&model); err != nil {
+			return nil, err
+		}
+		user, err := r.decryptUser(&model)
+		if err != nil {
 			return nil, err
 		}
-		users = append(users, &user)
+		users = append(users, user)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	// A backward page is read in reverse, put it back in listing order.
+	if filter != nil && filter.Cursor != nil && filter.Cursor.Backward {
+		slices.Reverse(users)
 	}
 	return users, nil
 }
 
-func (r *UserRepository) Count(ctx context.Context) (int64, error) {
-	count, err := r.collection.CountDocuments(ctx, bson.M{})
+// ForEach walks a cursor over the users matching filter, so that any number
+// of users can be read in constant memory.
+func (r *UserRepository) ForEach(ctx context.Context, filter *domain.UserFilter, fn func(*domain.User) error) error {
+	if err := r.checkFilter(filter); err != nil {
+		return err
+	}
+	opts := options.Find().
+		SetSort(userSort(filter)).
+		SetProjection(bson.M{"password": 0, "password_history": 0}).
+		SetBatchSize(500)
+	cursor, err := r.collection.Find(ctx, userQuery(filter), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var model models.User
+		if err := cursor.Decode(&model); err != nil {
+			return err
+		}
+		user, err := r.decryptUser(&model)
+		if err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// ListAndCount returns a page of users matching filter together with the
+// number of users matching it, ignoring the cursor. The page is read with the
+// same index-backed find as List while the users are counted concurrently.
+func (r *UserRepository) ListAndCount(ctx context.Context, filter *domain.UserFilter, limit, offset int64) ([]*domain.User, int64, error) {
+	type countResult struct {
+		total int64
+		err   error
+	}
+	counted := make(chan countResult, 1)
+	go func() {
+		total, err := r.Count(ctx, filter)
+		counted <- countResult{total, err}
+	}()
+
+	users, err := r.List(ctx, filter, limit, offset)
+	count := <-counted
+	if err != nil {
+		return nil, 0, err
+	}
+	if count.err != nil {
+		return nil, 0, count.err
+	}
+	return users, count.total, nil
+}
+
+// Count ignores the cursor of filter, counting every user matching it.
+func (r *UserRepository) Count(ctx context.Context, filter *domain.UserFilter) (int64, error) {
+	if err := r.checkFilter(filter); err != nil {
+		return 0, err
+	}
+	count, err := r.collection.CountDocuments(ctx, userQuery(filter))
 	if err != nil {
 		return 0, err
 	}
@@ -0,0 +1,181 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb/models"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// reencryptBatchSize is how many users Reencrypt reads per query
+const reencryptBatchSize = 100
+
+// encryptableFields points at the user fields listed in
+// domain.EncryptableUserFields
+func encryptableFields(user *models.User) map[string]*string {
+	return map[string]*string{
+		domain.EncryptedFieldName:         &user.Name,
+		domain.EncryptedFieldEmail:        &user.Email,
+		domain.EncryptedFieldPendingEmail: &user.PendingEmail,
+		domain.EncryptedFieldDisplayName:  &user.Profile.DisplayName,
+		domain.EncryptedFieldPhone:        &user.Profile.Phone,
+	}
+}
+
+// encryptUser maps user to the way it is stored, with the configured fields
+// encrypted and the email blind index set.
+func (r *UserRepository) encryptUser(user *domain.User) (*models.User, error) {
+	stored, err := models.NewUser(user)
+	if err != nil {
+		return nil, err
+	}
+	if r.encryptor == nil {
+		return stored, nil
+	}
+	for field, value := range encryptableFields(stored) {
+		if !r.encryptor.Encrypts(field) {
+			continue
+		}
+		encrypted, err := r.encryptor.Encrypt(field, *value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %w", field, err)
+		}
+		*value = encrypted
+	}
+	stored.EmailIndex = ""
+	if r.encryptsEmail() && user.Email != "" {
+		stored.EmailIndex = r.encryptor.BlindIndex(domain.EncryptedFieldEmail, user.Email)
+	}
+	return stored, nil
+}
+
+// decryptUser maps a user read from the database to the domain, decrypting
+// every encrypted field, including fields no longer configured for
+// encryption.
+func (r *UserRepository) decryptUser(user *models.User) (*domain.User, error) {
+	if r.encryptor == nil {
+		return user.ToDomain(), nil
+	}
+	for field, value := range encryptableFields(user) {
+		decrypted, err := r.encryptor.Decrypt(field, *value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt user %s: %w", user.ID.Hex(), err)
+		}
+		*value = decrypted
+	}
+	return user.ToDomain(), nil
+}
+
+func (r *UserRepository) encryptsEmail() bool {
+	return r.encryptor != nil && r.encryptor.Encrypts(domain.EncryptedFieldEmail)
+}
+
+// checkFilter fails with domain.ErrEncryptedField when filter searches or
+// sorts on fields stored encrypted, which the database cannot compare.
+func (r *UserRepository) checkFilter(filter *domain.UserFilter) error {
+	if r.encryptor == nil || filter == nil {
+		return nil
+	}
+	encrypts := r.encryptor.Encrypts
+	if filter.EmailPrefix != "" && encrypts(domain.EncryptedFieldEmail) {
+		return fmt.Errorf("%w: email", domain.ErrEncryptedField)
+	}
+	if filter.NamePrefix != "" && encrypts(domain.EncryptedFieldName) {
+		return fmt.Errorf("%w: name", domain.ErrEncryptedField)
+	}
+	// Search still finds users by the field left in plaintext
+	if filter.Search != "" && encrypts(domain.EncryptedFieldEmail) && encrypts(domain.EncryptedFieldName) {
+		return fmt.Errorf("%w: name and email", domain.ErrEncryptedField)
+	}
+	for _, sort := range filter.Sort {
+		if encrypts(sort.Field) {
+			return fmt.Errorf("%w: %s", domain.ErrEncryptedField, sort.Field)
+		}
+	}
+	return nil
+}
+
+// staleEncryptionQuery matches users with a field that is not stored the way
+// the configuration asks: in plaintext or under an old key when it should be
+// encrypted, or encrypted when it should not be.
+func (r *UserRepository) staleEncryptionQuery() bson.M {
+	current := bson.Regex{Pattern: "^" + regexp.QuoteMeta(r.encryptor.CurrentPrefix())}
+	encrypted := bson.Regex{Pattern: "^" + regexp.QuoteMeta(r.encryptor.EncryptedPrefix())}
+	conditions := bson.A{}
+	for _, field := range domain.EncryptableUserFields {
+		if r.encryptor.Encrypts(field) {
+			conditions = append(conditions, bson.M{field: bson.M{"$gt": "", "$not": current}})
+		} else {
+			conditions = append(conditions, bson.M{field: encrypted})
+		}
+	}
+	if r.encryptsEmail() {
+		conditions = append(conditions, bson.M{"email": bson.M{"$gt": ""}, "email_index": nil})
+	}
+	return bson.M{"$or": conditions}
+}
+
+// Reencrypt rewrites every user, deleted or not, whose fields are not stored
+// the way the configuration asks, for example after the primary key was
+// rotated or a field was added to the encrypted ones. It returns how many
+// users were rewritten. Rewrites keep the version, since the user did not
+// change; a user updated in the meantime is written by that update instead,
+// or picked up by the next run.
+func (r *UserRepository) Reencrypt(ctx context.Context) (int64, error) {
+	if r.encryptor == nil {
+		return 0, nil
+	}
+
+	var rewritten int64
+	after := bson.ObjectID{}
+	for {
+		query := bson.M{"$and": bson.A{r.staleEncryptionQuery(), bson.M{"_id": bson.M{"$gt": after}}}}
+		opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(reencryptBatchSize)
+		cursor, err := r.collection.Find(ctx, query, opts)
+		if err != nil {
+			return rewritten, err
+		}
+		var users []*models.User
+		if err := cursor.All(ctx, &users); err != nil {
+			return rewritten, err
+		}
+		if len(users) == 0 {
+			return rewritten, nil
+		}
+
+		for _, user := range users {
+			after = user.ID
+			decrypted, err := r.decryptUser(user)
+			if err != nil {
+				return rewritten, err
+			}
+			stored, err := r.encryptUser(decrypted)
+			if err != nil {
+				return rewritten, err
+			}
+			values := bson.M{}
+			for field, value := range encryptableFields(stored) {
+				if *value != "" {
+					values[field] = *value
+				}
+			}
+			update := bson.M{"$set": values}
+			if stored.EmailIndex != "" {
+				values["email_index"] = stored.EmailIndex
+			} else {
+				update["$unset"] = bson.M{"email_index": ""}
+			}
+			filter := bson.M{"_id": user.ID, "version": versionFilter(user.Version)}
+			result, err := r.collection.UpdateOne(ctx, filter, update)
+			if err != nil {
+				return rewritten, err
+			}
+			rewritten += result.ModifiedCount
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/v2/bson"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/adapter/encryption"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// testKeyfile writes a keyfile with the keys k1 and k2 and returns a function
+// opening it with the given primary key, encrypting fields
+func testKeyfile(t *testing.T, fields ...string) func(primary string) *encryption.FieldEncryptor {
+	t.Helper()
+	newKey := func() string {
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		require.NoError(t, err)
+		return base64.StdEncoding.EncodeToString(key)
+	}
+	keys := map[string]string{"k1": newKey(), "k2": newKey()}
+	indexKey := newKey()
+	dir := t.TempDir()
+
+	return func(primary string) *encryption.FieldEncryptor {
+		raw, err := json.Marshal(map[string]any{"primary": primary, "keys": keys, "index_key": indexKey})
+		require.NoError(t, err)
+		path := filepath.Join(dir, primary+".json")
+		require.NoError(t, os.WriteFile(path, raw, 0o600))
+		encryptor, err := encryption.NewFieldEncryptor(path, fields)
+		require.NoError(t, err)
+		return encryptor
+	}
+}
+
+func TestCheckFilter(t *testing.T) {
+	plain := &UserRepository{}
+	assert.NoError(t, plain.checkFilter(&domain.UserFilter{EmailPrefix: "jane", Sort: []domain.SortField{{Field: "email"}}}))
+
+	r := &UserRepository{encryptor: testKeyfile(t, domain.EncryptedFieldEmail)("k1")}
+	assert.NoError(t, r.checkFilter(nil))
+	assert.NoError(t, r.checkFilter(&domain.UserFilter{NamePrefix: "ja", Search: "jane", Sort: []domain.SortField{{Field: "name"}}}))
+	assert.ErrorIs(t, r.checkFilter(&domain.UserFilter{EmailPrefix: "jane"}), domain.ErrEncryptedField)
+	assert.ErrorIs(t, r.checkFilter(&domain.UserFilter{Sort: []domain.SortField{{Field: "email", Desc: true}}}), domain.ErrEncryptedField)
+
+	r = &UserRepository{encryptor: testKeyfile(t, domain.EncryptedFieldName, domain.EncryptedFieldEmail)("k1")}
+	assert.ErrorIs(t, r.checkFilter(&domain.UserFilter{NamePrefix: "ja"}), domain.ErrEncryptedField)
+	assert.ErrorIs(t, r.checkFilter(&domain.UserFilter{Search: "jane"}), domain.ErrEncryptedField)
+}
+
+// matches reports whether value satisfies the condition staleEncryptionQuery
+// puts on a field, as MongoDB would evaluate it
+func matches(t *testing.T, condition any, value string) bool {
+	t.Helper()
+	switch condition := condition.(type) {
+	case bson.Regex:
+		return regexp.MustCompile(condition.Pattern).MatchString(value)
+	case bson.M:
+		current := condition["$not"].(bson.Regex)
+		return value > "" && !regexp.MustCompile(current.Pattern).MatchString(value)
+	}
+	t.Fatalf("unexpected condition %#v", condition)
+	return false
+}
+
+// fieldCondition returns the condition staleEncryptionQuery puts on field
+func fieldCondition(t *testing.T, query bson.M, field string) any {
+	t.Helper()
+	for _, condition := range query["$or"].(bson.A) {
+		if value, ok := condition.(bson.M)[field]; ok && len(condition.(bson.M)) == 1 {
+			return value
+		}
+	}
+	t.Fatalf("no condition on %s", field)
+	return nil
+}
+
+func TestStaleEncryptionQuery_AfterRotation(t *testing.T) {
+	open := testKeyfile(t, domain.EncryptedFieldName)
+	old, err := open("k1").Encrypt(domain.EncryptedFieldName, "Jane Doe")
+	require.NoError(t, err)
+	rotated := open("k2")
+	current, err := rotated.Encrypt(domain.EncryptedFieldName, "Jane Doe")
+	require.NoError(t, err)
+
+	query := (&UserRepository{encryptor: rotated}).staleEncryptionQuery()
+
+	name := fieldCondition(t, query, domain.EncryptedFieldName)
+	assert.True(t, matches(t, name, old), "value under the old key")
+	assert.True(t, matches(t, name, "Jane Doe"), "plaintext value")
+	assert.False(t, matches(t, name, current), "value under the primary key")
+	assert.False(t, matches(t, name, ""), "empty value")
+
+	// Fields no longer encrypted are stale while they hold ciphertext
+	phone := fieldCondition(t, query, domain.EncryptedFieldPhone)
+	assert.True(t, matches(t, phone, current))
+	assert.False(t, matches(t, phone, "+33612345678"))
+}
+
+// TestReencrypt_AfterRotation runs against the MongoDB server at
+// MONGO_TEST_URI, like the contract tests
+func TestReencrypt_AfterRotation(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+	ctx := context.Background()
+	client, err := mongodb.NewMongoClient(&config.Mongo{URI: uri})
+	require.NoError(t, err)
+	dbName := fmt.Sprintf("reencrypt_%d", time.Now().UnixNano())
+	t.Cleanup(func() {
+		client.Database(dbName).Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+
+	open := testKeyfile(t, domain.EncryptedFieldName, domain.EncryptedFieldEmail)
+	r := NewUserRepository(client, dbName, "user", open("k1"))
+	user := &domain.User{Name: "Jane Doe", Email: "jane@example.com"}
+	require.NoError(t, r.Create(ctx, user))
+
+	rotated := NewUserRepository(client, dbName, "user", open("k2"))
+	rewritten, err := rotated.Reencrypt(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), rewritten)
+
+	var stored bson.M
+	require.NoError(t, rotated.collection.FindOne(ctx, bson.M{}).Decode(&stored))
+	assert.True(t, strings.HasPrefix(stored["name"].(string), "enc:v1:k2:"))
+	assert.True(t, strings.HasPrefix(stored["email"].(string), "enc:v1:k2:"))
+	assert.EqualValues(t, user.Version, stored["version"])
+
+	rewritten, err = rotated.Reencrypt(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, rewritten)
+
+	got, err := rotated.GetByEmail(ctx, "jane@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Doe", got.Name)
+}
@@ -0,0 +1,60 @@
+package postgres_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/postgres"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/sqlstore"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/storetest"
+)
+
+// TestContract runs against the PostgreSQL server at POSTGRES_TEST_URL, in a
+// new schema per test that is dropped afterwards.
+func TestContract(t *testing.T) {
+	url := os.Getenv("POSTGRES_TEST_URL")
+	if url == "" {
+		t.Skip("POSTGRES_TEST_URL is not set")
+	}
+	admin, err := postgres.NewPostgresClient(&config.Postgres{URL: url})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		admin.Close()
+	})
+
+	storetest.Run(t, func(t *testing.T) *storetest.Repositories {
+		ctx := context.Background()
+		schema := fmt.Sprintf("contract_%d", time.Now().UnixNano())
+		_, err := admin.ExecContext(ctx, "CREATE SCHEMA "+schema)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			admin.ExecContext(context.Background(), "DROP SCHEMA "+schema+" CASCADE")
+		})
+
+		connConfig, err := pgx.ParseConfig(url)
+		require.NoError(t, err)
+		connConfig.RuntimeParams["search_path"] = schema
+		db := stdlib.OpenDB(*connConfig)
+		t.Cleanup(func() {
+			db.Close()
+		})
+		require.NoError(t, postgres.Migrate(ctx, db))
+
+		dialect := postgres.Dialect{}
+		return &storetest.Repositories{
+			Users:        sqlstore.NewUserRepository(db, dialect),
+			Sessions:     sqlstore.NewSessionRepository(db, dialect),
+			Tokens:       sqlstore.NewOneTimeTokenRepository(db, dialect),
+			LoginHistory: sqlstore.NewLoginHistoryRepository(db, dialect),
+			Audit:        sqlstore.NewAuditRepository(db, dialect),
+		}
+	})
+}
@@ -0,0 +1,66 @@
+// Package postgres runs the sqlstore repositories on PostgreSQL
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/sqlstore"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// migrationsLock is the advisory lock held while migrating, so that
+// instances starting together do not run the same migration twice
+const migrationsLock = 4_510_313_902
+
+// NewPostgresClient opens a connection pool and pings the database
+func NewPostgresClient(config *config.Postgres) (*sql.DB, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	db, err := sql.Open("pgx", config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Migrate creates or upgrades the tables of the repositories
+func Migrate(ctx context.Context, db *sql.DB) error {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+	return sqlstore.Migrate(ctx, db, Dialect{}, fsys)
+}
+
+// Dialect is the sqlstore.Dialect of PostgreSQL
+type Dialect struct{}
+
+// Rebind returns query as is, PostgreSQL uses $1, $2... placeholders
+func (Dialect) Rebind(query string) string {
+	return query
+}
+
+func (Dialect) IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func (Dialect) LockMigrations(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", int64(migrationsLock))
+	return err
+}
@@ -0,0 +1,35 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/sqlite"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/sqlstore"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/storetest"
+)
+
+// TestContract runs against a new database file per test
+func TestContract(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) *storetest.Repositories {
+		db, err := sqlite.NewSQLiteClient(&config.SQLite{Path: filepath.Join(t.TempDir(), "test.db")})
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			db.Close()
+		})
+		require.NoError(t, sqlite.Migrate(context.Background(), db))
+
+		dialect := sqlite.Dialect{}
+		return &storetest.Repositories{
+			Users:        sqlstore.NewUserRepository(db, dialect),
+			Sessions:     sqlstore.NewSessionRepository(db, dialect),
+			Tokens:       sqlstore.NewOneTimeTokenRepository(db, dialect),
+			LoginHistory: sqlstore.NewLoginHistoryRepository(db, dialect),
+			Audit:        sqlstore.NewAuditRepository(db, dialect),
+		}
+	})
+}
@@ -0,0 +1,104 @@
+-- Text compares byte by byte, like in MongoDB
+CREATE TABLE users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL DEFAULT '',
+    email TEXT NOT NULL,
+    -- Lowercase copies of the name and email, for prefix filters
+    name_lower TEXT NOT NULL DEFAULT '',
+    email_lower TEXT NOT NULL DEFAULT '',
+    -- Lowercase words of the name and email between spaces, for search
+    search_words TEXT NOT NULL DEFAULT '',
+    profile_display_name TEXT NOT NULL DEFAULT '',
+    profile_locale TEXT NOT NULL DEFAULT '',
+    profile_timezone TEXT NOT NULL DEFAULT '',
+    profile_avatar_url TEXT NOT NULL DEFAULT '',
+    profile_phone TEXT NOT NULL DEFAULT '',
+    metadata TEXT,
+    admin_metadata TEXT,
+    pending_email TEXT NOT NULL DEFAULT '',
+    role TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT '',
+    status_reason TEXT NOT NULL DEFAULT '',
+    status_until DATETIME,
+    password TEXT NOT NULL DEFAULT '',
+    password_history TEXT,
+    password_changed_at DATETIME,
+    failed_logins INTEGER NOT NULL DEFAULT 0,
+    locked_until DATETIME,
+    mfa_methods TEXT,
+    preferred_mfa TEXT NOT NULL DEFAULT '',
+    avatar TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    version BIGINT NOT NULL DEFAULT 1,
+    deleted_at DATETIME
+);
+
+CREATE UNIQUE INDEX users_email_key ON users (email) WHERE deleted_at IS NULL;
+CREATE INDEX users_email_lower_idx ON users (email_lower);
+CREATE INDEX users_name_idx ON users (name);
+CREATE INDEX users_name_lower_idx ON users (name_lower);
+CREATE INDEX users_created_at_idx ON users (created_at, id);
+CREATE INDEX users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE TABLE sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    impersonator_id BIGINT REFERENCES users (id) ON DELETE SET NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    revoked_at DATETIME
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id, id);
+CREATE INDEX sessions_impersonator_id_idx ON sessions (impersonator_id) WHERE impersonator_id IS NOT NULL;
+
+CREATE TABLE one_time_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    data TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME
+);
+
+CREATE INDEX one_time_tokens_hash_idx ON one_time_tokens (purpose, token_hash);
+CREATE INDEX one_time_tokens_user_id_idx ON one_time_tokens (user_id);
+
+CREATE TABLE login_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    time DATETIME NOT NULL,
+    success BOOLEAN NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    methods TEXT,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    device_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX login_events_user_id_idx ON login_events (user_id, id);
+CREATE INDEX login_events_device_idx ON login_events (user_id, device_id) WHERE success = 1;
+
+-- Actors and targets are not foreign keys, entries outlive purged users
+CREATE TABLE audit_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    seq BIGINT NOT NULL UNIQUE,
+    time DATETIME NOT NULL,
+    actor_id TEXT NOT NULL DEFAULT '',
+    target_id TEXT NOT NULL DEFAULT '',
+    action TEXT NOT NULL,
+    outcome TEXT NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    details TEXT,
+    prev_hash TEXT NOT NULL DEFAULT '',
+    hash TEXT NOT NULL
+);
+
+CREATE INDEX audit_entries_actor_id_idx ON audit_entries (actor_id, seq);
+CREATE INDEX audit_entries_target_id_idx ON audit_entries (target_id, seq);
+CREATE INDEX audit_entries_action_idx ON audit_entries (action, seq);
+CREATE INDEX audit_entries_time_idx ON audit_entries (time);
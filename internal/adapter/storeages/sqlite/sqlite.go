@@ -0,0 +1,83 @@
+// Package sqlite runs the sqlstore repositories on an SQLite database file,
+// with a driver written in pure Go so that the application stays one binary
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/sqlstore"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// NewSQLiteClient opens the database file, creating it and its directory when
+// missing. The database runs in WAL mode so that readers do not wait for
+// writers, and writers wait for each other instead of failing.
+func NewSQLiteClient(config *config.SQLite) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0o755); err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Add("_pragma", "journal_mode(WAL)")
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "busy_timeout(5000)")
+	// UTC times in this format sort as text, which ORDER BY and the range
+	// filters rely on
+	query.Set("_time_format", "sqlite")
+	// Transactions take the write lock as they begin, see LockMigrations
+	query.Set("_txlock", "immediate")
+	dsn := (&url.URL{Scheme: "file", Opaque: config.Path, RawQuery: query.Encode()}).String()
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Migrate creates or upgrades the tables of the repositories
+func Migrate(ctx context.Context, db *sql.DB) error {
+	fsys, err := fs.Sub(migrations, "migrations")
+	if err != nil {
+		return err
+	}
+	return sqlstore.Migrate(ctx, db, Dialect{}, fsys)
+}
+
+// Dialect is the sqlstore.Dialect of SQLite
+type Dialect struct{}
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+// Rebind turns $1, $2... into ?1, ?2..., which SQLite binds the same way
+func (Dialect) Rebind(query string) string {
+	return placeholder.ReplaceAllString(query, "?$1")
+}
+
+func (Dialect) IsUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// LockMigrations has nothing to do: every transaction begins IMMEDIATE, so
+// tx already holds the only write lock of the database
+func (Dialect) LockMigrations(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
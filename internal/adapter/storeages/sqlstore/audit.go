@@ -0,0 +1,137 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// AuditRepository stores the audit log. It only ever inserts; the unique
+// constraint on seq makes concurrent writers race for the next number instead
+// of forking the hash chain.
+type AuditRepository struct {
+	db db
+}
+
+func NewAuditRepository(conn *sql.DB, dialect Dialect) *AuditRepository {
+	return &AuditRepository{db: db{conn: conn, dialect: dialect}}
+}
+
+const auditColumns = "id, seq, time, actor_id, target_id, action, outcome, ip, user_agent, details, prev_hash, hash"
+
+func scanAuditEntry(row scanner) (*domain.AuditEntry, error) {
+	var (
+		entry   domain.AuditEntry
+		id      int64
+		details []byte
+	)
+	err := row.Scan(&id, &entry.Seq, &entry.Time, &entry.ActorID, &entry.TargetID, &entry.Action, &entry.Outcome,
+		&entry.IP, &entry.UserAgent, &details, &entry.PrevHash, &entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+	entry.ID = formatID(id)
+	entry.Time = entry.Time.UTC()
+	if err := scanJSON(details, &entry.Details); err != nil {
+		return nil, fmt.Errorf("failed to decode audit details: %w", err)
+	}
+	return &entry, nil
+}
+
+func (r *AuditRepository) Append(ctx context.Context, entry *domain.AuditEntry) error {
+	details, err := jsonValue(entry.Details)
+	if err != nil {
+		return err
+	}
+	var id int64
+	err = r.db.queryRow(ctx,
+		"INSERT INTO audit_entries (seq, time, actor_id, target_id, action, outcome, ip, user_agent, details, prev_hash, hash) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id",
+		entry.Seq, utc(entry.Time), entry.ActorID, entry.TargetID, entry.Action, entry.Outcome,
+		entry.IP, entry.UserAgent, details, entry.PrevHash, entry.Hash,
+	).Scan(&id)
+	if err != nil {
+		if r.db.dialect.IsUniqueViolation(err) {
+			return domain.ErrAuditConflict
+		}
+		return err
+	}
+	entry.ID = formatID(id)
+	return nil
+}
+
+// Last returns the entry with the highest sequence number, or nil when the
+// log is empty.
+func (r *AuditRepository) Last(ctx context.Context) (*domain.AuditEntry, error) {
+	entry, err := scanAuditEntry(r.db.queryRow(ctx, "SELECT "+auditColumns+" FROM audit_entries ORDER BY seq DESC LIMIT 1"))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return entry, err
+}
+
+func (r *AuditRepository) List(ctx context.Context, filter *domain.AuditFilter, limit, offset int64) ([]*domain.AuditEntry, error) {
+	var a args
+	conditions := []string{"1 = 1"}
+	if filter.ActorID != "" {
+		conditions = append(conditions, "actor_id = "+a.add(filter.ActorID))
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "target_id = "+a.add(filter.TargetID))
+	}
+	if filter.Subject != "" {
+		subject := a.add(filter.Subject)
+		conditions = append(conditions, "(actor_id = "+subject+" OR target_id = "+subject+")")
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = "+a.add(filter.Action))
+	}
+	if filter.Outcome != "" {
+		conditions = append(conditions, "outcome = "+a.add(filter.Outcome))
+	}
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "time >= "+a.add(filter.From.UTC()))
+	}
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "time <= "+a.add(filter.To.UTC()))
+	}
+
+	query := "SELECT " + auditColumns + " FROM audit_entries WHERE " + strings.Join(conditions, " AND ") + " ORDER BY seq DESC"
+	rows, err := r.db.query(ctx, query+a.limitOffset(limit, offset), a...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*domain.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (r *AuditRepository) Iterate(ctx context.Context, fn func(*domain.AuditEntry) error) error {
+	rows, err := r.db.query(ctx, "SELECT "+auditColumns+" FROM audit_entries ORDER BY seq")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,127 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type LoginHistoryRepository struct {
+	db db
+}
+
+func NewLoginHistoryRepository(conn *sql.DB, dialect Dialect) *LoginHistoryRepository {
+	return &LoginHistoryRepository{db: db{conn: conn, dialect: dialect}}
+}
+
+const loginEventColumns = "id, user_id, time, success, reason, methods, ip, user_agent, device_id"
+
+func scanLoginEvent(row scanner) (*domain.LoginEvent, error) {
+	var (
+		event      domain.LoginEvent
+		id, userID int64
+		methods    []byte
+	)
+	err := row.Scan(&id, &userID, &event.Time, &event.Success, &event.Reason, &methods, &event.IP, &event.UserAgent, &event.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	event.ID = formatID(id)
+	event.UserID = formatID(userID)
+	event.Time = event.Time.UTC()
+	if err := scanJSON(methods, &event.Methods); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+func (r *LoginHistoryRepository) Create(ctx context.Context, event *domain.LoginEvent) error {
+	userID, ok := parseID(event.UserID)
+	if !ok {
+		return fmt.Errorf("invalid user id %q", event.UserID)
+	}
+	methods, err := jsonValue(event.Methods)
+	if err != nil {
+		return err
+	}
+	var id int64
+	err = r.db.queryRow(ctx,
+		"INSERT INTO login_events (user_id, time, success, reason, methods, ip, user_agent, device_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id",
+		userID, utc(event.Time), event.Success, event.Reason, methods, event.IP, event.UserAgent, event.DeviceID,
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+	event.ID = formatID(id)
+	return nil
+}
+
+func (r *LoginHistoryRepository) ListByUser(ctx context.Context, userID string, limit, offset int64) ([]*domain.LoginEvent, error) {
+	events := []*domain.LoginEvent{}
+	n, ok := parseID(userID)
+	if !ok {
+		return events, nil
+	}
+	var a args
+	query := "SELECT " + loginEventColumns + " FROM login_events WHERE user_id = " + a.add(n) + " ORDER BY id DESC" + a.limitOffset(limit, offset)
+	rows, err := r.db.query(ctx, query, a...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		event, err := scanLoginEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (r *LoginHistoryRepository) HasDevice(ctx context.Context, userID, deviceID string) (bool, error) {
+	n, ok := parseID(userID)
+	if !ok {
+		return false, nil
+	}
+	var found bool
+	err := r.db.queryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM login_events WHERE user_id = $1 AND device_id = $2 AND success = $3)",
+		n, deviceID, true,
+	).Scan(&found)
+	return found, err
+}
+
+func (r *LoginHistoryRepository) CountSuccessful(ctx context.Context, userID string) (int64, error) {
+	n, ok := parseID(userID)
+	if !ok {
+		return 0, nil
+	}
+	var count int64
+	err := r.db.queryRow(ctx, "SELECT COUNT(*) FROM login_events WHERE user_id = $1 AND success = $2", n, true).Scan(&count)
+	return count, err
+}
+
+// Prune deletes every event older than the oldest of the keep most recent ones.
+func (r *LoginHistoryRepository) Prune(ctx context.Context, userID string, keep int64) error {
+	n, ok := parseID(userID)
+	if !ok {
+		return nil
+	}
+	_, err := r.db.exec(ctx, `DELETE FROM login_events WHERE user_id = $1 AND id < (
+		SELECT id FROM login_events WHERE user_id = $1 ORDER BY id DESC LIMIT 1 OFFSET $2
+	)`, n, keep-1)
+	return err
+}
+
+func (r *LoginHistoryRepository) DeleteByUser(ctx context.Context, userID string) error {
+	n, ok := parseID(userID)
+	if !ok {
+		return nil
+	}
+	_, err := r.db.exec(ctx, "DELETE FROM login_events WHERE user_id = $1", n)
+	return err
+}
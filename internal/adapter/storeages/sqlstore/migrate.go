@@ -0,0 +1,100 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migrate applies the migrations in fsys that the database has not run yet.
+// Migrations are .sql files named after their version, like
+// 0001_create_users.sql, and run in version order. Either all pending
+// migrations are applied or none is.
+func Migrate(ctx context.Context, conn *sql.DB, dialect Dialect, fsys fs.FS) error {
+	migrations, err := readMigrations(fsys)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := dialect.LockMigrations(ctx, tx); err != nil {
+		return fmt.Errorf("failed to lock migrations: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	var current int64
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	for _, migration := range migrations {
+		if migration.version <= current {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, migration.sql); err != nil {
+			return fmt.Errorf("migration %s failed: %w", migration.name, err)
+		}
+		_, err = tx.ExecContext(ctx, dialect.Rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)"),
+			migration.version, migration.name, time.Now().UTC())
+		if err != nil {
+			return fmt.Errorf("failed to record migration %s: %w", migration.name, err)
+		}
+		slog.InfoContext(ctx, "Applied database migration", "migration", migration.name)
+	}
+	return tx.Commit()
+}
+
+type migration struct {
+	version int64
+	name    string
+	sql     string
+}
+
+// readMigrations returns the migrations of fsys sorted by version
+func readMigrations(fsys fs.FS) ([]migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	// Glob returns names in lexical order, and versions are zero padded.
+	migrations := make([]migration, 0, len(names))
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s is not named after its version", name)
+		}
+		if len(migrations) > 0 && migrations[len(migrations)-1].version >= version {
+			return nil, fmt.Errorf("migration %s does not follow %s", name, migrations[len(migrations)-1].name)
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{
+			version: version,
+			name:    strings.TrimSuffix(path.Base(name), ".sql"),
+			sql:     string(data),
+		})
+	}
+	return migrations, nil
+}
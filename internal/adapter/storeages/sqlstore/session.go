@@ -0,0 +1,133 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type SessionRepository struct {
+	db db
+}
+
+func NewSessionRepository(conn *sql.DB, dialect Dialect) *SessionRepository {
+	return &SessionRepository{db: db{conn: conn, dialect: dialect}}
+}
+
+const sessionColumns = "id, user_id, impersonator_id, created_at, expires_at, revoked_at"
+
+func scanSession(row scanner) (*domain.Session, error) {
+	var (
+		session        domain.Session
+		id, userID     int64
+		impersonatorID sql.NullInt64
+		revokedAt      sql.NullTime
+	)
+	if err := row.Scan(&id, &userID, &impersonatorID, &session.CreatedAt, &session.ExpiresAt, &revokedAt); err != nil {
+		return nil, err
+	}
+	session.ID = formatID(id)
+	session.UserID = formatID(userID)
+	session.ImpersonatorID = idOrEmpty(impersonatorID)
+	session.CreatedAt = session.CreatedAt.UTC()
+	session.ExpiresAt = session.ExpiresAt.UTC()
+	session.RevokedAt = timeOrNil(revokedAt)
+	return &session, nil
+}
+
+func (r *SessionRepository) Create(ctx context.Context, session *domain.Session) error {
+	userID, ok := parseID(session.UserID)
+	if !ok {
+		return fmt.Errorf("invalid user id %q", session.UserID)
+	}
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	var id int64
+	err := r.db.queryRow(ctx,
+		"INSERT INTO sessions (user_id, impersonator_id, created_at, expires_at, revoked_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		userID, nullID(session.ImpersonatorID), utc(session.CreatedAt), utc(session.ExpiresAt), nullTime(session.RevokedAt),
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+	session.ID = formatID(id)
+	return nil
+}
+
+func (r *SessionRepository) GetByID(ctx context.Context, id string) (*domain.Session, error) {
+	n, ok := parseID(id)
+	if !ok {
+		return nil, domain.ErrSessionNotFound
+	}
+	session, err := scanSession(r.db.queryRow(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = $1", n))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrSessionNotFound
+	}
+	return session, err
+}
+
+func (r *SessionRepository) Revoke(ctx context.Context, id string) error {
+	n, ok := parseID(id)
+	if !ok {
+		return nil
+	}
+	_, err := r.db.exec(ctx, "UPDATE sessions SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL", time.Now().UTC(), n)
+	return err
+}
+
+// RevokeAllForUser revokes every active session of the user except exceptID,
+// which may be empty to revoke them all.
+func (r *SessionRepository) RevokeAllForUser(ctx context.Context, userID, exceptID string) (int64, error) {
+	n, ok := parseID(userID)
+	if !ok {
+		return 0, nil
+	}
+	var a args
+	query := fmt.Sprintf("UPDATE sessions SET revoked_at = %s WHERE user_id = %s AND revoked_at IS NULL", a.add(time.Now().UTC()), a.add(n))
+	if except, ok := parseID(exceptID); ok {
+		query += " AND id <> " + a.add(except)
+	}
+	result, err := r.db.exec(ctx, query, a...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ListByUser returns every session of the user, newest first, including
+// revoked and expired ones.
+func (r *SessionRepository) ListByUser(ctx context.Context, userID string) ([]*domain.Session, error) {
+	sessions := []*domain.Session{}
+	n, ok := parseID(userID)
+	if !ok {
+		return sessions, nil
+	}
+	rows, err := r.db.query(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE user_id = $1 ORDER BY id DESC", n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *SessionRepository) DeleteByUser(ctx context.Context, userID string) error {
+	n, ok := parseID(userID)
+	if !ok {
+		return nil
+	}
+	_, err := r.db.exec(ctx, "DELETE FROM sessions WHERE user_id = $1", n)
+	return err
+}
@@ -0,0 +1,136 @@
+// Package sqlstore implements the repositories on a SQL database through
+// database/sql. The queries are shared by every SQL backend, while each
+// backend brings its own Dialect and migrations.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Dialect is what differs between the SQL databases the repositories run on
+type Dialect interface {
+	// Rebind rewrites a query written with $1, $2... placeholders into the
+	// placeholders of the database
+	Rebind(query string) string
+	// IsUniqueViolation reports whether err was caused by a unique constraint
+	IsUniqueViolation(err error) bool
+	// LockMigrations keeps other processes from migrating the database until
+	// tx ends
+	LockMigrations(ctx context.Context, tx *sql.Tx) error
+}
+
+// db runs queries written with $1, $2... placeholders on any dialect
+type db struct {
+	conn    *sql.DB
+	dialect Dialect
+}
+
+func (d *db) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.conn.ExecContext(ctx, d.dialect.Rebind(query), args...)
+}
+
+func (d *db) query(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.conn.QueryContext(ctx, d.dialect.Rebind(query), args...)
+}
+
+func (d *db) queryRow(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.conn.QueryRowContext(ctx, d.dialect.Rebind(query), args...)
+}
+
+// args collects the arguments of a query built on the fly
+type args []any
+
+// add appends an argument and returns its placeholder
+func (a *args) add(value any) string {
+	*a = append(*a, value)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// limitOffset returns the LIMIT and OFFSET clauses of a page, a limit of 0
+// meaning no limit
+func (a *args) limitOffset(limit, offset int64) string {
+	var clause string
+	if limit > 0 {
+		clause += " LIMIT " + a.add(limit)
+	}
+	if offset > 0 {
+		// Some databases only accept OFFSET after a LIMIT
+		if limit <= 0 {
+			clause += " LIMIT " + a.add(int64(1<<63-1))
+		}
+		clause += " OFFSET " + a.add(offset)
+	}
+	return clause
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// IDs are the decimal form of the integer primary keys.
+func formatID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+// parseID reads an ID. A string that is not an ID matches no row.
+func parseID(id string) (int64, bool) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	return n, err == nil && n > 0
+}
+
+// nullID is the value of an optional reference to another row
+func nullID(id string) any {
+	if n, ok := parseID(id); ok {
+		return n
+	}
+	return nil
+}
+
+func idOrEmpty(id sql.NullInt64) string {
+	if !id.Valid {
+		return ""
+	}
+	return formatID(id.Int64)
+}
+
+// Times are stored in UTC
+func utc(t time.Time) time.Time {
+	return t.UTC()
+}
+
+func nullTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+func timeOrNil(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	utc := t.Time.UTC()
+	return &utc
+}
+
+// jsonValue encodes the value of a JSON column
+func jsonValue(value any) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// scanJSON decodes a JSON column, leaving value as is when it is NULL
+func scanJSON(data []byte, value any) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, value)
+}
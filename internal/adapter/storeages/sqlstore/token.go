@@ -0,0 +1,153 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type OneTimeTokenRepository struct {
+	db db
+}
+
+func NewOneTimeTokenRepository(conn *sql.DB, dialect Dialect) *OneTimeTokenRepository {
+	return &OneTimeTokenRepository{db: db{conn: conn, dialect: dialect}}
+}
+
+const tokenColumns = "id, user_id, purpose, token_hash, data, attempts, created_at, expires_at, used_at"
+
+func scanToken(row scanner) (*domain.OneTimeToken, error) {
+	var (
+		token      domain.OneTimeToken
+		id, userID int64
+		data       []byte
+		usedAt     sql.NullTime
+	)
+	err := row.Scan(&id, &userID, &token.Purpose, &token.TokenHash, &data, &token.Attempts, &token.CreatedAt, &token.ExpiresAt, &usedAt)
+	if err != nil {
+		return nil, err
+	}
+	token.ID = formatID(id)
+	token.UserID = formatID(userID)
+	token.CreatedAt = token.CreatedAt.UTC()
+	token.ExpiresAt = token.ExpiresAt.UTC()
+	token.UsedAt = timeOrNil(usedAt)
+	if err := scanJSON(data, &token.Data); err != nil {
+		return nil, fmt.Errorf("failed to decode token data: %w", err)
+	}
+	return &token, nil
+}
+
+func (r *OneTimeTokenRepository) Create(ctx context.Context, token *domain.OneTimeToken) error {
+	userID, ok := parseID(token.UserID)
+	if !ok {
+		return fmt.Errorf("invalid user id %q", token.UserID)
+	}
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	data, err := jsonValue(token.Data)
+	if err != nil {
+		return err
+	}
+	var id int64
+	err = r.db.queryRow(ctx,
+		"INSERT INTO one_time_tokens (user_id, purpose, token_hash, data, attempts, created_at, expires_at, used_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id",
+		userID, token.Purpose, token.TokenHash, data, token.Attempts, utc(token.CreatedAt), utc(token.ExpiresAt), nullTime(token.UsedAt),
+	).Scan(&id)
+	if err != nil {
+		return err
+	}
+	token.ID = formatID(id)
+	return nil
+}
+
+func (r *OneTimeTokenRepository) GetByHash(ctx context.Context, purpose, tokenHash string) (*domain.OneTimeToken, error) {
+	token, err := scanToken(r.db.queryRow(ctx, "SELECT "+tokenColumns+" FROM one_time_tokens WHERE purpose = $1 AND token_hash = $2", purpose, tokenHash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrTokenNotFound
+	}
+	return token, err
+}
+
+// MarkUsed consumes the token. It fails with domain.ErrTokenUsed when another
+// request consumed it first.
+func (r *OneTimeTokenRepository) MarkUsed(ctx context.Context, id string) error {
+	n, ok := parseID(id)
+	if !ok {
+		return domain.ErrTokenUsed
+	}
+	result, err := r.db.exec(ctx, "UPDATE one_time_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL", time.Now().UTC(), n)
+	if err != nil {
+		return err
+	}
+	if used, err := result.RowsAffected(); err != nil {
+		return err
+	} else if used == 0 {
+		return domain.ErrTokenUsed
+	}
+	return nil
+}
+
+// Update replaces the data and expiry of an unused token.
+func (r *OneTimeTokenRepository) Update(ctx context.Context, token *domain.OneTimeToken) error {
+	n, ok := parseID(token.ID)
+	if !ok {
+		return domain.ErrTokenUsed
+	}
+	data, err := jsonValue(token.Data)
+	if err != nil {
+		return err
+	}
+	result, err := r.db.exec(ctx,
+		"UPDATE one_time_tokens SET data = $1, expires_at = $2 WHERE id = $3 AND used_at IS NULL",
+		data, utc(token.ExpiresAt), n,
+	)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return domain.ErrTokenUsed
+	}
+	return nil
+}
+
+// IncrementAttempts atomically counts a failed attempt at using the token and
+// returns the new total.
+func (r *OneTimeTokenRepository) IncrementAttempts(ctx context.Context, id string) (int, error) {
+	n, ok := parseID(id)
+	if !ok {
+		return 0, domain.ErrTokenNotFound
+	}
+	var attempts int
+	err := r.db.queryRow(ctx, "UPDATE one_time_tokens SET attempts = attempts + 1 WHERE id = $1 RETURNING attempts", n).Scan(&attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, domain.ErrTokenNotFound
+	}
+	return attempts, err
+}
+
+func (r *OneTimeTokenRepository) DeleteByUser(ctx context.Context, userID string, purposes ...string) error {
+	n, ok := parseID(userID)
+	if !ok {
+		return nil
+	}
+	var a args
+	query := "DELETE FROM one_time_tokens WHERE user_id = " + a.add(n)
+	if len(purposes) > 0 {
+		placeholders := make([]string, len(purposes))
+		for i, purpose := range purposes {
+			placeholders[i] = a.add(purpose)
+		}
+		query += " AND purpose IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+	_, err := r.db.exec(ctx, query, a...)
+	return err
+}
@@ -0,0 +1,644 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// UserRepository stores users in the users table. Emails are unique among
+// live users, which the database enforces with a partial unique index.
+type UserRepository struct {
+	db db
+}
+
+func NewUserRepository(conn *sql.DB, dialect Dialect) *UserRepository {
+	return &UserRepository{db: db{conn: conn, dialect: dialect}}
+}
+
+// userReadColumns are read in the order of scanUser. The password columns
+// come last so that ForEach can leave them out.
+const userReadColumns = `id, name, email, profile_display_name, profile_locale,
+	profile_timezone, profile_avatar_url, profile_phone, metadata, admin_metadata,
+	pending_email, role, status, status_reason, status_until, password_changed_at,
+	failed_logins, locked_until, mfa_methods, preferred_mfa, avatar, created_at,
+	version, deleted_at`
+
+const (
+	userColumns = userReadColumns + ", password, password_history"
+	// userColumnsWithoutPasswords reads empty password columns
+	userColumnsWithoutPasswords = userReadColumns + ", '', NULL"
+)
+
+// userWriteColumns are written in the order of userValues
+var userWriteColumns = []string{
+	"name", "email", "name_lower", "email_lower", "search_words", "profile_display_name", "profile_locale",
+	"profile_timezone", "profile_avatar_url", "profile_phone", "metadata",
+	"admin_metadata", "pending_email", "role", "status", "status_reason",
+	"status_until", "password", "password_history", "password_changed_at",
+	"failed_logins", "locked_until", "mfa_methods", "preferred_mfa", "avatar",
+	"created_at",
+}
+
+var (
+	userInsert = fmt.Sprintf("INSERT INTO users (%s, version) VALUES (%s, 1) RETURNING id",
+		strings.Join(userWriteColumns, ", "), placeholders(len(userWriteColumns)))
+	userUpdate = fmt.Sprintf("UPDATE users SET %s, version = version + 1 WHERE id = $%d AND version = $%d",
+		assignments(userWriteColumns), len(userWriteColumns)+1, len(userWriteColumns)+2)
+)
+
+func placeholders(n int) string {
+	var a args
+	list := make([]string, n)
+	for i := range list {
+		list[i] = a.add(nil)
+	}
+	return strings.Join(list, ", ")
+}
+
+func assignments(columns []string) string {
+	var a args
+	list := make([]string, len(columns))
+	for i, column := range columns {
+		list[i] = column + " = " + a.add(nil)
+	}
+	return strings.Join(list, ", ")
+}
+
+func userValues(user *domain.User) ([]any, error) {
+	metadata, err := jsonValue(user.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	adminMetadata, err := jsonValue(user.AdminMetadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode admin metadata: %w", err)
+	}
+	passwordHistory, err := jsonValue(user.PasswordHistory)
+	if err != nil {
+		return nil, err
+	}
+	mfaMethods, err := jsonValue(user.MFAMethods)
+	if err != nil {
+		return nil, err
+	}
+	return []any{
+		user.Name, user.Email, strings.ToLower(user.Name), strings.ToLower(user.Email), searchWords(user), user.Profile.DisplayName, user.Profile.Locale,
+		user.Profile.Timezone, user.Profile.AvatarURL, user.Profile.Phone, metadata,
+		adminMetadata, user.PendingEmail, user.Role, user.Status, user.StatusReason,
+		nullTime(user.StatusUntil), user.Password, passwordHistory, nullTime(user.PasswordChangedAt),
+		user.FailedLogins, nullTime(user.LockedUntil), mfaMethods, user.PreferredMFA, user.Avatar,
+		utc(user.CreatedAt),
+	}, nil
+}
+
+// scanUser reads a row of userColumns, followed by extra columns
+func scanUser(row scanner, extra ...any) (*domain.User, error) {
+	var (
+		user                                                   domain.User
+		id                                                     int64
+		metadata, adminMetadata, mfaMethods, passwordHistory   []byte
+		statusUntil, passwordChangedAt, lockedUntil, deletedAt sql.NullTime
+	)
+	dest := []any{
+		&id, &user.Name, &user.Email, &user.Profile.DisplayName, &user.Profile.Locale,
+		&user.Profile.Timezone, &user.Profile.AvatarURL, &user.Profile.Phone, &metadata, &adminMetadata,
+		&user.PendingEmail, &user.Role, &user.Status, &user.StatusReason, &statusUntil, &passwordChangedAt,
+		&user.FailedLogins, &lockedUntil, &mfaMethods, &user.PreferredMFA, &user.Avatar, &user.CreatedAt,
+		&user.Version, &deletedAt, &user.Password, &passwordHistory,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	user.ID = formatID(id)
+	user.CreatedAt = user.CreatedAt.UTC()
+	user.StatusUntil = timeOrNil(statusUntil)
+	user.PasswordChangedAt = timeOrNil(passwordChangedAt)
+	user.LockedUntil = timeOrNil(lockedUntil)
+	user.DeletedAt = timeOrNil(deletedAt)
+	if err := scanJSON(metadata, &user.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	if err := scanJSON(adminMetadata, &user.AdminMetadata); err != nil {
+		return nil, fmt.Errorf("failed to decode admin metadata: %w", err)
+	}
+	if err := scanJSON(mfaMethods, &user.MFAMethods); err != nil {
+		return nil, err
+	}
+	if err := scanJSON(passwordHistory, &user.PasswordHistory); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// searchWords are the lowercase words of the name and email between spaces,
+// so that Search can find whole words with LIKE like a MongoDB text index
+func searchWords(user *domain.User) string {
+	return " " + strings.Join(append(words(user.Name), words(user.Email)...), " ") + " "
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func (r *UserRepository) Create(ctx context.Context, user *domain.User) error {
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	values, err := userValues(user)
+	if err != nil {
+		return err
+	}
+	var id int64
+	if err := r.db.queryRow(ctx, userInsert, values...).Scan(&id); err != nil {
+		if r.db.dialect.IsUniqueViolation(err) {
+			return domain.ErrEmailTaken
+		}
+		return err
+	}
+	user.ID = formatID(id)
+	user.Version = 1
+	return nil
+}
+
+// get returns the user matching condition, whose only argument is the
+// user ID
+func (r *UserRepository) get(ctx context.Context, condition, id string) (*domain.User, error) {
+	n, ok := parseID(id)
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	user, err := scanUser(r.db.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1 AND "+condition, n))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrUserNotFound
+	}
+	return user, err
+}
+
+func (r *UserRepository) GetByID(ctx context.Context, id string) (*domain.User, error) {
+	return r.get(ctx, "deleted_at IS NULL", id)
+}
+
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	user, err := scanUser(r.db.queryRow(ctx, "SELECT "+userColumns+" FROM users WHERE email = $1 AND deleted_at IS NULL", email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrUserNotFound
+	}
+	return user, err
+}
+
+// userFields copies each field UserRepository.Update can write
+var userFields = map[string]func(stored, user *domain.User){
+	domain.UserFieldName:              func(stored, user *domain.User) { stored.Name = user.Name },
+	domain.UserFieldEmail:             func(stored, user *domain.User) { stored.Email = user.Email },
+	domain.UserFieldPendingEmail:      func(stored, user *domain.User) { stored.PendingEmail = user.PendingEmail },
+	domain.UserFieldProfile:           func(stored, user *domain.User) { stored.Profile = user.Profile },
+	domain.UserFieldMetadata:          func(stored, user *domain.User) { stored.Metadata = user.Metadata },
+	domain.UserFieldAdminMetadata:     func(stored, user *domain.User) { stored.AdminMetadata = user.AdminMetadata },
+	domain.UserFieldAvatar:            func(stored, user *domain.User) { stored.Avatar = user.Avatar },
+	domain.UserFieldRole:              func(stored, user *domain.User) { stored.Role = user.Role },
+	domain.UserFieldStatus:            func(stored, user *domain.User) { stored.Status = user.Status },
+	domain.UserFieldStatusReason:      func(stored, user *domain.User) { stored.StatusReason = user.StatusReason },
+	domain.UserFieldStatusUntil:       func(stored, user *domain.User) { stored.StatusUntil = user.StatusUntil },
+	domain.UserFieldPassword:          func(stored, user *domain.User) { stored.Password = user.Password },
+	domain.UserFieldPasswordHistory:   func(stored, user *domain.User) { stored.PasswordHistory = user.PasswordHistory },
+	domain.UserFieldPasswordChangedAt: func(stored, user *domain.User) { stored.PasswordChangedAt = user.PasswordChangedAt },
+	"failed_logins":                   func(stored, user *domain.User) { stored.FailedLogins = user.FailedLogins },
+	"locked_until":                    func(stored, user *domain.User) { stored.LockedUntil = user.LockedUntil },
+	domain.UserFieldMFAMethods:        func(stored, user *domain.User) { stored.MFAMethods = user.MFAMethods },
+	domain.UserFieldPreferredMFA:      func(stored, user *domain.User) { stored.PreferredMFA = user.PreferredMFA },
+	"created_at":                      func(stored, user *domain.User) { stored.CreatedAt = user.CreatedAt },
+}
+
+// Update writes the given fields of the user, or all of them when none are
+// listed, and bumps its version. The fields are copied onto the stored user,
+// which is written back only if nobody changed it in the meantime; with
+// domain.AnyVersion a concurrent change makes it start over instead. Like in
+// MongoDB, soft deleted users can still be updated.
+func (r *UserRepository) Update(ctx context.Context, user *domain.User, fields ...string) error {
+	if len(fields) == 0 {
+		fields = slices.Collect(maps.Keys(userFields))
+	}
+	for _, field := range fields {
+		if _, ok := userFields[field]; !ok {
+			return fmt.Errorf("unknown user field %q", field)
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		version, err := r.update(ctx, user, fields)
+		if errors.Is(err, domain.ErrVersionConflict) && user.Version == domain.AnyVersion && attempt < maxUpdateAttempts {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		user.Version = version
+		return nil
+	}
+}
+
+// maxUpdateAttempts bounds how often Update retries a write that ignores the
+// version
+const maxUpdateAttempts = 5
+
+// update makes one attempt at Update and returns the new version
+func (r *UserRepository) update(ctx context.Context, user *domain.User, fields []string) (int64, error) {
+	stored, err := r.get(ctx, "TRUE", user.ID)
+	if errors.Is(err, domain.ErrUserNotFound) && user.Version != domain.AnyVersion {
+		return 0, domain.ErrVersionConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+	if user.Version != domain.AnyVersion && stored.Version != user.Version {
+		return 0, domain.ErrVersionConflict
+	}
+	for _, field := range fields {
+		userFields[field](stored, user)
+	}
+
+	values, err := userValues(stored)
+	if err != nil {
+		return 0, err
+	}
+	id, _ := parseID(stored.ID)
+	result, err := r.db.exec(ctx, userUpdate, append(values, id, stored.Version)...)
+	if err != nil {
+		if r.db.dialect.IsUniqueViolation(err) {
+			return 0, domain.ErrEmailTaken
+		}
+		return 0, err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return 0, err
+	} else if updated == 0 {
+		return 0, domain.ErrVersionConflict
+	}
+	return stored.Version + 1, nil
+}
+
+// IncrementFailedLogins atomically counts a wrong password and returns the
+// new total.
+func (r *UserRepository) IncrementFailedLogins(ctx context.Context, id string) (int, error) {
+	n, ok := parseID(id)
+	if !ok {
+		return 0, domain.ErrUserNotFound
+	}
+	var failedLogins int
+	err := r.db.queryRow(ctx, "UPDATE users SET failed_logins = failed_logins + 1 WHERE id = $1 AND deleted_at IS NULL RETURNING failed_logins", n).Scan(&failedLogins)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, domain.ErrUserNotFound
+	}
+	return failedLogins, err
+}
+
+func (r *UserRepository) ResetFailedLogins(ctx context.Context, id string, lockedUntil *time.Time) error {
+	n, ok := parseID(id)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	result, err := r.db.exec(ctx, "UPDATE users SET failed_logins = 0, locked_until = $1 WHERE id = $2 AND deleted_at IS NULL", nullTime(lockedUntil), n)
+	if err != nil {
+		return err
+	}
+	if reset, err := result.RowsAffected(); err != nil {
+		return err
+	} else if reset == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// Delete soft deletes the user by setting deleted_at. The row stays in the
+// table until Purge removes it. Unless version is domain.AnyVersion, the
+// user must still be at that version.
+func (r *UserRepository) Delete(ctx context.Context, id string, version int64) error {
+	n, ok := parseID(id)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	var a args
+	query := fmt.Sprintf("UPDATE users SET deleted_at = %s, version = version + 1 WHERE id = %s AND deleted_at IS NULL",
+		a.add(time.Now().UTC()), a.add(n))
+	if version != domain.AnyVersion {
+		query += " AND version = " + a.add(version)
+	}
+	result, err := r.db.exec(ctx, query, a...)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		if version != domain.AnyVersion {
+			if _, err := r.GetByID(ctx, id); err == nil {
+				return domain.ErrVersionConflict
+			}
+		}
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// GetDeletedByID returns a soft deleted user.
+func (r *UserRepository) GetDeletedByID(ctx context.Context, id string) (*domain.User, error) {
+	return r.get(ctx, "deleted_at IS NOT NULL", id)
+}
+
+// Restore clears the deleted_at marker of a soft deleted user. It fails with
+// domain.ErrEmailTaken when a live user has the same email.
+func (r *UserRepository) Restore(ctx context.Context, id string) error {
+	n, ok := parseID(id)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	result, err := r.db.exec(ctx, "UPDATE users SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL", n)
+	if err != nil {
+		if r.db.dialect.IsUniqueViolation(err) {
+			return domain.ErrEmailTaken
+		}
+		return err
+	}
+	if restored, err := result.RowsAffected(); err != nil {
+		return err
+	} else if restored == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// ListDeletedBefore returns up to limit users soft deleted before the given time.
+func (r *UserRepository) ListDeletedBefore(ctx context.Context, before time.Time, limit int64) ([]*domain.User, error) {
+	var a args
+	query := fmt.Sprintf("SELECT %s FROM users WHERE deleted_at < %s ORDER BY deleted_at, id", userColumns, a.add(before.UTC()))
+	query += a.limitOffset(limit, 0)
+	users, _, err := r.queryUsers(ctx, query, a, false)
+	return users, err
+}
+
+// Purge permanently removes a soft deleted user. Sessions, one-time tokens
+// and login history that still reference the user go with it.
+func (r *UserRepository) Purge(ctx context.Context, id string) error {
+	n, ok := parseID(id)
+	if !ok {
+		return domain.ErrUserNotFound
+	}
+	result, err := r.db.exec(ctx, "DELETE FROM users WHERE id = $1 AND deleted_at IS NOT NULL", n)
+	if err != nil {
+		return err
+	}
+	if purged, err := result.RowsAffected(); err != nil {
+		return err
+	} else if purged == 0 {
+		return domain.ErrUserNotFound
+	}
+	return nil
+}
+
+// likePrefix is a LIKE pattern, to use with ESCAPE '\' on the lowercase
+// name_lower and email_lower columns, matching strings that start with prefix
+// ignoring case. The columns are lowercased by Go rather than by the
+// database, whose LOWER only handles ASCII in some configurations.
+func likePrefix(prefix string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(strings.ToLower(prefix))
+	return escaped + "%"
+}
+
+// userWhere turns a filter into a condition that also leaves out deleted
+// users. The cursor is not part of it.
+func userWhere(filter *domain.UserFilter, a *args) string {
+	conditions := []string{"deleted_at IS NULL"}
+	if filter == nil {
+		return conditions[0]
+	}
+	if filter.EmailPrefix != "" {
+		conditions = append(conditions, "email_lower LIKE "+a.add(likePrefix(filter.EmailPrefix))+` ESCAPE '\'`)
+	}
+	if filter.NamePrefix != "" {
+		conditions = append(conditions, "name_lower LIKE "+a.add(likePrefix(filter.NamePrefix))+` ESCAPE '\'`)
+	}
+	if filter.Search != "" {
+		// Any word of the search matches, like in a MongoDB text search
+		var matches []string
+		for _, word := range words(filter.Search) {
+			matches = append(matches, "search_words LIKE "+a.add("% "+word+" %"))
+		}
+		if len(matches) == 0 {
+			matches = []string{"1 = 0"}
+		}
+		conditions = append(conditions, "("+strings.Join(matches, " OR ")+")")
+	}
+	if !filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= "+a.add(filter.CreatedFrom.UTC()))
+	}
+	if !filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at <= "+a.add(filter.CreatedTo.UTC()))
+	}
+	// Users without a status or role are active users
+	switch filter.Status {
+	case "":
+	case domain.UserStatusActive:
+		conditions = append(conditions, "status IN ('', "+a.add(filter.Status)+")")
+	default:
+		conditions = append(conditions, "status = "+a.add(filter.Status))
+	}
+	switch filter.Role {
+	case "":
+	case domain.RoleUser:
+		conditions = append(conditions, "role IN ('', "+a.add(filter.Role)+")")
+	default:
+		conditions = append(conditions, "role = "+a.add(filter.Role))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// userOrder builds the ORDER BY of a listing. Users are sorted by creation
+// by default, and id always comes last so that pages are stable when sort
+// keys are equal.
+func userOrder(filter *domain.UserFilter) (string, error) {
+	if filter == nil || len(filter.Sort) == 0 {
+		return "created_at, id", nil
+	}
+	var order []string
+	for _, field := range filter.Sort {
+		if !slices.Contains(domain.UserSortFields, field.Field) {
+			return "", fmt.Errorf("%w: cannot sort by %q", domain.ErrInvalidSort, field.Field)
+		}
+		if field.Desc {
+			order = append(order, field.Field+" DESC")
+		} else {
+			order = append(order, field.Field)
+		}
+	}
+	return strings.Join(append(order, "id"), ", "), nil
+}
+
+// userCursorWhere matches the users after (or before, when paging backward)
+// the cursor position and returns the matching order.
+func userCursorWhere(cursor *domain.UserCursor, a *args) (string, string, error) {
+	id, ok := parseID(cursor.ID)
+	if !ok {
+		return "", "", fmt.Errorf("invalid cursor id %q", cursor.ID)
+	}
+
+	// Walking forward through an ascending listing or backward through a
+	// descending one both mean looking at greater keys.
+	op, direction := ">", "ASC"
+	if cursor.Desc != cursor.Backward {
+		op, direction = "<", "DESC"
+	}
+	createdAt := a.add(cursor.CreatedAt.UTC())
+	condition := fmt.Sprintf("(created_at %s %s OR (created_at = %s AND id %s %s))", op, createdAt, createdAt, op, a.add(id))
+	return condition, "created_at " + direction + ", id " + direction, nil
+}
+
+// listQuery selects a page of users matching filter. With total, each row
+// also carries the number of users matching the filter, which cannot be
+// counted this way when there is a cursor.
+func listQuery(filter *domain.UserFilter, limit, offset int64, total bool) (string, args, error) {
+	var a args
+	where := userWhere(filter, &a)
+	order, err := userOrder(filter)
+	if err != nil {
+		return "", nil, err
+	}
+	if filter != nil && filter.Cursor != nil {
+		var condition string
+		condition, order, err = userCursorWhere(filter.Cursor, &a)
+		if err != nil {
+			return "", nil, err
+		}
+		where += " AND " + condition
+		offset = 0
+	}
+	columns := userColumns
+	if total {
+		columns += ", COUNT(*) OVER ()"
+	}
+	query := fmt.Sprintf("SELECT %s FROM users WHERE %s ORDER BY %s", columns, where, order)
+	return query + a.limitOffset(limit, offset), a, nil
+}
+
+// queryUsers runs a query for userColumns, followed by the total when
+// withTotal is set
+func (r *UserRepository) queryUsers(ctx context.Context, query string, a args, withTotal bool) ([]*domain.User, int64, error) {
+	rows, err := r.db.query(ctx, query, a...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []*domain.User{}
+	var total int64
+	for rows.Next() {
+		var extra []any
+		if withTotal {
+			extra = append(extra, &total)
+		}
+		user, err := scanUser(rows, extra...)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, user)
+	}
+	return users, total, rows.Err()
+}
+
+func (r *UserRepository) List(ctx context.Context, filter *domain.UserFilter, limit, offset int64) ([]*domain.User, error) {
+	query, a, err := listQuery(filter, limit, offset, false)
+	if err != nil {
+		return nil, err
+	}
+	users, _, err := r.queryUsers(ctx, query, a, false)
+	if err != nil {
+		return nil, err
+	}
+	// A backward page is read in reverse, put it back in listing order.
+	if filter != nil && filter.Cursor != nil && filter.Cursor.Backward {
+		slices.Reverse(users)
+	}
+	return users, nil
+}
+
+// ListAndCount returns a page of users matching filter together with the
+// number of users matching it, ignoring the cursor. Without a cursor both
+// come from a single query.
+func (r *UserRepository) ListAndCount(ctx context.Context, filter *domain.UserFilter, limit, offset int64) ([]*domain.User, int64, error) {
+	if filter != nil && filter.Cursor != nil {
+		users, err := r.List(ctx, filter, limit, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		total, err := r.Count(ctx, filter)
+		if err != nil {
+			return nil, 0, err
+		}
+		return users, total, nil
+	}
+
+	query, a, err := listQuery(filter, limit, offset, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	users, total, err := r.queryUsers(ctx, query, a, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	// A page past the end has no row to carry the total
+	if len(users) == 0 && offset > 0 {
+		total, err = r.Count(ctx, filter)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return users, total, nil
+}
+
+// Count ignores the cursor of filter, counting every user matching it.
+func (r *UserRepository) Count(ctx context.Context, filter *domain.UserFilter) (int64, error) {
+	var a args
+	var count int64
+	err := r.db.queryRow(ctx, "SELECT COUNT(*) FROM users WHERE "+userWhere(filter, &a), a...).Scan(&count)
+	return count, err
+}
+
+// ForEach walks the rows of the users matching filter, so that any number
+// of users can be read in constant memory.
+func (r *UserRepository) ForEach(ctx context.Context, filter *domain.UserFilter, fn func(*domain.User) error) error {
+	var a args
+	where := userWhere(filter, &a)
+	order, err := userOrder(filter)
+	if err != nil {
+		return err
+	}
+	rows, err := r.db.query(ctx, fmt.Sprintf("SELECT %s FROM users WHERE %s ORDER BY %s", userColumnsWithoutPasswords, where, order), a...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(user); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,256 @@
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+func testSessions(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	user := createUser(t, repos, &domain.User{Name: "Jane", Email: "jane@example.com"})
+	admin := createUser(t, repos, &domain.User{Name: "Admin", Email: "admin@example.com"})
+	expires := now().Add(time.Hour)
+
+	first := &domain.Session{UserID: user.ID, ExpiresAt: expires}
+	require.NoError(t, repos.Sessions.Create(ctx, first))
+	require.NotEmpty(t, first.ID)
+	assert.False(t, first.CreatedAt.IsZero())
+	second := &domain.Session{UserID: user.ID, ExpiresAt: expires, ImpersonatorID: admin.ID}
+	require.NoError(t, repos.Sessions.Create(ctx, second))
+	third := &domain.Session{UserID: user.ID, ExpiresAt: expires}
+	require.NoError(t, repos.Sessions.Create(ctx, third))
+	other := &domain.Session{UserID: admin.ID, ExpiresAt: expires}
+	require.NoError(t, repos.Sessions.Create(ctx, other))
+
+	got, err := repos.Sessions.GetByID(ctx, second.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, got.UserID)
+	assert.Equal(t, admin.ID, got.ImpersonatorID)
+	assert.True(t, expires.Equal(got.ExpiresAt))
+	assert.True(t, got.IsActive(time.Now()))
+
+	require.NoError(t, repos.Sessions.Revoke(ctx, first.ID))
+	got, err = repos.Sessions.GetByID(ctx, first.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, got.RevokedAt)
+	assert.Empty(t, got.ImpersonatorID)
+
+	// The revoked session is not counted again
+	revoked, err := repos.Sessions.RevokeAllForUser(ctx, user.ID, third.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), revoked)
+	got, err = repos.Sessions.GetByID(ctx, third.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got.RevokedAt)
+
+	sessions, err := repos.Sessions.ListByUser(ctx, user.ID)
+	require.NoError(t, err)
+	ids := make([]string, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	assert.Equal(t, []string{third.ID, second.ID, first.ID}, ids)
+
+	require.NoError(t, repos.Sessions.DeleteByUser(ctx, user.ID))
+	_, err = repos.Sessions.GetByID(ctx, first.ID)
+	assert.ErrorIs(t, err, domain.ErrSessionNotFound)
+	sessions, err = repos.Sessions.ListByUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+	_, err = repos.Sessions.GetByID(ctx, other.ID)
+	assert.NoError(t, err)
+}
+
+func testTokens(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	user := createUser(t, repos, &domain.User{Name: "Jane", Email: "jane@example.com"})
+	expires := now().Add(time.Hour)
+
+	token := &domain.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   domain.TokenPurposeEmailChangeConfirm,
+		TokenHash: "hash-1",
+		Data:      map[string]string{"email": "new@example.com"},
+		ExpiresAt: expires,
+	}
+	require.NoError(t, repos.Tokens.Create(ctx, token))
+	require.NotEmpty(t, token.ID)
+
+	got, err := repos.Tokens.GetByHash(ctx, domain.TokenPurposeEmailChangeConfirm, "hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, token.ID, got.ID)
+	assert.Equal(t, user.ID, got.UserID)
+	assert.Equal(t, map[string]string{"email": "new@example.com"}, got.Data)
+	assert.True(t, expires.Equal(got.ExpiresAt))
+	assert.Nil(t, got.UsedAt)
+	_, err = repos.Tokens.GetByHash(ctx, domain.TokenPurposeMagicLink, "hash-1")
+	assert.ErrorIs(t, err, domain.ErrTokenNotFound)
+
+	attempts, err := repos.Tokens.IncrementAttempts(ctx, token.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempts)
+	got.Data = map[string]string{"code": "123456"}
+	got.Attempts = 0
+	got.ExpiresAt = expires.Add(time.Hour)
+	require.NoError(t, repos.Tokens.Update(ctx, got))
+	got, err = repos.Tokens.GetByHash(ctx, domain.TokenPurposeEmailChangeConfirm, "hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"code": "123456"}, got.Data)
+	assert.Equal(t, 1, got.Attempts)
+
+	require.NoError(t, repos.Tokens.MarkUsed(ctx, token.ID))
+	assert.ErrorIs(t, repos.Tokens.MarkUsed(ctx, token.ID), domain.ErrTokenUsed)
+	assert.ErrorIs(t, repos.Tokens.Update(ctx, got), domain.ErrTokenUsed)
+	got, err = repos.Tokens.GetByHash(ctx, domain.TokenPurposeEmailChangeConfirm, "hash-1")
+	require.NoError(t, err)
+	assert.NotNil(t, got.UsedAt)
+
+	magicLink := &domain.OneTimeToken{UserID: user.ID, Purpose: domain.TokenPurposeMagicLink, TokenHash: "hash-2", ExpiresAt: expires}
+	require.NoError(t, repos.Tokens.Create(ctx, magicLink))
+	require.NoError(t, repos.Tokens.DeleteByUser(ctx, user.ID, domain.TokenPurposeMagicLink))
+	_, err = repos.Tokens.GetByHash(ctx, domain.TokenPurposeMagicLink, "hash-2")
+	assert.ErrorIs(t, err, domain.ErrTokenNotFound)
+	_, err = repos.Tokens.GetByHash(ctx, domain.TokenPurposeEmailChangeConfirm, "hash-1")
+	assert.NoError(t, err)
+
+	require.NoError(t, repos.Tokens.DeleteByUser(ctx, user.ID))
+	_, err = repos.Tokens.GetByHash(ctx, domain.TokenPurposeEmailChangeConfirm, "hash-1")
+	assert.ErrorIs(t, err, domain.ErrTokenNotFound)
+	_, err = repos.Tokens.IncrementAttempts(ctx, token.ID)
+	assert.ErrorIs(t, err, domain.ErrTokenNotFound)
+}
+
+func testLoginHistory(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	user := createUser(t, repos, &domain.User{Name: "Jane", Email: "jane@example.com"})
+	other := createUser(t, repos, &domain.User{Name: "John", Email: "john@example.com"})
+	start := now().Add(-time.Hour)
+
+	var ids []string
+	for i, device := range []string{"laptop", "phone", "laptop", "tablet"} {
+		event := &domain.LoginEvent{
+			UserID:   user.ID,
+			Time:     start.Add(time.Duration(i) * time.Minute),
+			Success:  device != "tablet",
+			Methods:  []string{"pwd"},
+			IP:       "203.0.113.7",
+			DeviceID: device,
+		}
+		require.NoError(t, repos.LoginHistory.Create(ctx, event))
+		require.NotEmpty(t, event.ID)
+		ids = append(ids, event.ID)
+	}
+	require.NoError(t, repos.LoginHistory.Create(ctx, &domain.LoginEvent{UserID: other.ID, Time: start, Success: true, DeviceID: "desktop"}))
+
+	events, err := repos.LoginHistory.ListByUser(ctx, user.ID, 2, 1)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, ids[2], events[0].ID)
+	assert.Equal(t, ids[1], events[1].ID)
+	assert.Equal(t, user.ID, events[0].UserID)
+	assert.Equal(t, []string{"pwd"}, events[0].Methods)
+	assert.True(t, start.Add(2*time.Minute).Equal(events[0].Time))
+
+	hasDevice, err := repos.LoginHistory.HasDevice(ctx, user.ID, "phone")
+	require.NoError(t, err)
+	assert.True(t, hasDevice)
+	// Failed attempts do not make a device known
+	hasDevice, err = repos.LoginHistory.HasDevice(ctx, user.ID, "tablet")
+	require.NoError(t, err)
+	assert.False(t, hasDevice)
+	hasDevice, err = repos.LoginHistory.HasDevice(ctx, user.ID, "desktop")
+	require.NoError(t, err)
+	assert.False(t, hasDevice)
+
+	count, err := repos.LoginHistory.CountSuccessful(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), count)
+
+	require.NoError(t, repos.LoginHistory.Prune(ctx, user.ID, 2))
+	events, err = repos.LoginHistory.ListByUser(ctx, user.ID, 0, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, ids[3], events[0].ID)
+	assert.Equal(t, ids[2], events[1].ID)
+
+	require.NoError(t, repos.LoginHistory.DeleteByUser(ctx, user.ID))
+	events, err = repos.LoginHistory.ListByUser(ctx, user.ID, 0, 0)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+	count, err = repos.LoginHistory.CountSuccessful(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+}
+
+func testAudit(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	last, err := repos.Audit.Last(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, last)
+
+	start := now().Add(-time.Hour)
+	entries := []*domain.AuditEntry{
+		{Seq: 1, Time: start, ActorID: "a", Action: domain.AuditActionLogin, Outcome: domain.AuditOutcomeSuccess},
+		{Seq: 2, Time: start.Add(time.Minute), ActorID: "b", TargetID: "a", Action: domain.AuditActionUserDelete, Outcome: domain.AuditOutcomeSuccess, Details: map[string]string{"reason": "spam"}},
+		{Seq: 3, Time: start.Add(2 * time.Minute), ActorID: "b", Action: domain.AuditActionLogin, Outcome: domain.AuditOutcomeFailure, IP: "203.0.113.7", Details: map[string]string{}},
+	}
+	prevHash := ""
+	for _, entry := range entries {
+		entry.PrevHash = prevHash
+		entry.Hash = entry.ComputeHash()
+		prevHash = entry.Hash
+		require.NoError(t, repos.Audit.Append(ctx, entry))
+		require.NotEmpty(t, entry.ID)
+	}
+	duplicate := &domain.AuditEntry{Seq: 3, Time: start, Action: domain.AuditActionLogin, Outcome: domain.AuditOutcomeSuccess}
+	assert.ErrorIs(t, repos.Audit.Append(ctx, duplicate), domain.ErrAuditConflict)
+
+	last, err = repos.Audit.Last(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), last.Seq)
+	// Entries read back hash to the stored hash
+	assert.Equal(t, last.Hash, last.ComputeHash())
+
+	seqs := func(entries []*domain.AuditEntry) []int64 {
+		seqs := make([]int64, 0, len(entries))
+		for _, entry := range entries {
+			seqs = append(seqs, entry.Seq)
+		}
+		return seqs
+	}
+	tests := []struct {
+		name   string
+		filter *domain.AuditFilter
+		want   []int64
+	}{
+		{"none", &domain.AuditFilter{}, []int64{3, 2, 1}},
+		{"actor", &domain.AuditFilter{ActorID: "b"}, []int64{3, 2}},
+		{"target", &domain.AuditFilter{TargetID: "a"}, []int64{2}},
+		{"subject", &domain.AuditFilter{Subject: "a"}, []int64{2, 1}},
+		{"action and outcome", &domain.AuditFilter{Action: domain.AuditActionLogin, Outcome: domain.AuditOutcomeSuccess}, []int64{1}},
+		{"time range", &domain.AuditFilter{From: start.Add(time.Minute), To: start.Add(time.Minute)}, []int64{2}},
+	}
+	for _, test := range tests {
+		got, err := repos.Audit.List(ctx, test.filter, 0, 0)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, test.want, seqs(got), test.name)
+	}
+	got, err := repos.Audit.List(ctx, &domain.AuditFilter{}, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{2}, seqs(got))
+	assert.Equal(t, map[string]string{"reason": "spam"}, got[0].Details)
+
+	var iterated []*domain.AuditEntry
+	require.NoError(t, repos.Audit.Iterate(ctx, func(entry *domain.AuditEntry) error {
+		assert.Equal(t, entry.Hash, entry.ComputeHash())
+		iterated = append(iterated, entry)
+		return nil
+	}))
+	assert.Equal(t, []int64{1, 2, 3}, seqs(iterated))
+}
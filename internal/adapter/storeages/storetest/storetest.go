@@ -0,0 +1,83 @@
+// Package storetest is the contract every storage backend must satisfy. Each
+// backend runs it from its own tests, so that the services behave the same
+// whatever the database.
+package storetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/port"
+)
+
+// Repositories are the stores of a backend, opened on an empty database
+type Repositories struct {
+	Users        port.UserRepository
+	Sessions     port.SessionRepository
+	Tokens       port.OneTimeTokenRepository
+	LoginHistory port.LoginHistoryRepository
+	Audit        port.AuditRepository
+}
+
+// Run runs the whole contract. open is called once per test and must return
+// repositories that share nothing with the ones of other tests.
+func Run(t *testing.T, open func(t *testing.T) *Repositories) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repos *Repositories)
+	}{
+		{"Users/CreateAndGet", testUserCreateAndGet},
+		{"Users/NotFound", testUserNotFound},
+		{"Users/Update", testUserUpdate},
+		{"Users/FailedLogins", testUserFailedLogins},
+		{"Users/DuplicateEmail", testUserDuplicateEmail},
+		{"Users/SoftDelete", testUserSoftDelete},
+		{"Users/Filters", testUserFilters},
+		{"Users/SortAndOffset", testUserSortAndOffset},
+		{"Users/Cursor", testUserCursor},
+		{"Users/ForEach", testUserForEach},
+		{"Sessions", testSessions},
+		{"Tokens", testTokens},
+		{"LoginHistory", testLoginHistory},
+		{"Audit", testAudit},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.run(t, open(t))
+		})
+	}
+}
+
+// now is the current time at the millisecond precision every backend keeps
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+func createUser(t *testing.T, repos *Repositories, user *domain.User) *domain.User {
+	t.Helper()
+	require.NoError(t, repos.Users.Create(context.Background(), user))
+	require.NotEmpty(t, user.ID)
+	return user
+}
+
+// missingUserID returns the ID of a user that existed and was purged
+func missingUserID(t *testing.T, repos *Repositories) string {
+	t.Helper()
+	ctx := context.Background()
+	user := createUser(t, repos, &domain.User{Name: "Gone", Email: "gone@example.com"})
+	require.NoError(t, repos.Users.Delete(ctx, user.ID, domain.AnyVersion))
+	require.NoError(t, repos.Users.Purge(ctx, user.ID))
+	return user.ID
+}
+
+func userIDs(users []*domain.User) []string {
+	ids := make([]string, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	return ids
+}
@@ -0,0 +1,339 @@
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+func testUserCreateAndGet(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	until := now().Add(time.Hour)
+	user := createUser(t, repos, &domain.User{
+		Name:        "Jane Doe",
+		Email:       "jane@example.com",
+		Password:    "hash",
+		Profile:     domain.UserProfile{DisplayName: "Jane", Locale: "en-US", Phone: "+33612345678"},
+		Metadata:    map[string]any{"plan": "pro"},
+		Role:        domain.RoleAdmin,
+		Status:      domain.UserStatusSuspended,
+		StatusUntil: &until,
+		MFAMethods:  []string{"email"},
+	})
+	assert.Equal(t, int64(1), user.Version)
+	assert.False(t, user.CreatedAt.IsZero())
+
+	got, err := repos.Users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+	assert.Equal(t, "Jane Doe", got.Name)
+	assert.Equal(t, "jane@example.com", got.Email)
+	assert.Equal(t, "hash", got.Password)
+	assert.Equal(t, user.Profile, got.Profile)
+	assert.Equal(t, map[string]any{"plan": "pro"}, got.Metadata)
+	assert.Equal(t, domain.RoleAdmin, got.Role)
+	assert.Equal(t, domain.UserStatusSuspended, got.Status)
+	require.NotNil(t, got.StatusUntil)
+	assert.True(t, until.Equal(*got.StatusUntil))
+	assert.Equal(t, []string{"email"}, got.MFAMethods)
+	assert.Equal(t, int64(1), got.Version)
+	assert.Nil(t, got.DeletedAt)
+
+	got, err = repos.Users.GetByEmail(ctx, "jane@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+
+	// Changing a returned user does not change the stored one
+	got.Name = "Changed"
+	got, err = repos.Users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Doe", got.Name)
+}
+
+func testUserNotFound(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	id := missingUserID(t, repos)
+
+	_, err := repos.Users.GetByID(ctx, id)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	_, err = repos.Users.GetByEmail(ctx, "nobody@example.com")
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	_, err = repos.Users.GetDeletedByID(ctx, id)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	assert.ErrorIs(t, repos.Users.Delete(ctx, id, domain.AnyVersion), domain.ErrUserNotFound)
+	assert.ErrorIs(t, repos.Users.Restore(ctx, id), domain.ErrUserNotFound)
+	assert.ErrorIs(t, repos.Users.Purge(ctx, id), domain.ErrUserNotFound)
+}
+
+func testUserUpdate(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	user := createUser(t, repos, &domain.User{Name: "Jane Doe", Email: "jane@example.com", Password: "hash"})
+
+	// Only the listed fields are written
+	user.Name = "Jane Smith"
+	user.Password = "other"
+	require.NoError(t, repos.Users.Update(ctx, user, domain.UserFieldName))
+	assert.Equal(t, int64(2), user.Version)
+	got, err := repos.Users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Smith", got.Name)
+	assert.Equal(t, "hash", got.Password)
+	assert.Equal(t, int64(2), got.Version)
+
+	// Every field is written when none are listed
+	got.Email = "jane.smith@example.com"
+	got.AdminMetadata = map[string]any{"note": "vip"}
+	got.FailedLogins = 2
+	require.NoError(t, repos.Users.Update(ctx, got))
+	got, err = repos.Users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "jane.smith@example.com", got.Email)
+	assert.Equal(t, map[string]any{"note": "vip"}, got.AdminMetadata)
+	assert.Equal(t, 2, got.FailedLogins)
+	assert.Equal(t, int64(3), got.Version)
+	_, err = repos.Users.GetByEmail(ctx, "jane@example.com")
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+
+	// user is still at version 2
+	user.Name = "Stale"
+	assert.ErrorIs(t, repos.Users.Update(ctx, user, domain.UserFieldName), domain.ErrVersionConflict)
+	assert.Error(t, repos.Users.Update(ctx, got, "no_such_field"))
+
+	// AnyVersion writes whatever the stored version and reports the new one
+	user.Version = domain.AnyVersion
+	user.Name = "Jane Any"
+	require.NoError(t, repos.Users.Update(ctx, user, domain.UserFieldName))
+	assert.Equal(t, int64(4), user.Version)
+	got, err = repos.Users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Jane Any", got.Name)
+	assert.Equal(t, "jane.smith@example.com", got.Email)
+	assert.Equal(t, int64(4), got.Version)
+
+	missing := &domain.User{ID: missingUserID(t, repos), Version: domain.AnyVersion}
+	assert.ErrorIs(t, repos.Users.Update(ctx, missing, domain.UserFieldName), domain.ErrUserNotFound)
+}
+
+func testUserFailedLogins(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	user := createUser(t, repos, &domain.User{Name: "Jane Doe", Email: "jane@example.com"})
+
+	for want := 1; want <= 3; want++ {
+		failedLogins, err := repos.Users.IncrementFailedLogins(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, want, failedLogins)
+	}
+
+	until := now().Add(time.Hour)
+	require.NoError(t, repos.Users.ResetFailedLogins(ctx, user.ID, &until))
+	got, err := repos.Users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Zero(t, got.FailedLogins)
+	require.NotNil(t, got.LockedUntil)
+	assert.True(t, until.Equal(*got.LockedUntil))
+	// Neither touches the version, so they never conflict with an If-Match
+	assert.Equal(t, user.Version, got.Version)
+
+	require.NoError(t, repos.Users.ResetFailedLogins(ctx, user.ID, nil))
+	got, err = repos.Users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, got.LockedUntil)
+
+	id := missingUserID(t, repos)
+	_, err = repos.Users.IncrementFailedLogins(ctx, id)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	assert.ErrorIs(t, repos.Users.ResetFailedLogins(ctx, id, nil), domain.ErrUserNotFound)
+}
+
+func testUserDuplicateEmail(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	jane := createUser(t, repos, &domain.User{Name: "Jane Doe", Email: "jane@example.com"})
+
+	err := repos.Users.Create(ctx, &domain.User{Name: "Other Jane", Email: "jane@example.com"})
+	assert.ErrorIs(t, err, domain.ErrEmailTaken)
+
+	john := createUser(t, repos, &domain.User{Name: "John Doe", Email: "john@example.com"})
+	john.Email = "jane@example.com"
+	assert.ErrorIs(t, repos.Users.Update(ctx, john, domain.UserFieldEmail), domain.ErrEmailTaken)
+	got, err := repos.Users.GetByID(ctx, john.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "john@example.com", got.Email)
+
+	// The email of a soft deleted user can be taken, which then keeps that
+	// user from being restored
+	require.NoError(t, repos.Users.Delete(ctx, jane.ID, domain.AnyVersion))
+	newJane := createUser(t, repos, &domain.User{Name: "New Jane", Email: "jane@example.com"})
+	assert.ErrorIs(t, repos.Users.Restore(ctx, jane.ID), domain.ErrEmailTaken)
+	_, err = repos.Users.GetDeletedByID(ctx, jane.ID)
+	require.NoError(t, err)
+
+	require.NoError(t, repos.Users.Delete(ctx, newJane.ID, domain.AnyVersion))
+	require.NoError(t, repos.Users.Restore(ctx, jane.ID))
+}
+
+func testUserSoftDelete(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	user := createUser(t, repos, &domain.User{Name: "Jane Doe", Email: "jane@example.com"})
+
+	assert.ErrorIs(t, repos.Users.Delete(ctx, user.ID, user.Version+1), domain.ErrVersionConflict)
+	require.NoError(t, repos.Users.Delete(ctx, user.ID, user.Version))
+
+	_, err := repos.Users.GetByID(ctx, user.ID)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	_, err = repos.Users.GetByEmail(ctx, "jane@example.com")
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	count, err := repos.Users.Count(ctx, nil)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	deleted, err := repos.Users.GetDeletedByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, deleted.DeletedAt)
+	assert.Equal(t, int64(2), deleted.Version)
+	assert.ErrorIs(t, repos.Users.Purge(ctx, createUser(t, repos, &domain.User{Name: "Live", Email: "live@example.com"}).ID), domain.ErrUserNotFound)
+
+	require.NoError(t, repos.Users.Restore(ctx, user.ID))
+	restored, err := repos.Users.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, int64(3), restored.Version)
+
+	require.NoError(t, repos.Users.Delete(ctx, user.ID, domain.AnyVersion))
+	before, err := repos.Users.ListDeletedBefore(ctx, time.Now().Add(-time.Hour), 10)
+	require.NoError(t, err)
+	assert.Empty(t, before)
+	before, err = repos.Users.ListDeletedBefore(ctx, time.Now().Add(time.Second), 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{user.ID}, userIDs(before))
+
+	require.NoError(t, repos.Users.Purge(ctx, user.ID))
+	_, err = repos.Users.GetDeletedByID(ctx, user.ID)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+}
+
+func testUserFilters(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	start := now().Add(-time.Hour)
+	ann := createUser(t, repos, &domain.User{Name: "Ann Lee", Email: "ann@example.com", Role: domain.RoleAdmin, CreatedAt: start})
+	bob := createUser(t, repos, &domain.User{Name: "Bob Stone", Email: "bob@sample.org", Status: domain.UserStatusSuspended, CreatedAt: start.Add(time.Minute)})
+	carol := createUser(t, repos, &domain.User{Name: "Carol Ann", Email: "carol@example.com", Status: domain.UserStatusActive, Role: domain.RoleUser, CreatedAt: start.Add(2 * time.Minute)})
+
+	tests := []struct {
+		name   string
+		filter *domain.UserFilter
+		want   []string
+	}{
+		{"none", nil, []string{ann.ID, bob.ID, carol.ID}},
+		{"email prefix ignores case", &domain.UserFilter{EmailPrefix: "BOB@"}, []string{bob.ID}},
+		{"name prefix ignores case", &domain.UserFilter{NamePrefix: "car"}, []string{carol.ID}},
+		{"search matches words", &domain.UserFilter{Search: "ann"}, []string{ann.ID, carol.ID}},
+		{"search matches email words", &domain.UserFilter{Search: "sample"}, []string{bob.ID}},
+		{"created from", &domain.UserFilter{CreatedFrom: start.Add(time.Minute)}, []string{bob.ID, carol.ID}},
+		{"created to", &domain.UserFilter{CreatedTo: start.Add(time.Minute)}, []string{ann.ID, bob.ID}},
+		{"active includes users without a status", &domain.UserFilter{Status: domain.UserStatusActive}, []string{ann.ID, carol.ID}},
+		{"status", &domain.UserFilter{Status: domain.UserStatusSuspended}, []string{bob.ID}},
+		{"user role includes users without a role", &domain.UserFilter{Role: domain.RoleUser}, []string{bob.ID, carol.ID}},
+		{"role", &domain.UserFilter{Role: domain.RoleAdmin}, []string{ann.ID}},
+	}
+	for _, test := range tests {
+		users, err := repos.Users.List(ctx, test.filter, 0, 0)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, test.want, userIDs(users), test.name)
+		count, err := repos.Users.Count(ctx, test.filter)
+		require.NoError(t, err, test.name)
+		assert.Equal(t, int64(len(test.want)), count, test.name)
+	}
+}
+
+func testUserSortAndOffset(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	start := now().Add(-time.Hour)
+	var ids []string
+	for i, name := range []string{"Dana", "Abe", "Cleo", "Bea"} {
+		user := createUser(t, repos, &domain.User{Name: name, Email: name + "@example.com", CreatedAt: start.Add(time.Duration(i) * time.Minute)})
+		ids = append(ids, user.ID)
+	}
+
+	filter := &domain.UserFilter{Sort: []domain.SortField{{Field: "name", Desc: true}}}
+	users, total, err := repos.Users.ListAndCount(ctx, filter, 2, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.Equal(t, []string{ids[2], ids[3]}, userIDs(users))
+
+	users, err = repos.Users.List(ctx, &domain.UserFilter{Sort: []domain.SortField{{Field: "created_at", Desc: true}}}, 3, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{ids[3], ids[2], ids[1]}, userIDs(users))
+
+	users, total, err = repos.Users.ListAndCount(ctx, nil, 10, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), total)
+	assert.Empty(t, users)
+}
+
+func testUserCursor(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	start := now().Add(-time.Hour)
+	var users []*domain.User
+	for i, name := range []string{"Ann", "Bob", "Cleo", "Dana", "Eve"} {
+		// Two users share a creation time, so the ID breaks the tie
+		created := start.Add(time.Duration(min(i, 3)) * time.Minute)
+		users = append(users, createUser(t, repos, &domain.User{Name: name, Email: name + "@example.com", CreatedAt: created}))
+	}
+	cursorAt := func(user *domain.User, desc, backward bool) *domain.UserFilter {
+		return &domain.UserFilter{Cursor: &domain.UserCursor{CreatedAt: user.CreatedAt, ID: user.ID, Desc: desc, Backward: backward}}
+	}
+
+	// The offset is ignored and the total does not depend on the cursor
+	page, total, err := repos.Users.ListAndCount(ctx, cursorAt(users[1], false, false), 2, 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), total)
+	assert.Equal(t, userIDs(users[2:4]), userIDs(page))
+
+	page, err = repos.Users.List(ctx, cursorAt(users[3], false, false), 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, userIDs(users[4:]), userIDs(page))
+
+	page, err = repos.Users.List(ctx, cursorAt(users[4], false, true), 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, userIDs(users[2:4]), userIDs(page))
+
+	page, err = repos.Users.List(ctx, cursorAt(users[3], true, false), 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{users[2].ID, users[1].ID}, userIDs(page))
+
+	page, err = repos.Users.List(ctx, cursorAt(users[1], true, true), 2, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{users[3].ID, users[2].ID}, userIDs(page))
+}
+
+func testUserForEach(t *testing.T, repos *Repositories) {
+	ctx := context.Background()
+	start := now().Add(-time.Hour)
+	for i, name := range []string{"Ann", "Bob", "Cleo"} {
+		createUser(t, repos, &domain.User{Name: name, Email: name + "@example.com", Password: "hash", PasswordHistory: []string{"old"}, CreatedAt: start.Add(time.Duration(i) * time.Minute)})
+	}
+
+	var names []string
+	err := repos.Users.ForEach(ctx, &domain.UserFilter{Sort: []domain.SortField{{Field: "name", Desc: true}}}, func(user *domain.User) error {
+		assert.Empty(t, user.Password)
+		assert.Empty(t, user.PasswordHistory)
+		names = append(names, user.Name)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Cleo", "Bob", "Ann"}, names)
+
+	stop := errors.New("stop")
+	calls := 0
+	err = repos.Users.ForEach(ctx, nil, func(*domain.User) error {
+		calls++
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, 1, calls)
+}
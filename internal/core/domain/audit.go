@@ -0,0 +1,133 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// AuditEntry is one security event in the append-only audit log. Entries
+// are numbered without gaps and each one embeds the hash of the previous
+// entry, so edits and deletions can be detected.
+type AuditEntry struct {
+	ID        string            `json:"id"`
+	Seq       int64             `json:"seq"`
+	Time      time.Time         `json:"time"`
+	ActorID   string            `json:"actor_id,omitempty"`
+	TargetID  string            `json:"target_id,omitempty"`
+	Action    string            `json:"action"`
+	Outcome   string            `json:"outcome"`
+	IP        string            `json:"ip,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+	PrevHash  string            `json:"prev_hash"`
+	Hash      string            `json:"hash"`
+}
+
+// ComputeHash returns the SHA-256 of every field of the entry except ID and
+// Hash itself. Time is hashed at millisecond precision, which is what MongoDB
+// stores, and empty details are hashed like missing ones, since MongoDB
+// drops them.
+func (e *AuditEntry) ComputeHash() string {
+	details := e.Details
+	if len(details) == 0 {
+		details = nil
+	}
+	return e.hash(details)
+}
+
+// HashMatches reports whether Hash matches the content of the entry. Entries
+// without details written before empty details were hashed like missing ones
+// may have been hashed with an empty object, which is accepted too.
+func (e *AuditEntry) HashMatches() bool {
+	if e.Hash == e.ComputeHash() {
+		return true
+	}
+	return len(e.Details) == 0 && e.Hash == e.hash(map[string]string{})
+}
+
+func (e *AuditEntry) hash(details map[string]string) string {
+	payload, _ := json.Marshal(struct {
+		Seq       int64             `json:"seq"`
+		Time      string            `json:"time"`
+		ActorID   string            `json:"actor_id"`
+		TargetID  string            `json:"target_id"`
+		Action    string            `json:"action"`
+		Outcome   string            `json:"outcome"`
+		IP        string            `json:"ip"`
+		UserAgent string            `json:"user_agent"`
+		Details   map[string]string `json:"details"`
+		PrevHash  string            `json:"prev_hash"`
+	}{
+		Seq:       e.Seq,
+		Time:      e.Time.UTC().Truncate(time.Millisecond).Format(time.RFC3339Nano),
+		ActorID:   e.ActorID,
+		TargetID:  e.TargetID,
+		Action:    e.Action,
+		Outcome:   e.Outcome,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Details:   details,
+		PrevHash:  e.PrevHash,
+	})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// Audit actions
+const (
+	AuditActionRegister           = "user.register"
+	AuditActionLogin              = "auth.login"
+	AuditActionReauthenticate     = "auth.reauthenticate"
+	AuditActionUserUpdate         = "user.update"
+	AuditActionUserDelete         = "user.delete"
+	AuditActionUserRestore        = "user.restore"
+	AuditActionUserPurge          = "user.purge"
+	AuditActionUserImport         = "user.import"
+	AuditActionUserExport         = "user.export"
+	AuditActionDataExport         = "user.data_export"
+	AuditActionUserErasure        = "user.erasure"
+	AuditActionStatusChange       = "user.status_change"
+	AuditActionPasswordChange     = "user.password_change"
+	AuditActionEmailChange        = "user.email_change"
+	AuditActionMFAUpdate          = "user.mfa_update"
+	AuditActionImpersonationStart = "admin.impersonation_start"
+	AuditActionImpersonationStop  = "admin.impersonation_stop"
+)
+
+// Audit outcomes
+const (
+	AuditOutcomeSuccess = "success"
+	AuditOutcomeFailure = "failure"
+)
+
+// AuditEvent is what services report; the audit log adds the request
+// metadata and the hash chain.
+type AuditEvent struct {
+	Action   string
+	Outcome  string
+	TargetID string
+	// ActorID overrides the authenticated principal, for example on login
+	// where nobody is authenticated yet.
+	ActorID string
+	Details map[string]string
+}
+
+type AuditFilter struct {
+	ActorID  string
+	TargetID string
+	Action   string
+	Outcome  string
+	From     time.Time
+	To       time.Time
+	// Subject matches entries where the user is either the actor or the target
+	Subject string
+}
+
+// AuditVerification is the result of checking the audit log hash chain
+type AuditVerification struct {
+	Checked  int64    `json:"checked"`
+	Valid    bool     `json:"valid"`
+	Problems []string `json:"problems,omitempty"`
+}
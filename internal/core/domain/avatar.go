@@ -0,0 +1,60 @@
+package domain
+
+import (
+	"io"
+	"time"
+)
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
+
+// AvatarSize is one of the square sizes avatars are stored in
+type AvatarSize struct {
+	Name   string
+	Pixels int
+}
+
+// AvatarSizes lists the sizes generated for every uploaded avatar, the first
+// one being served by default
+var AvatarSizes = []AvatarSize{
+	{Name: "large", Pixels: 512},
+	{Name: "medium", Pixels: 128},
+	{Name: "small", Pixels: 48},
+}
+
+const (
+	// MaxAvatarUploadSize bounds the size of an uploaded avatar file
+	MaxAvatarUploadSize = 5 << 20
+	// MaxAvatarPixels bounds the dimensions of an uploaded avatar, checked
+	// before the image is decoded. Decoding takes up to 4 bytes per pixel,
+	// so this keeps an upload to about 64 MB of memory.
+	MaxAvatarPixels = 4096 * 4096
+)
+
+// IsValidAvatarSize reports whether name is one of AvatarSizes
+func IsValidAvatarSize(name string) bool {
+	for _, size := range AvatarSizes {
+		if size.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AvatarKey is the blob key of one size of a user's avatar. Each upload gets
+// a new version so that the URLs of older avatars can be cached forever.
+func AvatarKey(userID, version, size string) string {
+	return "avatars/" + userID + "/" + version + "/" + size + ".jpg"
+}
+
+// AvatarFile is an open avatar image, which the caller must close
+type AvatarFile struct {
+	Version string
+	Size    string
+	Info    *BlobInfo
+	Content io.ReadCloser
+}
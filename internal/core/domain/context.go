@@ -0,0 +1,28 @@
+package domain
+
+import "context"
+
+type requestInfoKey struct{}
+
+// RequestInfo describes who is making the current request and from where
+type RequestInfo struct {
+	IP        string
+	UserAgent string
+	// UserID is the effective user once the request is authenticated
+	UserID string
+	// ImpersonatorID is the admin behind the request when impersonating
+	ImpersonatorID string
+}
+
+// WithRequestInfo returns a copy of ctx carrying info
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom returns the request info stored in ctx, or an empty one
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	if info, ok := ctx.Value(requestInfoKey{}).(*RequestInfo); ok {
+		return info
+	}
+	return &RequestInfo{}
+}
@@ -0,0 +1,19 @@
+package domain
+
+// User fields that can be stored encrypted, named like their database fields
+const (
+	EncryptedFieldName         = "name"
+	EncryptedFieldEmail        = "email"
+	EncryptedFieldPendingEmail = "pending_email"
+	EncryptedFieldDisplayName  = "profile.display_name"
+	EncryptedFieldPhone        = "profile.phone"
+)
+
+// EncryptableUserFields lists every user field that can be stored encrypted
+var EncryptableUserFields = []string{
+	EncryptedFieldName,
+	EncryptedFieldEmail,
+	EncryptedFieldPendingEmail,
+	EncryptedFieldDisplayName,
+	EncryptedFieldPhone,
+}
@@ -5,3 +5,33 @@ import (
 )
 
 var ErrExample = errors.New("Example")
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrSessionInvalid     = errors.New("session is invalid or has been revoked")
+	ErrWeakPassword       = errors.New("password does not meet the password policy")
+	ErrPasswordReused     = errors.New("password was used recently and cannot be reused")
+	ErrEmailTaken         = errors.New("email address is already in use")
+	ErrTokenInvalid       = errors.New("token is invalid or has expired")
+	ErrTokenUsed          = errors.New("token has already been used")
+	ErrAccountLocked      = errors.New("account is temporarily locked")
+	ErrRateLimited        = errors.New("too many requests, try again later")
+	ErrInvalidMFACode     = errors.New("invalid verification code")
+	ErrMFAMethodInvalid   = errors.New("second factor method is not supported or not enabled")
+	ErrForbidden          = errors.New("operation not permitted")
+	ErrNotImpersonating   = errors.New("session is not an impersonation")
+	ErrAuditConflict      = errors.New("audit entry sequence number already taken")
+	ErrAccountInactive    = errors.New("account is not active")
+	ErrInvalidStatus      = errors.New("invalid account status")
+	ErrInvalidSort        = errors.New("invalid sort")
+	ErrVersionConflict    = errors.New("resource has been modified since it was read")
+	ErrInvalidProfile     = errors.New("invalid profile")
+	ErrInvalidImage       = errors.New("image is corrupt or in an unsupported format")
+	ErrBlobNotFound       = errors.New("blob not found")
+	ErrInvalidImport      = errors.New("invalid import file")
+	ErrInvalidExport      = errors.New("invalid export")
+	ErrEncryptedField     = errors.New("field is stored encrypted and cannot be searched or sorted")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrTokenNotFound      = errors.New("token not found")
+)
@@ -0,0 +1,19 @@
+package domain
+
+import "time"
+
+// LoginEvent is one sign-in attempt on a user's account
+type LoginEvent struct {
+	ID      string    `json:"id"`
+	UserID  string    `json:"-"`
+	Time    time.Time `json:"time"`
+	Success bool      `json:"success"`
+	// Reason explains a failed attempt
+	Reason string `json:"reason,omitempty"`
+	// Methods are the authentication methods of a successful attempt
+	Methods   []string `json:"methods,omitempty"`
+	IP        string   `json:"ip,omitempty"`
+	UserAgent string   `json:"user_agent,omitempty"`
+	// DeviceID is a fingerprint of the user agent used to spot new devices
+	DeviceID string `json:"device_id"`
+}
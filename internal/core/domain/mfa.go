@@ -0,0 +1,30 @@
+package domain
+
+import "slices"
+
+// Second factor methods
+const (
+	MFAMethodEmail = "email"
+)
+
+// SupportedMFAMethods lists the second factors a user can enable
+var SupportedMFAMethods = []string{MFAMethodEmail}
+
+func IsSupportedMFAMethod(method string) bool {
+	return slices.Contains(SupportedMFAMethods, method)
+}
+
+// MFARequiredError is returned by a login whose password was correct but that
+// still has to be completed with a second factor.
+type MFARequiredError struct {
+	// Token identifies the pending login when verifying the code
+	Token string
+	// Method is the factor the code was sent with
+	Method string
+	// Methods are all the factors the user can fall back to
+	Methods []string
+}
+
+func (e *MFARequiredError) Error() string {
+	return "second factor required"
+}
@@ -0,0 +1,17 @@
+package domain
+
+// Page is one page of a listing together with what clients need to fetch the
+// others.
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// Total is how many items match the listing's filters across all pages
+	Total  int64 `json:"total"`
+	Limit  int64 `json:"limit"`
+	Offset int64 `json:"offset"`
+	// NextCursor and PrevCursor continue the listing from this page when it
+	// supports cursor pagination
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	// HasMore reports whether a page follows this one
+	HasMore bool `json:"has_more"`
+}
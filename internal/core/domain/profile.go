@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+// Metadata sections
+const (
+	MetadataSectionUser  = "user"
+	MetadataSectionAdmin = "admin"
+)
+
+// MaxMetadataSize bounds the JSON encoded size of a metadata section
+const MaxMetadataSize = 16 << 10
+
+var phonePattern = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+
+// ProfileValidationError lists why a profile or metadata change was rejected
+type ProfileValidationError struct {
+	Problems []string
+}
+
+func (e *ProfileValidationError) Error() string {
+	return "invalid profile: " + strings.Join(e.Problems, "; ")
+}
+
+func (e *ProfileValidationError) Unwrap() error {
+	return ErrInvalidProfile
+}
+
+// ValidateProfile checks the format of every profile field that is set.
+func ValidateProfile(profile *UserProfile) error {
+	var problems []string
+	if utf8.RuneCountInString(profile.DisplayName) > 100 {
+		problems = append(problems, "display_name must be at most 100 characters long")
+	}
+	if profile.Locale != "" {
+		if _, err := language.Parse(profile.Locale); err != nil {
+			problems = append(problems, fmt.Sprintf("locale %q is not a valid BCP 47 language tag", profile.Locale))
+		}
+	}
+	if profile.Timezone != "" {
+		if _, err := time.LoadLocation(profile.Timezone); err != nil || profile.Timezone == "Local" {
+			problems = append(problems, fmt.Sprintf("timezone %q is not a known IANA time zone", profile.Timezone))
+		}
+	}
+	if profile.AvatarURL != "" {
+		u, err := url.Parse(profile.AvatarURL)
+		// Uploaded avatars are served by this API under a root-relative URL
+		absolute := err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+		local := err == nil && u.Scheme == "" && u.Host == "" && strings.HasPrefix(u.Path, "/")
+		if (!absolute && !local) || len(profile.AvatarURL) > 2048 {
+			problems = append(problems, "avatar_url must be an http or https URL")
+		}
+	}
+	if profile.Phone != "" && !phonePattern.MatchString(profile.Phone) {
+		problems = append(problems, "phone must be in E.164 format, for example +33612345678")
+	}
+	if len(problems) > 0 {
+		return &ProfileValidationError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,7 @@
+package domain
+
+// User roles. Users without a role are regular users.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
@@ -0,0 +1,18 @@
+package domain
+
+import "time"
+
+type Session struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	// ImpersonatorID is set when an admin is acting as the user
+	ImpersonatorID string `json:"impersonator_id,omitempty"`
+}
+
+// IsActive reports whether the session can still be used to authenticate requests.
+func (s *Session) IsActive(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
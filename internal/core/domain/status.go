@@ -0,0 +1,39 @@
+package domain
+
+import (
+	"slices"
+	"time"
+)
+
+// Account statuses. Users without a status are active.
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusBanned    = "banned"
+	// UserStatusPending is an account that has not been activated yet
+	UserStatusPending = "pending"
+)
+
+// UserStatuses lists every account status an admin can set
+var UserStatuses = []string{UserStatusActive, UserStatusSuspended, UserStatusBanned, UserStatusPending}
+
+func IsValidUserStatus(status string) bool {
+	return slices.Contains(UserStatuses, status)
+}
+
+// AccountStatusError is returned when a user whose account is not active
+// tries to sign in or to use a token.
+type AccountStatusError struct {
+	Status string
+	Reason string
+	// Until is when a suspension ends, if it ends on its own
+	Until *time.Time
+}
+
+func (e *AccountStatusError) Error() string {
+	return "account is " + e.Status
+}
+
+func (e *AccountStatusError) Unwrap() error {
+	return ErrAccountInactive
+}
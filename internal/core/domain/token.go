@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// OneTimeToken is a single-use secret sent to a user, such as an email
+// confirmation link. Only the SHA-256 hash of the secret is stored.
+type OneTimeToken struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"user_id"`
+	Purpose   string            `json:"purpose"`
+	TokenHash string            `json:"-"`
+	Data      map[string]string `json:"-"`
+	Attempts  int               `json:"-"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	UsedAt    *time.Time        `json:"used_at,omitempty"`
+}
+
+// One-time token purposes
+const (
+	TokenPurposeEmailChangeConfirm = "email_change_confirm"
+	TokenPurposeEmailChangeCancel  = "email_change_cancel"
+	TokenPurposeMagicLink          = "magic_link"
+	TokenPurposeMFAChallenge       = "mfa_challenge"
+	TokenPurposeErasureConfirm     = "erasure_confirm"
+)
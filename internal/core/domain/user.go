@@ -1,5 +1,62 @@
 package domain
 
-import "github.com/nisibz/go-auth-tests/internal/adapter/storeages/mongodb/models"
+import "time"
 
-type User = models.User
+// User is an account. IDs are opaque strings assigned by the storage backend.
+type User struct {
+	ID      string
+	Name    string
+	Email   string
+	Profile UserProfile
+	// Metadata is free-form data the user can edit, AdminMetadata can only
+	// be read and changed by admins
+	Metadata          map[string]any
+	AdminMetadata     map[string]any
+	PendingEmail      string
+	Role              string
+	Status            string
+	StatusReason      string
+	StatusUntil       *time.Time
+	Password          string
+	PasswordHistory   []string
+	PasswordChangedAt *time.Time
+	FailedLogins      int
+	LockedUntil       *time.Time
+	MFAMethods        []string
+	PreferredMFA      string
+	CreatedAt         time.Time
+	// Version is incremented on every write, for optimistic concurrency
+	Version   int64
+	DeletedAt *time.Time
+	// Avatar is the version of the uploaded avatar, if any
+	Avatar string
+}
+
+// UserProfile holds optional details about the user
+type UserProfile struct {
+	DisplayName string
+	// Locale is a BCP 47 language tag such as "en-US"
+	Locale string
+	// Timezone is an IANA time zone name such as "Europe/Paris"
+	Timezone  string
+	AvatarURL string
+	// Phone is in E.164 format, for example "+33612345678"
+	Phone string
+}
+
+// IsLocked reports whether too many failed logins have temporarily locked the account.
+func (u *User) IsLocked(now time.Time) bool {
+	return u.LockedUntil != nil && now.Before(*u.LockedUntil)
+}
+
+// CurrentStatus returns the account status at now. Users without a status are
+// active, and a suspension with an end time is over once that time has passed.
+func (u *User) CurrentStatus(now time.Time) string {
+	switch {
+	case u.Status == "":
+		return UserStatusActive
+	case u.Status == UserStatusSuspended && u.StatusUntil != nil && !now.Before(*u.StatusUntil):
+		return UserStatusActive
+	}
+	return u.Status
+}
@@ -0,0 +1,51 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Export file formats. ExportFormatExcel is CSV that spreadsheet programs
+// open without garbling accents or evaluating cells as formulas, while
+// ExportFormatCSV keeps every value as stored.
+const (
+	ExportFormatCSV    = "csv"
+	ExportFormatExcel  = "excel"
+	ExportFormatNDJSON = "ndjson"
+)
+
+// ExportColumns lists the user fields an export can include. Secrets such as
+// the password hash are deliberately absent.
+var ExportColumns = []string{
+	"id", "name", "email", "pending_email", "role", "status", "status_reason", "status_until",
+	"display_name", "locale", "timezone", "phone", "avatar_url", "metadata", "mfa_methods", "created_at",
+}
+
+// DefaultExportColumns are exported when no columns are requested
+var DefaultExportColumns = []string{"id", "name", "email", "role", "status", "created_at"}
+
+type ExportOptions struct {
+	Format  string
+	Columns []string
+}
+
+// ParseExportColumns reads a comma separated list of columns, returning the
+// default columns for an empty list.
+func ParseExportColumns(spec string) ([]string, error) {
+	if strings.TrimSpace(spec) == "" {
+		return DefaultExportColumns, nil
+	}
+	var columns []string
+	for _, column := range strings.Split(spec, ",") {
+		column = strings.TrimSpace(column)
+		if !slices.Contains(ExportColumns, column) {
+			return nil, fmt.Errorf("%w: unknown column %q, expected some of %s", ErrInvalidExport, column, strings.Join(ExportColumns, ", "))
+		}
+		if slices.Contains(columns, column) {
+			return nil, fmt.Errorf("%w: column %q is listed twice", ErrInvalidExport, column)
+		}
+		columns = append(columns, column)
+	}
+	return columns, nil
+}
@@ -0,0 +1,73 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// UserFilter narrows down a user listing. Empty fields match every user.
+type UserFilter struct {
+	// EmailPrefix and NamePrefix match the start of the field, ignoring case
+	EmailPrefix string
+	NamePrefix  string
+	// Search is a full-text search over name and email
+	Search      string
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Status      string
+	Role        string
+	Sort        []SortField
+	// Cursor switches to keyset pagination, ignoring Sort and the offset
+	Cursor *UserCursor
+}
+
+// UserCursor is a position in a user listing sorted by created_at then ID,
+// used for keyset pagination
+type UserCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+	// Desc is set when the listing is sorted newest first
+	Desc bool `json:"d,omitempty"`
+	// Backward pages towards the start of the listing, returning the users
+	// just before the position instead of just after it
+	Backward bool `json:"b,omitempty"`
+}
+
+// SortField is one key of a multi-field sort
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// UserSortFields lists the fields users can be sorted by
+var UserSortFields = []string{"name", "email", "created_at"}
+
+// SupportsUserCursor reports whether a user listing with the given sort can
+// be paged with a UserCursor, which is keyed on the creation date.
+func SupportsUserCursor(sort []SortField) bool {
+	return len(sort) == 0 || (len(sort) == 1 && sort[0].Field == "created_at")
+}
+
+// ParseSort reads a comma separated sort specification such as
+// "-created_at,name", where a leading minus sorts in descending order. Only
+// fields in allowed are accepted.
+func ParseSort(spec string, allowed []string) ([]SortField, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	var fields []SortField
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		field := SortField{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if !slices.Contains(allowed, field.Field) {
+			return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidSort, field.Field)
+		}
+		if slices.ContainsFunc(fields, func(f SortField) bool { return f.Field == field.Field }) {
+			return nil, fmt.Errorf("%w: %q is listed twice", ErrInvalidSort, field.Field)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
@@ -0,0 +1,78 @@
+package domain
+
+// Import file formats
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+)
+
+// What an import does with rows whose email already belongs to a user
+const (
+	ImportOnDuplicateSkip   = "skip"
+	ImportOnDuplicateUpsert = "upsert"
+)
+
+// Outcomes of an import row
+const (
+	ImportActionCreated = "created"
+	ImportActionUpdated = "updated"
+	ImportActionSkipped = "skipped"
+	ImportActionInvalid = "invalid"
+	ImportActionFailed  = "failed"
+)
+
+// ImportColumns lists the fields an import row can set. Name and email are
+// required, the other ones optional.
+var ImportColumns = []string{"name", "email", "password", "role", "status", "display_name", "locale", "timezone", "phone"}
+
+type ImportOptions struct {
+	Format string
+	// OnDuplicate is ImportOnDuplicateSkip or ImportOnDuplicateUpsert
+	OnDuplicate string
+	// DryRun validates every row and reports what would happen without
+	// writing anything
+	DryRun bool
+	// SendInvites emails every created user a sign-in link
+	SendInvites bool
+}
+
+// ImportRow is one user read from an import file
+type ImportRow struct {
+	Line   int
+	Fields map[string]string
+}
+
+type ImportRowResult struct {
+	Line   int      `json:"line"`
+	Email  string   `json:"email,omitempty"`
+	Action string   `json:"action"`
+	UserID string   `json:"user_id,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+type ImportReport struct {
+	DryRun  bool               `json:"dry_run"`
+	Created int                `json:"created"`
+	Updated int                `json:"updated"`
+	Skipped int                `json:"skipped"`
+	Invalid int                `json:"invalid"`
+	Failed  int                `json:"failed"`
+	Rows    []*ImportRowResult `json:"rows"`
+}
+
+// Add records the result of a row and counts it
+func (r *ImportReport) Add(result *ImportRowResult) {
+	switch result.Action {
+	case ImportActionCreated:
+		r.Created++
+	case ImportActionUpdated:
+		r.Updated++
+	case ImportActionSkipped:
+		r.Skipped++
+	case ImportActionInvalid:
+		r.Invalid++
+	case ImportActionFailed:
+		r.Failed++
+	}
+	r.Rows = append(r.Rows, result)
+}
@@ -0,0 +1,63 @@
+package domain
+
+// UserPatch lists the profile changes requested by a partial update. Nil
+// fields are left untouched.
+type UserPatch struct {
+	Name    *string
+	Email   *string
+	Profile *ProfilePatch
+	// Metadata is a JSON merge patch (RFC 7396) of the user's metadata, where
+	// nil values remove keys
+	Metadata map[string]any
+}
+
+// ProfilePatch lists the profile fields to change. An empty string clears
+// the field.
+type ProfilePatch struct {
+	DisplayName *string
+	Locale      *string
+	Timezone    *string
+	AvatarURL   *string
+	Phone       *string
+}
+
+// Apply returns profile with the patched fields replaced
+func (p *ProfilePatch) Apply(profile UserProfile) UserProfile {
+	for _, field := range []struct{ target, value *string }{
+		{&profile.DisplayName, p.DisplayName},
+		{&profile.Locale, p.Locale},
+		{&profile.Timezone, p.Timezone},
+		{&profile.AvatarURL, p.AvatarURL},
+		{&profile.Phone, p.Phone},
+	} {
+		if field.value != nil {
+			*field.target = *field.value
+		}
+	}
+	return profile
+}
+
+// AnyVersion skips the version check of writes guarded by optimistic
+// concurrency
+const AnyVersion int64 = -1
+
+// User fields that UserRepository.Update can write on their own
+const (
+	UserFieldName          = "name"
+	UserFieldEmail         = "email"
+	UserFieldPendingEmail  = "pending_email"
+	UserFieldProfile       = "profile"
+	UserFieldMetadata      = "metadata"
+	UserFieldAdminMetadata = "admin_metadata"
+	UserFieldAvatar        = "avatar"
+
+	UserFieldRole              = "role"
+	UserFieldStatus            = "status"
+	UserFieldStatusReason      = "status_reason"
+	UserFieldStatusUntil       = "status_until"
+	UserFieldPassword          = "password"
+	UserFieldPasswordHistory   = "password_history"
+	UserFieldPasswordChangedAt = "password_changed_at"
+	UserFieldMFAMethods        = "mfa_methods"
+	UserFieldPreferredMFA      = "preferred_mfa"
+)
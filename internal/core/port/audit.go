@@ -0,0 +1,28 @@
+package port
+
+import (
+	"context"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// AuditLogger records security events. Failures are logged rather than
+// returned so that auditing never breaks the operation being audited.
+type AuditLogger interface {
+	Record(ctx context.Context, event *domain.AuditEvent)
+}
+
+type AuditService interface {
+	AuditLogger
+	List(ctx context.Context, filter *domain.AuditFilter, limit, offset int64) ([]*domain.AuditEntry, error)
+	Verify(ctx context.Context) (*domain.AuditVerification, error)
+}
+
+// AuditRepository is append-only: entries are never updated or deleted.
+type AuditRepository interface {
+	Append(ctx context.Context, entry *domain.AuditEntry) error
+	Last(ctx context.Context) (*domain.AuditEntry, error)
+	List(ctx context.Context, filter *domain.AuditFilter, limit, offset int64) ([]*domain.AuditEntry, error)
+	// Iterate calls fn for every entry in sequence order
+	Iterate(ctx context.Context, fn func(*domain.AuditEntry) error) error
+}
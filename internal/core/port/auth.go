@@ -1,6 +1,20 @@
 package port
 
+import (
+	"context"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
 type AuthService interface {
-	Register(name, email, password string) (string, error)
-	Login(email, password string) (string, error)
+	Register(ctx context.Context, name, email, password string) (string, error)
+	Login(ctx context.Context, email, password string) (string, error)
+	RequestMagicLink(ctx context.Context, email string) error
+	ConsumeMagicLink(ctx context.Context, token string) (string, error)
+	VerifyMFA(ctx context.Context, mfaToken, code string) (string, error)
+	ResendMFACode(ctx context.Context, mfaToken, method string) error
+	Reauthenticate(ctx context.Context, claims *util.Claims, password string) (string, error)
+	Impersonate(ctx context.Context, actor *domain.User, targetID string) (string, *domain.Session, error)
+	StopImpersonation(ctx context.Context, claims *util.Claims) error
 }
@@ -0,0 +1,18 @@
+package port
+
+import (
+	"context"
+	"io"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// BlobStore keeps binary files such as avatars under string keys
+type BlobStore interface {
+	// Put stores data under key, replacing any previous blob
+	Put(ctx context.Context, key, contentType string, data io.Reader) error
+	// Open fails with domain.ErrBlobNotFound when there is no blob under key
+	Open(ctx context.Context, key string) (io.ReadCloser, *domain.BlobInfo, error)
+	// Delete removes the blob under key, if any
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,19 @@
+package port
+
+// FieldEncryptor encrypts individual fields of stored records and computes
+// blind indexes so that encrypted fields can still be looked up by value.
+type FieldEncryptor interface {
+	// Encrypts reports whether the field is configured to be stored encrypted
+	Encrypts(field string) bool
+	// Encrypt seals value with the primary key. Empty values stay empty.
+	Encrypt(field, value string) (string, error)
+	// Decrypt opens a value sealed with any known key and returns values
+	// that were never encrypted unchanged
+	Decrypt(field, value string) (string, error)
+	// EncryptedPrefix is how every encrypted value starts, and
+	// CurrentPrefix how every value sealed with the primary key starts
+	EncryptedPrefix() string
+	CurrentPrefix() string
+	// BlindIndex returns a keyed hash of value that is equal for equal values
+	BlindIndex(field, value string) string
+}
@@ -0,0 +1,19 @@
+package port
+
+import (
+	"context"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type LoginHistoryRepository interface {
+	Create(ctx context.Context, event *domain.LoginEvent) error
+	ListByUser(ctx context.Context, userID string, limit, offset int64) ([]*domain.LoginEvent, error)
+	// HasDevice reports whether the user ever signed in successfully from the device
+	HasDevice(ctx context.Context, userID, deviceID string) (bool, error)
+	// CountSuccessful returns how many successful logins the user has on record
+	CountSuccessful(ctx context.Context, userID string) (int64, error)
+	// Prune keeps only the keep most recent events of the user
+	Prune(ctx context.Context, userID string, keep int64) error
+	DeleteByUser(ctx context.Context, userID string) error
+}
@@ -0,0 +1,11 @@
+package port
+
+import (
+	"context"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type Mailer interface {
+	Send(ctx context.Context, email *domain.Email) error
+}
@@ -0,0 +1,15 @@
+package port
+
+import "encoding/json"
+
+// MetadataValidator checks user metadata against the schema configured for
+// the deployment. section is domain.MetadataSectionUser or
+// domain.MetadataSectionAdmin.
+type MetadataValidator interface {
+	// Validate returns a *domain.ProfileValidationError listing every
+	// violation of the schema
+	Validate(section string, metadata map[string]any) error
+	// Schema returns the JSON schema of the section, or nil when any object
+	// is accepted
+	Schema(section string) json.RawMessage
+}
@@ -0,0 +1,16 @@
+package port
+
+import (
+	"context"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *domain.Session) error
+	GetByID(ctx context.Context, id string) (*domain.Session, error)
+	Revoke(ctx context.Context, id string) error
+	RevokeAllForUser(ctx context.Context, userID, exceptID string) (int64, error)
+	ListByUser(ctx context.Context, userID string) ([]*domain.Session, error)
+	DeleteByUser(ctx context.Context, userID string) error
+}
@@ -0,0 +1,18 @@
+package port
+
+import (
+	"context"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+type OneTimeTokenRepository interface {
+	Create(ctx context.Context, token *domain.OneTimeToken) error
+	GetByHash(ctx context.Context, purpose, tokenHash string) (*domain.OneTimeToken, error)
+	MarkUsed(ctx context.Context, id string) error
+	// Update writes the token's data and expiry. Attempts are left alone,
+	// they only grow through IncrementAttempts.
+	Update(ctx context.Context, token *domain.OneTimeToken) error
+	IncrementAttempts(ctx context.Context, id string) (int, error)
+	DeleteByUser(ctx context.Context, userID string, purposes ...string) error
+}
@@ -2,16 +2,48 @@ package port
 
 import (
 	"context"
+	"encoding/json"
+	"io"
+	"time"
 
 	"github.com/nisibz/go-auth-tests/internal/core/domain"
 )
 
 type UserService interface {
 	CreateUser(ctx context.Context, name, email, password string) (*domain.User, error)
+	ImportUsers(ctx context.Context, r io.Reader, opts *domain.ImportOptions) (*domain.ImportReport, error)
+	// ExportUsers writes every user matching filter to w and returns how
+	// many were written
+	ExportUsers(ctx context.Context, w io.Writer, filter *domain.UserFilter, opts *domain.ExportOptions) (int64, error)
 	GetUserByID(ctx context.Context, id string) (*domain.User, error)
-	ListUsers(ctx context.Context, limit, offset int64) ([]*domain.User, error)
-	UpdateUser(ctx context.Context, id, name, email string) (*domain.User, error)
-	DeleteUser(ctx context.Context, id string) error
+	ListUsers(ctx context.Context, filter *domain.UserFilter, limit, offset int64) (*domain.Page[*domain.User], error)
+	// Writes through UserService take the version the caller last read, or
+	// domain.AnyVersion, and fail with domain.ErrVersionConflict when the
+	// user has changed since.
+	UpdateUser(ctx context.Context, id string, version int64, name, email string) (*domain.User, error)
+	PatchUser(ctx context.Context, id string, version int64, patch *domain.UserPatch) (*domain.User, error)
+	// UpdateAdminMetadata applies a JSON merge patch to the metadata only
+	// admins can see
+	UpdateAdminMetadata(ctx context.Context, id string, version int64, patch map[string]any) (*domain.User, error)
+	MetadataSchema(section string) json.RawMessage
+	UploadAvatar(ctx context.Context, userID string, image io.Reader) (*domain.User, error)
+	DeleteAvatar(ctx context.Context, userID string) error
+	OpenAvatar(ctx context.Context, userID, size string) (*domain.AvatarFile, error)
+	ConfirmEmailChange(ctx context.Context, token string) (*domain.User, error)
+	CancelEmailChange(ctx context.Context, token string) error
+	ChangePassword(ctx context.Context, id, currentSessionID, currentPassword, newPassword string) error
+	UpdateMFASettings(ctx context.Context, id, password string, methods []string, preferred string) (*domain.User, error)
+	ListLoginHistory(ctx context.Context, userID string, limit, offset int64) ([]*domain.LoginEvent, error)
+	DeleteUser(ctx context.Context, id string, version int64) error
+	// ExportPersonalData writes a zip archive of everything stored about
+	// the user to w
+	ExportPersonalData(ctx context.Context, userID string, w io.Writer) error
+	// RequestErasure emails the user a link to confirm the erasure of their
+	// account, which ConfirmErasure carries out
+	RequestErasure(ctx context.Context, userID string) error
+	ConfirmErasure(ctx context.Context, token string) error
+	RestoreUser(ctx context.Context, id string) (*domain.User, error)
+	SetUserStatus(ctx context.Context, id string, version int64, status, reason string, until *time.Time) (*domain.User, error)
 	CountUsers(ctx context.Context) (int64, error)
 }
 
@@ -19,8 +51,36 @@ type UserRepository interface {
 	Create(ctx context.Context, user *domain.User) error
 	GetByID(ctx context.Context, id string) (*domain.User, error)
 	GetByEmail(ctx context.Context, email string) (*domain.User, error)
-	Update(ctx context.Context, user *domain.User) error
-	Delete(ctx context.Context, id string) error
-	List(ctx context.Context, limit, offset int64) ([]*domain.User, error)
-	Count(ctx context.Context) (int64, error)
+	// Update writes the given fields of the user (see domain.UserFieldName),
+	// or all of them when none are listed, and increments its version. It
+	// fails with domain.ErrVersionConflict when the stored user has a
+	// different version than user, unless user.Version is
+	// domain.AnyVersion: then the fields are written whatever the stored
+	// version, user.Version is set to the new one, and a missing user fails
+	// with domain.ErrUserNotFound.
+	Update(ctx context.Context, user *domain.User, fields ...string) error
+	// IncrementFailedLogins atomically counts a wrong password and returns
+	// the new total. Like ResetFailedLogins, it leaves the version alone.
+	IncrementFailedLogins(ctx context.Context, id string) (int, error)
+	// ResetFailedLogins clears the failed login count and sets lockedUntil,
+	// nil when the account is not locked
+	ResetFailedLogins(ctx context.Context, id string, lockedUntil *time.Time) error
+	// Delete soft deletes the user, hiding it from every other read. Unless
+	// version is domain.AnyVersion the user must still be at that version.
+	Delete(ctx context.Context, id string, version int64) error
+	GetDeletedByID(ctx context.Context, id string) (*domain.User, error)
+	Restore(ctx context.Context, id string) error
+	ListDeletedBefore(ctx context.Context, before time.Time, limit int64) ([]*domain.User, error)
+	// Purge permanently removes a soft deleted user
+	Purge(ctx context.Context, id string) error
+	List(ctx context.Context, filter *domain.UserFilter, limit, offset int64) ([]*domain.User, error)
+	// Count returns how many users match filter, or all users when it is nil
+	Count(ctx context.Context, filter *domain.UserFilter) (int64, error)
+	// ListAndCount combines List and Count, concurrently or in a single
+	// query where the storage supports it
+	ListAndCount(ctx context.Context, filter *domain.UserFilter, limit, offset int64) ([]*domain.User, int64, error)
+	// ForEach calls fn with every user matching filter, in the filter's
+	// order, reading them one at a time. It stops at the first error fn
+	// returns. Password hashes are not loaded.
+	ForEach(ctx context.Context, filter *domain.UserFilter, fn func(*domain.User) error) error
 }
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// SetUserStatus changes the status of an account. until is only allowed for
+// suspensions, which then lift by themselves. Every session of a user who is
+// no longer active is revoked so that their tokens stop working right away.
+func (s *UserService) SetUserStatus(ctx context.Context, id string, version int64, status, reason string, until *time.Time) (*domain.User, error) {
+	if !domain.IsValidUserStatus(status) {
+		return nil, fmt.Errorf("%w: %q", domain.ErrInvalidStatus, status)
+	}
+	if until != nil && (status != domain.UserStatusSuspended || !until.After(time.Now())) {
+		return nil, fmt.Errorf("%w: an end time must be in the future and is only allowed for suspensions", domain.ErrInvalidStatus)
+	}
+	if domain.RequestInfoFrom(ctx).UserID == id {
+		return nil, fmt.Errorf("%w: cannot change the status of your own account", domain.ErrForbidden)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for status change: %w", err)
+	}
+	if err := checkVersion(user, version); err != nil {
+		return nil, err
+	}
+
+	user.Status = status
+	user.StatusReason = reason
+	user.StatusUntil = until
+	if status == domain.UserStatusActive {
+		user.StatusReason = ""
+	}
+
+	if err := s.userRepo.Update(ctx, user, domain.UserFieldStatus, domain.UserFieldStatusReason, domain.UserFieldStatusUntil); err != nil {
+		return nil, fmt.Errorf("failed to update user status: %w", err)
+	}
+
+	if status != domain.UserStatusActive {
+		if _, err := s.sessionRepo.RevokeAllForUser(ctx, id, ""); err != nil {
+			return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+	}
+
+	details := map[string]string{"status": status}
+	if user.StatusReason != "" {
+		details["reason"] = user.StatusReason
+	}
+	if until != nil {
+		details["until"] = until.UTC().Format(time.RFC3339)
+	}
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionStatusChange,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: id,
+		Details:  details,
+	})
+	return user, nil
+}
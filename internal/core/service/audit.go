@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/port"
+)
+
+// auditAppendRetries bounds how often Record retries when another writer
+// took the next sequence number first.
+const auditAppendRetries = 5
+
+type AuditService struct {
+	auditRepo port.AuditRepository
+	// mu serializes writers of this process; writers in other processes are
+	// handled by retrying on sequence conflicts.
+	mu sync.Mutex
+}
+
+func NewAuditService(auditRepo port.AuditRepository) *AuditService {
+	return &AuditService{auditRepo: auditRepo}
+}
+
+// Record appends the event to the audit log, filling in the actor, IP and
+// user agent from the request info in ctx.
+func (s *AuditService) Record(ctx context.Context, event *domain.AuditEvent) {
+	info := domain.RequestInfoFrom(ctx)
+	entry := &domain.AuditEntry{
+		Time:      time.Now().UTC().Truncate(time.Millisecond),
+		ActorID:   event.ActorID,
+		TargetID:  event.TargetID,
+		Action:    event.Action,
+		Outcome:   event.Outcome,
+		IP:        info.IP,
+		UserAgent: info.UserAgent,
+	}
+	// Empty details are stored as missing, which is how MongoDB reads them
+	if len(event.Details) > 0 {
+		entry.Details = event.Details
+	}
+	if entry.ActorID == "" {
+		entry.ActorID = info.UserID
+	}
+	// The admin is the real actor of anything done while impersonating.
+	if info.ImpersonatorID != "" {
+		entry.ActorID = info.ImpersonatorID
+		if entry.Details == nil {
+			entry.Details = map[string]string{}
+		}
+		entry.Details["on_behalf_of"] = info.UserID
+	}
+
+	if err := s.append(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "Failed to write audit entry", "action", entry.Action, "error", err)
+	}
+}
+
+func (s *AuditService) append(ctx context.Context, entry *domain.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for range auditAppendRetries {
+		last, err := s.auditRepo.Last(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read last audit entry: %w", err)
+		}
+		entry.Seq = 1
+		entry.PrevHash = ""
+		if last != nil {
+			entry.Seq = last.Seq + 1
+			entry.PrevHash = last.Hash
+		}
+		entry.Hash = entry.ComputeHash()
+
+		err = s.auditRepo.Append(ctx, entry)
+		if !errors.Is(err, domain.ErrAuditConflict) {
+			return err
+		}
+	}
+	return domain.ErrAuditConflict
+}
+
+func (s *AuditService) List(ctx context.Context, filter *domain.AuditFilter, limit, offset int64) ([]*domain.AuditEntry, error) {
+	entries, err := s.auditRepo.List(ctx, filter, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit entries: %w", err)
+	}
+	return entries, nil
+}
+
+// Verify walks the whole audit log and reports missing entries, entries
+// whose content no longer matches their hash, and broken links between
+// consecutive entries.
+func (s *AuditService) Verify(ctx context.Context) (*domain.AuditVerification, error) {
+	result := &domain.AuditVerification{}
+	var prev *domain.AuditEntry
+	err := s.auditRepo.Iterate(ctx, func(entry *domain.AuditEntry) error {
+		result.Checked++
+
+		expectedSeq := int64(1)
+		expectedPrevHash := ""
+		if prev != nil {
+			expectedSeq = prev.Seq + 1
+			expectedPrevHash = prev.Hash
+		}
+
+		if entry.Seq != expectedSeq {
+			result.Problems = append(result.Problems,
+				fmt.Sprintf("gap before entry %d: expected sequence number %d", entry.Seq, expectedSeq))
+		} else if entry.PrevHash != expectedPrevHash {
+			result.Problems = append(result.Problems,
+				fmt.Sprintf("entry %d does not link to the previous entry", entry.Seq))
+		}
+		if !entry.HashMatches() {
+			result.Problems = append(result.Problems,
+				fmt.Sprintf("entry %d was modified after it was written", entry.Seq))
+		}
+
+		prev = entry
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	result.Valid = len(result.Problems) == 0
+	return result, nil
+}
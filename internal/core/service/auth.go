@@ -2,7 +2,10 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -12,17 +15,65 @@ import (
 	"github.com/nisibz/go-auth-tests/internal/core/util"
 )
 
+const (
+	// maxFailedLogins is how many wrong passwords in a row lock the account.
+	maxFailedLogins = 5
+	lockoutDuration = 15 * time.Minute
+)
+
 type AuthService struct {
-	userRepo port.UserRepository
+	userRepo         port.UserRepository
+	sessionRepo      port.SessionRepository
+	tokenRepo        port.OneTimeTokenRepository
+	loginHistoryRepo port.LoginHistoryRepository
+	mailer           port.Mailer
+	audit            port.AuditLogger
+	appURL           string
+	loginHistorySize int64
+	magicLinkLimiter *util.RateLimiter
+	mfaSendLimiter   *util.RateLimiter
 }
 
-func NewAuthService(userRepo port.UserRepository) *AuthService {
-	return &AuthService{userRepo: userRepo}
+func NewAuthService(
+	userRepo port.UserRepository,
+	sessionRepo port.SessionRepository,
+	tokenRepo port.OneTimeTokenRepository,
+	loginHistoryRepo port.LoginHistoryRepository,
+	mailer port.Mailer,
+	audit port.AuditLogger,
+	appURL string,
+	loginHistorySize int64,
+) *AuthService {
+	return &AuthService{
+		userRepo:         userRepo,
+		sessionRepo:      sessionRepo,
+		tokenRepo:        tokenRepo,
+		loginHistoryRepo: loginHistoryRepo,
+		mailer:           mailer,
+		audit:            audit,
+		appURL:           appURL,
+		loginHistorySize: loginHistorySize,
+		magicLinkLimiter: util.NewRateLimiter(magicLinkRequestLimit, magicLinkRequestWindow),
+		mfaSendLimiter:   util.NewRateLimiter(mfaSendLimit, mfaSendLimitWindow),
+	}
 }
 
-func (s *AuthService) Register(name, email, password string) (string, error) {
-	_, err := s.userRepo.GetByEmail(context.Background(), email)
+func (s *AuthService) Register(ctx context.Context, name, email, password string) (string, error) {
+	if err := util.ValidatePasswordPolicy(password); err != nil {
+		return "", fmt.Errorf("%w: %v", domain.ErrWeakPassword, err)
+	}
+
+	existingUser, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+		return "", fmt.Errorf("failed to look up the email: %w", err)
+	}
 	if err == nil {
+		s.audit.Record(ctx, &domain.AuditEvent{
+			Action:   domain.AuditActionRegister,
+			Outcome:  domain.AuditOutcomeFailure,
+			TargetID: existingUser.ID,
+			Details:  map[string]string{"reason": "email_taken"},
+		})
 		return "", fmt.Errorf("user with email %s already exists", email)
 	}
 
@@ -34,39 +85,248 @@ func (s *AuthService) Register(name, email, password string) (string, error) {
 	user := &domain.User{
 		Name:      name,
 		Email:     email,
+		Status:    domain.UserStatusActive,
 		Password:  string(hashedPassword),
 		CreatedAt: time.Now(),
 	}
 
-	err = s.userRepo.Create(context.Background(), user)
+	err = s.userRepo.Create(ctx, user)
 	if err != nil {
 		return "", fmt.Errorf("failed to register user: %w", err)
 	}
 
-	if user.ID.IsZero() {
+	if user.ID == "" {
 		return "", fmt.Errorf("failed to retrieve user ID after creation")
 	}
 
-	token, err := util.GenerateToken(user.ID.Hex())
-	if err != nil {
-		return "", fmt.Errorf("failed to generate token: %w", err)
-	}
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionRegister,
+		Outcome:  domain.AuditOutcomeSuccess,
+		ActorID:  user.ID,
+		TargetID: user.ID,
+	})
 
-	return token, nil
+	return s.issueToken(ctx, user, []string{util.AMRPassword})
 }
 
-func (s *AuthService) Login(email, password string) (string, error) {
-	user, err := s.userRepo.GetByEmail(context.Background(), email)
+func (s *AuthService) Login(ctx context.Context, email, password string) (string, error) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
 	if err != nil {
+		s.loginFailed(ctx, nil, "unknown_user")
 		return "", fmt.Errorf("login failed: %w", err)
 	}
 
+	if user.IsLocked(time.Now()) {
+		s.loginFailed(ctx, user, "account_locked")
+		return "", fmt.Errorf("login failed: %w", domain.ErrAccountLocked)
+	}
+
 	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
 	if err != nil {
+		if err := s.recordFailedLogin(ctx, user); err != nil {
+			return "", err
+		}
+		s.loginFailed(ctx, user, "invalid_password")
 		return "", fmt.Errorf("login failed: invalid credentials")
 	}
 
-	token, err := util.GenerateToken(user.ID.Hex())
+	// The status is only revealed to someone who knows the password.
+	if err := s.CheckAccountStatus(ctx, user); err != nil {
+		s.loginFailed(ctx, user, "account_inactive")
+		return "", fmt.Errorf("login failed: %w", err)
+	}
+
+	if len(user.MFAMethods) > 0 {
+		mfaRequired, err := s.startMFAChallenge(ctx, user)
+		if err != nil {
+			return "", fmt.Errorf("failed to start second factor: %w", err)
+		}
+		return "", mfaRequired
+	}
+
+	return s.completeLogin(ctx, user, []string{util.AMRPassword})
+}
+
+// completeLogin is the final step shared by every way of signing in. It
+// clears the failed login counter and issues the access token, recording amr
+// as the methods the user authenticated with.
+func (s *AuthService) completeLogin(ctx context.Context, user *domain.User, amr []string) (string, error) {
+	if user.IsLocked(time.Now()) {
+		s.loginFailed(ctx, user, "account_locked")
+		return "", fmt.Errorf("login failed: %w", domain.ErrAccountLocked)
+	}
+	if err := s.CheckAccountStatus(ctx, user); err != nil {
+		s.loginFailed(ctx, user, "account_inactive")
+		return "", fmt.Errorf("login failed: %w", err)
+	}
+
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		if err := s.userRepo.ResetFailedLogins(ctx, user.ID, nil); err != nil {
+			return "", fmt.Errorf("failed to reset failed logins: %w", err)
+		}
+		user.FailedLogins = 0
+		user.LockedUntil = nil
+	}
+
+	token, err := s.issueToken(ctx, user, amr)
+	if err != nil {
+		return "", err
+	}
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionLogin,
+		Outcome:  domain.AuditOutcomeSuccess,
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Details:  map[string]string{"amr": strings.Join(amr, " ")},
+	})
+	s.recordLoginEvent(ctx, user, true, "", amr)
+	return token, nil
+}
+
+// loginFailed records a failed sign-in in the audit log and, when the account
+// is known, in its login history.
+func (s *AuthService) loginFailed(ctx context.Context, user *domain.User, reason string) {
+	var userID string
+	if user != nil {
+		userID = user.ID
+	}
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionLogin,
+		Outcome:  domain.AuditOutcomeFailure,
+		TargetID: userID,
+		Details:  map[string]string{"reason": reason},
+	})
+	if user != nil {
+		s.recordLoginEvent(ctx, user, false, reason, nil)
+	}
+}
+
+// recordFailedLogin counts a wrong password and locks the account once
+// maxFailedLogins is reached. The counter is incremented in place so that
+// concurrent attempts are all counted, and a failure to count one fails the
+// attempt rather than leaving it unrecorded.
+func (s *AuthService) recordFailedLogin(ctx context.Context, user *domain.User) error {
+	failedLogins, err := s.userRepo.IncrementFailedLogins(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record failed login: %w", err)
+	}
+	user.FailedLogins = failedLogins
+	if failedLogins >= maxFailedLogins {
+		lockedUntil := time.Now().Add(lockoutDuration)
+		if err := s.userRepo.ResetFailedLogins(ctx, user.ID, &lockedUntil); err != nil {
+			return fmt.Errorf("failed to lock account: %w", err)
+		}
+		user.FailedLogins = 0
+		user.LockedUntil = &lockedUntil
+		slog.WarnContext(ctx, "Account locked after too many failed logins", "user_id", user.ID)
+	}
+	return nil
+}
+
+// CheckAccountStatus returns a *domain.AccountStatusError unless the user's
+// account is active. A suspension whose end time has passed is lifted on the
+// way.
+func (s *AuthService) CheckAccountStatus(ctx context.Context, user *domain.User) error {
+	status := user.CurrentStatus(time.Now())
+	if status == domain.UserStatusActive {
+		if user.Status != "" && user.Status != domain.UserStatusActive {
+			user.Status = domain.UserStatusActive
+			user.StatusReason = ""
+			user.StatusUntil = nil
+			if err := updateFields(ctx, s.userRepo, user, domain.UserFieldStatus, domain.UserFieldStatusReason, domain.UserFieldStatusUntil); err != nil {
+				slog.ErrorContext(ctx, "Failed to lift expired suspension", "user_id", user.ID, "error", err)
+			}
+		}
+		return nil
+	}
+	return &domain.AccountStatusError{
+		Status: status,
+		Reason: user.StatusReason,
+		Until:  user.StatusUntil,
+	}
+}
+
+// VerifySession checks that the session referenced by a token is still active
+// and belongs to the token's user.
+func (s *AuthService) VerifySession(ctx context.Context, claims *util.Claims) error {
+	if claims.SessionID == "" {
+		return domain.ErrSessionInvalid
+	}
+	session, err := s.sessionRepo.GetByID(ctx, claims.SessionID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrSessionInvalid, err)
+	}
+	if session.UserID != claims.UserID || !session.IsActive(time.Now()) {
+		return domain.ErrSessionInvalid
+	}
+	// Impersonation tokens only work on the session opened for them, and
+	// regular tokens never do.
+	switch {
+	case claims.IsImpersonation():
+		if session.ImpersonatorID != claims.Act.Subject {
+			return domain.ErrSessionInvalid
+		}
+	case session.ImpersonatorID != "":
+		return domain.ErrSessionInvalid
+	}
+	return nil
+}
+
+// Reauthenticate confirms the password of an already signed-in user and
+// returns a token for the same session with a fresh auth_time, as required by
+// routes guarded by step-up authentication.
+func (s *AuthService) Reauthenticate(ctx context.Context, claims *util.Claims, password string) (string, error) {
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return "", fmt.Errorf("reauthentication failed: %w", err)
+	}
+
+	if user.IsLocked(time.Now()) {
+		return "", fmt.Errorf("reauthentication failed: %w", domain.ErrAccountLocked)
+	}
+	if err := s.CheckAccountStatus(ctx, user); err != nil {
+		return "", fmt.Errorf("reauthentication failed: %w", err)
+	}
+
+	if err := util.ComparePassword(password, user.Password); err != nil {
+		if err := s.recordFailedLogin(ctx, user); err != nil {
+			return "", err
+		}
+		s.audit.Record(ctx, &domain.AuditEvent{
+			Action:   domain.AuditActionReauthenticate,
+			Outcome:  domain.AuditOutcomeFailure,
+			TargetID: user.ID,
+		})
+		return "", domain.ErrInvalidCredentials
+	}
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionReauthenticate,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: user.ID,
+	})
+
+	token, err := util.GenerateToken(claims.UserID, claims.SessionID, time.Now(), []string{util.AMRPassword})
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return token, nil
+}
+
+// issueToken opens a new session for the user and returns a token bound to it.
+func (s *AuthService) issueToken(ctx context.Context, user *domain.User, amr []string) (string, error) {
+	now := time.Now()
+	session := &domain.Session{
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(util.TokenExpirationDuration),
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return "", fmt.Errorf("failed to create session: %w", err)
+	}
+
+	token, err := util.GenerateToken(user.ID, session.ID, now, amr)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate token: %w", err)
 	}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+// avatarURL is where the API serves a user's uploaded avatar
+func avatarURL(userID, version string) string {
+	return "/api/users/" + userID + "/avatar?v=" + version
+}
+
+// UploadAvatar decodes an uploaded image, re-encodes it in every avatar size
+// and makes it the user's avatar. Re-encoding drops any metadata the
+// original file carried, such as the location it was taken at.
+func (s *UserService) UploadAvatar(ctx context.Context, userID string, image io.Reader) (*domain.User, error) {
+	data, err := io.ReadAll(io.LimitReader(image, domain.MaxAvatarUploadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read avatar: %w", err)
+	}
+	if len(data) > domain.MaxAvatarUploadSize {
+		return nil, fmt.Errorf("%w: file is larger than %d bytes", domain.ErrInvalidImage, domain.MaxAvatarUploadSize)
+	}
+	img, err := util.DecodeImage(data, domain.MaxAvatarPixels)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrInvalidImage, err)
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for avatar upload: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	version := hex.EncodeToString(sum[:8])
+	if version == user.Avatar {
+		return user, nil
+	}
+
+	for _, size := range domain.AvatarSizes {
+		var buf bytes.Buffer
+		if err := util.EncodeJPEG(&buf, util.SquareThumbnail(img, size.Pixels)); err != nil {
+			return nil, fmt.Errorf("failed to encode avatar: %w", err)
+		}
+		if err := s.blobStore.Put(ctx, domain.AvatarKey(userID, version, size.Name), "image/jpeg", &buf); err != nil {
+			s.deleteAvatarBlobs(ctx, userID, version)
+			return nil, fmt.Errorf("failed to store avatar: %w", err)
+		}
+	}
+
+	previous := user.Avatar
+	user.Avatar = version
+	user.Profile.AvatarURL = avatarURL(userID, version)
+	if err := updateFields(ctx, s.userRepo, user, domain.UserFieldAvatar, domain.UserFieldProfile); err != nil {
+		s.deleteAvatarBlobs(ctx, userID, version)
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	if previous != "" {
+		s.deleteAvatarBlobs(ctx, userID, previous)
+	}
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionUserUpdate,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: userID,
+		Details:  map[string]string{"fields": domain.UserFieldAvatar},
+	})
+	return user, nil
+}
+
+// DeleteAvatar removes the user's uploaded avatar. An avatar_url pointing
+// elsewhere is left alone.
+func (s *UserService) DeleteAvatar(ctx context.Context, userID string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user for avatar removal: %w", err)
+	}
+	if user.Avatar == "" {
+		return nil
+	}
+
+	previous := user.Avatar
+	user.Avatar = ""
+	if strings.HasPrefix(user.Profile.AvatarURL, avatarURL(userID, "")) {
+		user.Profile.AvatarURL = ""
+	}
+	if err := updateFields(ctx, s.userRepo, user, domain.UserFieldAvatar, domain.UserFieldProfile); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	s.deleteAvatarBlobs(ctx, userID, previous)
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionUserUpdate,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: userID,
+		Details:  map[string]string{"fields": domain.UserFieldAvatar},
+	})
+	return nil
+}
+
+// OpenAvatar returns the user's current avatar in the given size. It fails
+// with domain.ErrBlobNotFound when the user has not uploaded one.
+func (s *UserService) OpenAvatar(ctx context.Context, userID, size string) (*domain.AvatarFile, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.Avatar == "" {
+		return nil, domain.ErrBlobNotFound
+	}
+
+	content, info, err := s.blobStore.Open(ctx, domain.AvatarKey(userID, user.Avatar, size))
+	if err != nil {
+		return nil, err
+	}
+	return &domain.AvatarFile{Version: user.Avatar, Size: size, Info: info, Content: content}, nil
+}
+
+// deleteAvatarBlobs removes every size of an avatar version. Failures only
+// leave unreferenced files behind, so they are logged and otherwise ignored.
+func (s *UserService) deleteAvatarBlobs(ctx context.Context, userID, version string) {
+	for _, size := range domain.AvatarSizes {
+		if err := s.blobStore.Delete(ctx, domain.AvatarKey(userID, version, size.Name)); err != nil {
+			slog.ErrorContext(ctx, "Failed to delete avatar", "user_id", userID, "size", size.Name, "error", err)
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+const emailChangeTokenTTL = 24 * time.Hour
+
+type pendingEmailChange struct {
+	oldEmail     string
+	confirmToken string
+	cancelToken  string
+}
+
+// startEmailChange records newEmail as the user's pending address and issues
+// the confirmation and cancellation tokens. The caller persists the user.
+func (s *UserService) startEmailChange(ctx context.Context, user *domain.User, newEmail string) (*pendingEmailChange, error) {
+	userID := user.ID
+	err := s.tokenRepo.DeleteByUser(ctx, userID, domain.TokenPurposeEmailChangeConfirm, domain.TokenPurposeEmailChangeCancel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discard previous email change: %w", err)
+	}
+
+	confirmToken, err := s.createEmailChangeToken(ctx, user, domain.TokenPurposeEmailChangeConfirm, newEmail)
+	if err != nil {
+		return nil, err
+	}
+	cancelToken, err := s.createEmailChangeToken(ctx, user, domain.TokenPurposeEmailChangeCancel, newEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	user.PendingEmail = newEmail
+	return &pendingEmailChange{
+		oldEmail:     user.Email,
+		confirmToken: confirmToken,
+		cancelToken:  cancelToken,
+	}, nil
+}
+
+func (s *UserService) createEmailChangeToken(ctx context.Context, user *domain.User, purpose, newEmail string) (string, error) {
+	token, hash, err := util.GenerateRandomToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	record := &domain.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		Data:      map[string]string{"email": newEmail},
+		CreatedAt: now,
+		ExpiresAt: now.Add(emailChangeTokenTTL),
+	}
+	if err := s.tokenRepo.Create(ctx, record); err != nil {
+		return "", fmt.Errorf("failed to store email change token: %w", err)
+	}
+	return token, nil
+}
+
+// sendEmailChangeEmails sends the confirmation link to the new address and a
+// notice with a cancellation link to the current one.
+func (s *UserService) sendEmailChangeEmails(ctx context.Context, user *domain.User, change *pendingEmailChange) error {
+	confirm := &domain.Email{
+		To:      user.PendingEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nConfirm that you want to use this address to sign in by opening the link below:\n\n%s/email-change/confirm?token=%s\n\nThe link expires in %s.\n",
+			user.Name, s.appURL, change.confirmToken, emailChangeTokenTTL,
+		),
+	}
+	if err := s.mailer.Send(ctx, confirm); err != nil {
+		return fmt.Errorf("failed to send email confirmation: %w", err)
+	}
+
+	notice := &domain.Email{
+		To:      change.oldEmail,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nA request was made to change the email address of your account to %s.\nIf this wasn't you, cancel the change by opening the link below:\n\n%s/email-change/cancel?token=%s\n",
+			user.Name, user.PendingEmail, s.appURL, change.cancelToken,
+		),
+	}
+	if err := s.mailer.Send(ctx, notice); err != nil {
+		// The change can still be confirmed, so don't fail the whole request.
+		slog.ErrorContext(ctx, "Failed to notify old email address of email change", "user_id", user.ID, "error", err)
+	}
+	return nil
+}
+
+// ConfirmEmailChange switches the user's login email to the pending address
+// referenced by the confirmation token.
+func (s *UserService) ConfirmEmailChange(ctx context.Context, token string) (*domain.User, error) {
+	record, user, err := s.resolveEmailChangeToken(ctx, domain.TokenPurposeEmailChangeConfirm, token)
+	if err != nil {
+		return nil, err
+	}
+
+	newEmail := record.Data["email"]
+	existingUser, err := s.userRepo.GetByEmail(ctx, newEmail)
+	if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+		return nil, fmt.Errorf("failed to look up the email: %w", err)
+	}
+	if err == nil && existingUser.ID != user.ID {
+		return nil, fmt.Errorf("%w: %s", domain.ErrEmailTaken, newEmail)
+	}
+
+	if err := s.tokenRepo.MarkUsed(ctx, record.ID); err != nil {
+		return nil, err
+	}
+
+	user.Email = newEmail
+	user.PendingEmail = ""
+	if err := updateFields(ctx, s.userRepo, user, domain.UserFieldEmail, domain.UserFieldPendingEmail); err != nil {
+		return nil, fmt.Errorf("failed to update user email: %w", err)
+	}
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionEmailChange,
+		Outcome:  domain.AuditOutcomeSuccess,
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Details:  map[string]string{"step": "confirmed"},
+	})
+
+	s.discardEmailChangeTokens(ctx, user)
+	return user, nil
+}
+
+// CancelEmailChange drops the pending email change referenced by the
+// cancellation token.
+func (s *UserService) CancelEmailChange(ctx context.Context, token string) error {
+	record, user, err := s.resolveEmailChangeToken(ctx, domain.TokenPurposeEmailChangeCancel, token)
+	if err != nil {
+		return err
+	}
+
+	if err := s.tokenRepo.MarkUsed(ctx, record.ID); err != nil {
+		return err
+	}
+
+	user.PendingEmail = ""
+	if err := updateFields(ctx, s.userRepo, user, domain.UserFieldPendingEmail); err != nil {
+		return fmt.Errorf("failed to cancel email change: %w", err)
+	}
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionEmailChange,
+		Outcome:  domain.AuditOutcomeSuccess,
+		ActorID:  user.ID,
+		TargetID: user.ID,
+		Details:  map[string]string{"step": "cancelled"},
+	})
+
+	s.discardEmailChangeTokens(ctx, user)
+	return nil
+}
+
+// resolveEmailChangeToken looks up an unused, unexpired token and checks that
+// it still refers to the user's current pending email change.
+func (s *UserService) resolveEmailChangeToken(ctx context.Context, purpose, token string) (*domain.OneTimeToken, *domain.User, error) {
+	record, err := s.tokenRepo.GetByHash(ctx, purpose, util.HashToken(token))
+	if err != nil {
+		return nil, nil, domain.ErrTokenInvalid
+	}
+	if record.UsedAt != nil {
+		return nil, nil, domain.ErrTokenUsed
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, nil, domain.ErrTokenInvalid
+	}
+
+	user, err := s.userRepo.GetByID(ctx, record.UserID)
+	if err != nil {
+		return nil, nil, domain.ErrTokenInvalid
+	}
+	if user.PendingEmail == "" || user.PendingEmail != record.Data["email"] {
+		return nil, nil, domain.ErrTokenInvalid
+	}
+	return record, user, nil
+}
+
+func (s *UserService) discardEmailChangeTokens(ctx context.Context, user *domain.User) {
+	err := s.tokenRepo.DeleteByUser(ctx, user.ID, domain.TokenPurposeEmailChangeConfirm, domain.TokenPurposeEmailChangeCancel)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to discard email change tokens", "user_id", user.ID, "error", err)
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+const impersonationTTL = 15 * time.Minute
+
+// Impersonate lets an admin act as another user. It opens a short-lived
+// session for the target user that remembers the admin behind it.
+func (s *AuthService) Impersonate(ctx context.Context, actor *domain.User, targetID string) (string, *domain.Session, error) {
+	if actor.Role != domain.RoleAdmin {
+		return "", nil, fmt.Errorf("%w: only admins can impersonate users", domain.ErrForbidden)
+	}
+	if actor.ID == targetID {
+		return "", nil, fmt.Errorf("%w: admins can't impersonate themselves", domain.ErrForbidden)
+	}
+
+	target, err := s.userRepo.GetByID(ctx, targetID)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to get user to impersonate: %w", err)
+	}
+	if target.Role == domain.RoleAdmin {
+		return "", nil, fmt.Errorf("%w: admins can't be impersonated", domain.ErrForbidden)
+	}
+
+	now := time.Now()
+	session := &domain.Session{
+		UserID:         target.ID,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(impersonationTTL),
+		ImpersonatorID: actor.ID,
+	}
+	if err := s.sessionRepo.Create(ctx, session); err != nil {
+		return "", nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	token, err := util.GenerateImpersonationToken(target.ID, session.ID, actor.ID, impersonationTTL)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Impersonation started",
+		"admin_id", actor.ID,
+		"user_id", target.ID,
+		"session_id", session.ID,
+		"expires_at", session.ExpiresAt,
+	)
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionImpersonationStart,
+		Outcome:  domain.AuditOutcomeSuccess,
+		ActorID:  actor.ID,
+		TargetID: target.ID,
+		Details:  map[string]string{"session_id": session.ID},
+	})
+	return token, session, nil
+}
+
+// StopImpersonation ends the impersonation session the token belongs to.
+func (s *AuthService) StopImpersonation(ctx context.Context, claims *util.Claims) error {
+	if !claims.IsImpersonation() {
+		return domain.ErrNotImpersonating
+	}
+
+	if err := s.sessionRepo.Revoke(ctx, claims.SessionID); err != nil {
+		return fmt.Errorf("failed to revoke impersonation session: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Impersonation stopped",
+		"admin_id", claims.Act.Subject,
+		"user_id", claims.UserID,
+		"session_id", claims.SessionID,
+	)
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionImpersonationStop,
+		Outcome:  domain.AuditOutcomeSuccess,
+		ActorID:  claims.Act.Subject,
+		TargetID: claims.UserID,
+		Details:  map[string]string{"session_id": claims.SessionID},
+	})
+	return nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+// deviceID fingerprints a user agent so that sign-ins from the same browser
+// can be recognised without comparing raw header values.
+func deviceID(userAgent string) string {
+	return util.HashToken(strings.ToLower(strings.TrimSpace(userAgent)))[:16]
+}
+
+// recordLoginEvent adds a sign-in attempt to the user's login history, trims
+// the history to the configured size and warns the user by email when a
+// successful login comes from a device never seen on the account before.
+// Failures are only logged so that they never block a login.
+func (s *AuthService) recordLoginEvent(ctx context.Context, user *domain.User, success bool, reason string, amr []string) {
+	info := domain.RequestInfoFrom(ctx)
+	event := &domain.LoginEvent{
+		UserID:    user.ID,
+		Time:      time.Now(),
+		Success:   success,
+		Reason:    reason,
+		Methods:   amr,
+		IP:        info.IP,
+		UserAgent: info.UserAgent,
+		DeviceID:  deviceID(info.UserAgent),
+	}
+
+	newDevice := false
+	if success {
+		var err error
+		newDevice, err = s.isNewDevice(ctx, user.ID, event.DeviceID)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to look up known devices", "user_id", user.ID, "error", err)
+		}
+	}
+
+	if err := s.loginHistoryRepo.Create(ctx, event); err != nil {
+		slog.ErrorContext(ctx, "Failed to record login history", "user_id", user.ID, "error", err)
+		return
+	}
+	if s.loginHistorySize > 0 {
+		if err := s.loginHistoryRepo.Prune(ctx, user.ID, s.loginHistorySize); err != nil {
+			slog.ErrorContext(ctx, "Failed to prune login history", "user_id", user.ID, "error", err)
+		}
+	}
+
+	if newDevice {
+		if err := s.sendNewDeviceEmail(ctx, user, event); err != nil {
+			slog.ErrorContext(ctx, "Failed to send new device notification", "user_id", user.ID, "error", err)
+		}
+	}
+}
+
+// isNewDevice reports whether deviceID has never signed in to the account.
+// The very first login of an account is not treated as a new device.
+func (s *AuthService) isNewDevice(ctx context.Context, userID, deviceID string) (bool, error) {
+	known, err := s.loginHistoryRepo.HasDevice(ctx, userID, deviceID)
+	if err != nil || known {
+		return false, err
+	}
+	previous, err := s.loginHistoryRepo.CountSuccessful(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return previous > 0, nil
+}
+
+func (s *AuthService) sendNewDeviceEmail(ctx context.Context, user *domain.User, event *domain.LoginEvent) error {
+	userAgent := event.UserAgent
+	if userAgent == "" {
+		userAgent = "unknown"
+	}
+	email := &domain.Email{
+		To:      user.Email,
+		Subject: "New sign-in to your account",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nYour account was just signed in to from a device we haven't seen before.\n\nTime: %s\nIP address: %s\nDevice: %s\n\nIf this was you, you can ignore this email. Otherwise change your password right away.\n",
+			user.Name, event.Time.UTC().Format(time.RFC1123), event.IP, userAgent,
+		),
+	}
+	return s.mailer.Send(ctx, email)
+}
+
+// ListLoginHistory returns the user's most recent sign-in attempts, newest first.
+func (s *UserService) ListLoginHistory(ctx context.Context, userID string, limit, offset int64) ([]*domain.LoginEvent, error) {
+	events, err := s.loginHistoryRepo.ListByUser(ctx, userID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list login history: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+const (
+	magicLinkTTL           = 15 * time.Minute
+	magicLinkRequestLimit  = 3
+	magicLinkRequestWindow = 15 * time.Minute
+)
+
+// RequestMagicLink emails a single-use sign-in link to the user. It returns
+// nil whether or not the email belongs to an account so that callers can't
+// probe for registered addresses.
+func (s *AuthService) RequestMagicLink(ctx context.Context, email string) error {
+	if !s.magicLinkLimiter.Allow(strings.ToLower(email)) {
+		return domain.ErrRateLimited
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+	if user.IsLocked(time.Now()) {
+		slog.InfoContext(ctx, "Magic link not sent, account is locked", "user_id", user.ID)
+		return nil
+	}
+	if err := s.CheckAccountStatus(ctx, user); err != nil {
+		slog.InfoContext(ctx, "Magic link not sent, account is not active", "user_id", user.ID)
+		return nil
+	}
+
+	if err := s.sendMagicLink(ctx, user); err != nil {
+		slog.ErrorContext(ctx, "Failed to send magic link", "user_id", user.ID, "error", err)
+	}
+	return nil
+}
+
+func (s *AuthService) sendMagicLink(ctx context.Context, user *domain.User) error {
+	userID := user.ID
+	if err := s.tokenRepo.DeleteByUser(ctx, userID, domain.TokenPurposeMagicLink); err != nil {
+		return fmt.Errorf("failed to discard previous magic links: %w", err)
+	}
+
+	// The signed token carries a random ID whose hash is stored, which is
+	// what makes the link single-use.
+	tokenID, tokenIDHash, err := util.GenerateRandomToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	record := &domain.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   domain.TokenPurposeMagicLink,
+		TokenHash: tokenIDHash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(magicLinkTTL),
+	}
+	if err := s.tokenRepo.Create(ctx, record); err != nil {
+		return fmt.Errorf("failed to store magic link: %w", err)
+	}
+	token, err := util.GeneratePurposeToken(domain.TokenPurposeMagicLink, userID, tokenID, magicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	email := &domain.Email{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen the link below to sign in. It can only be used once and expires in %s.\n\n%s/magic-link?token=%s\n\nIf you didn't ask for this link, you can ignore this email.\n",
+			user.Name, magicLinkTTL, s.appURL, token,
+		),
+	}
+	return s.mailer.Send(ctx, email)
+}
+
+// ConsumeMagicLink exchanges a magic link token for an access token.
+func (s *AuthService) ConsumeMagicLink(ctx context.Context, token string) (string, error) {
+	claims, err := util.ValidatePurposeToken(domain.TokenPurposeMagicLink, token)
+	if err != nil {
+		return "", domain.ErrTokenInvalid
+	}
+
+	record, err := s.tokenRepo.GetByHash(ctx, domain.TokenPurposeMagicLink, util.HashToken(claims.ID))
+	if err != nil || record.UserID != claims.Subject {
+		return "", domain.ErrTokenInvalid
+	}
+	if record.UsedAt != nil {
+		return "", domain.ErrTokenUsed
+	}
+	if err := s.tokenRepo.MarkUsed(ctx, record.ID); err != nil {
+		return "", err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, claims.Subject)
+	if err != nil {
+		return "", domain.ErrTokenInvalid
+	}
+
+	return s.completeLogin(ctx, user, []string{util.AMREmail})
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+const (
+	mfaCodeDigits      = 6
+	mfaCodeTTL         = 10 * time.Minute
+	mfaMaxAttempts     = 5
+	mfaSendLimit       = 5
+	mfaSendLimitWindow = 15 * time.Minute
+
+	// mfaMaxResends bounds how many new codes a challenge can ask for.
+	// Guesses count against mfaMaxAttempts whatever code they are for.
+	mfaMaxResends = 3
+)
+
+// startMFAChallenge opens a pending login for a user whose password was
+// correct and sends a code with their preferred factor.
+func (s *AuthService) startMFAChallenge(ctx context.Context, user *domain.User) (*domain.MFARequiredError, error) {
+	userID := user.ID
+	if err := s.tokenRepo.DeleteByUser(ctx, userID, domain.TokenPurposeMFAChallenge); err != nil {
+		return nil, fmt.Errorf("failed to discard previous challenges: %w", err)
+	}
+
+	token, hash, err := util.GenerateRandomToken()
+	if err != nil {
+		return nil, err
+	}
+	challenge := &domain.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   domain.TokenPurposeMFAChallenge,
+		TokenHash: hash,
+		Data:      map[string]string{},
+		CreatedAt: time.Now(),
+	}
+
+	method := user.PreferredMFA
+	if !slices.Contains(user.MFAMethods, method) {
+		method = user.MFAMethods[0]
+	}
+	code, err := s.newMFACode(user, challenge, method)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.tokenRepo.Create(ctx, challenge); err != nil {
+		return nil, fmt.Errorf("failed to store challenge: %w", err)
+	}
+	if err := s.sendMFACode(ctx, user, method, code); err != nil {
+		return nil, err
+	}
+
+	return &domain.MFARequiredError{
+		Token:   token,
+		Method:  method,
+		Methods: user.MFAMethods,
+	}, nil
+}
+
+// newMFACode generates a fresh code to deliver with method and sets it on
+// the challenge, which the caller persists before sending the code so that
+// every code sent can be checked.
+func (s *AuthService) newMFACode(user *domain.User, challenge *domain.OneTimeToken, method string) (string, error) {
+	if method != domain.MFAMethodEmail {
+		return "", domain.ErrMFAMethodInvalid
+	}
+	if !s.mfaSendLimiter.Allow(user.ID) {
+		return "", domain.ErrRateLimited
+	}
+
+	code, err := util.GenerateNumericCode(mfaCodeDigits)
+	if err != nil {
+		return "", err
+	}
+	challenge.Data["method"] = method
+	challenge.Data["code_hash"] = util.HashToken(code)
+	challenge.ExpiresAt = time.Now().Add(mfaCodeTTL)
+	return code, nil
+}
+
+// sendMFACode delivers code with method
+func (s *AuthService) sendMFACode(ctx context.Context, user *domain.User, method, code string) error {
+	switch method {
+	case domain.MFAMethodEmail:
+		email := &domain.Email{
+			To:      user.Email,
+			Subject: "Your verification code",
+			Body: fmt.Sprintf(
+				"Hi %s,\n\nYour verification code is %s. It expires in %s.\n\nIf you didn't try to sign in, change your password.\n",
+				user.Name, code, mfaCodeTTL,
+			),
+		}
+		if err := s.mailer.Send(ctx, email); err != nil {
+			return fmt.Errorf("failed to send verification code: %w", err)
+		}
+	default:
+		return domain.ErrMFAMethodInvalid
+	}
+	return nil
+}
+
+// ResendMFACode sends a new code for a pending login, optionally with a
+// different enabled factor than the one used so far. Wrong codes entered so
+// far still count, and a challenge gets at most mfaMaxResends new codes.
+func (s *AuthService) ResendMFACode(ctx context.Context, mfaToken, method string) error {
+	challenge, user, err := s.resolveMFAChallenge(ctx, mfaToken)
+	if err != nil {
+		return err
+	}
+
+	if method == "" {
+		method = challenge.Data["method"]
+	}
+	if !slices.Contains(user.MFAMethods, method) {
+		return domain.ErrMFAMethodInvalid
+	}
+	resends, _ := strconv.Atoi(challenge.Data["resends"])
+	if resends >= mfaMaxResends {
+		return domain.ErrRateLimited
+	}
+
+	code, err := s.newMFACode(user, challenge, method)
+	if err != nil {
+		return err
+	}
+	challenge.Data["resends"] = strconv.Itoa(resends + 1)
+	if err := s.tokenRepo.Update(ctx, challenge); err != nil {
+		return fmt.Errorf("failed to update challenge: %w", err)
+	}
+	return s.sendMFACode(ctx, user, method, code)
+}
+
+// VerifyMFA completes a pending login with the code the user received.
+func (s *AuthService) VerifyMFA(ctx context.Context, mfaToken, code string) (string, error) {
+	challenge, user, err := s.resolveMFAChallenge(ctx, mfaToken)
+	if err != nil {
+		return "", err
+	}
+	if time.Now().After(challenge.ExpiresAt) {
+		return "", domain.ErrTokenInvalid
+	}
+
+	// The attempt is counted before the code is compared, so that parallel
+	// guesses cannot all pass the check on the attempts read above.
+	attempts, err := s.tokenRepo.IncrementAttempts(ctx, challenge.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to count verification attempt: %w", err)
+	}
+	if attempts > mfaMaxAttempts {
+		return "", domain.ErrTokenUsed
+	}
+
+	expected := challenge.Data["code_hash"]
+	if subtle.ConstantTimeCompare([]byte(util.HashToken(code)), []byte(expected)) != 1 {
+		if attempts == mfaMaxAttempts {
+			// Too many guesses, the user has to sign in with their password again.
+			_ = s.tokenRepo.MarkUsed(ctx, challenge.ID)
+		}
+		s.loginFailed(ctx, user, "invalid_mfa_code")
+		return "", domain.ErrInvalidMFACode
+	}
+
+	if err := s.tokenRepo.MarkUsed(ctx, challenge.ID); err != nil {
+		return "", err
+	}
+
+	return s.completeLogin(ctx, user, []string{util.AMRPassword, util.AMROTP, util.AMRMFA})
+}
+
+func (s *AuthService) resolveMFAChallenge(ctx context.Context, mfaToken string) (*domain.OneTimeToken, *domain.User, error) {
+	challenge, err := s.tokenRepo.GetByHash(ctx, domain.TokenPurposeMFAChallenge, util.HashToken(mfaToken))
+	if err != nil {
+		return nil, nil, domain.ErrTokenInvalid
+	}
+	if challenge.UsedAt != nil || challenge.Attempts >= mfaMaxAttempts {
+		return nil, nil, domain.ErrTokenUsed
+	}
+	// A challenge outlives its code by one TTL so that a new code can be requested.
+	if time.Now().After(challenge.ExpiresAt.Add(mfaCodeTTL)) {
+		return nil, nil, domain.ErrTokenInvalid
+	}
+
+	user, err := s.userRepo.GetByID(ctx, challenge.UserID)
+	if err != nil {
+		return nil, nil, domain.ErrTokenInvalid
+	}
+	return challenge, user, nil
+}
+
+// UpdateMFASettings enables the given second factors for the user and picks
+// the one used by default. An empty methods list turns MFA off. The current
+// password is required so that a stolen token can't weaken the account.
+func (s *UserService) UpdateMFASettings(ctx context.Context, id, password string, methods []string, preferred string) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for mfa settings: %w", err)
+	}
+
+	if err := util.ComparePassword(password, user.Password); err != nil {
+		return nil, domain.ErrInvalidCredentials
+	}
+
+	enabled := make([]string, 0, len(methods))
+	for _, method := range methods {
+		if !domain.IsSupportedMFAMethod(method) {
+			return nil, fmt.Errorf("%w: %s", domain.ErrMFAMethodInvalid, method)
+		}
+		if !slices.Contains(enabled, method) {
+			enabled = append(enabled, method)
+		}
+	}
+
+	switch {
+	case len(enabled) == 0:
+		preferred = ""
+	case preferred == "":
+		preferred = enabled[0]
+	case !slices.Contains(enabled, preferred):
+		return nil, fmt.Errorf("%w: preferred method %s is not enabled", domain.ErrMFAMethodInvalid, preferred)
+	}
+
+	user.MFAMethods = enabled
+	user.PreferredMFA = preferred
+	if err := updateFields(ctx, s.userRepo, user, domain.UserFieldMFAMethods, domain.UserFieldPreferredMFA); err != nil {
+		return nil, fmt.Errorf("failed to update mfa settings: %w", err)
+	}
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionMFAUpdate,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: id,
+		Details:  map[string]string{"methods": strings.Join(enabled, " ")},
+	})
+	return user, nil
+}
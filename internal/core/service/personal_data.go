@@ -0,0 +1,341 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+const (
+	erasureTokenTTL = 24 * time.Hour
+	// personalDataPageSize is how many login events or audit entries are
+	// read per repository query while building an export
+	personalDataPageSize = 500
+)
+
+// personalDataReadme is the first file of every personal data archive
+const personalDataReadme = `This archive contains the personal data stored about your account.
+
+account.json        your account and profile, including notes added by administrators
+sessions.json       every sign-in session, including revoked and expired ones
+login_history.json  recent sign-in attempts with their IP address and browser
+audit_log.json      security events you performed or that concern your account
+avatar.jpg          your profile picture, if you uploaded one
+
+Password hashes and second factor secrets are never included.
+`
+
+// personalAccount is account.json: the user's fields, including the ones
+// hidden from the API that still count as personal data, without secrets
+type personalAccount struct {
+	ID                string          `json:"id"`
+	Name              string          `json:"name"`
+	Email             string          `json:"email"`
+	PendingEmail      string          `json:"pending_email,omitempty"`
+	Profile           personalProfile `json:"profile"`
+	Metadata          map[string]any  `json:"metadata,omitempty"`
+	AdminMetadata     map[string]any  `json:"admin_metadata,omitempty"`
+	Role              string          `json:"role,omitempty"`
+	Status            string          `json:"status,omitempty"`
+	StatusReason      string          `json:"status_reason,omitempty"`
+	StatusUntil       *time.Time      `json:"status_until,omitempty"`
+	MFAMethods        []string        `json:"mfa_methods,omitempty"`
+	PreferredMFA      string          `json:"preferred_mfa,omitempty"`
+	PasswordChangedAt *time.Time      `json:"password_changed_at,omitempty"`
+	LockedUntil       *time.Time      `json:"locked_until,omitempty"`
+	CreatedAt         time.Time       `json:"created_at"`
+}
+
+type personalProfile struct {
+	DisplayName string `json:"display_name,omitempty"`
+	Locale      string `json:"locale,omitempty"`
+	Timezone    string `json:"timezone,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Phone       string `json:"phone,omitempty"`
+}
+
+func newPersonalAccount(user *domain.User) *personalAccount {
+	return &personalAccount{
+		ID:                user.ID,
+		Name:              user.Name,
+		Email:             user.Email,
+		PendingEmail:      user.PendingEmail,
+		Profile:           personalProfile(user.Profile),
+		Metadata:          user.Metadata,
+		AdminMetadata:     user.AdminMetadata,
+		Role:              user.Role,
+		Status:            user.Status,
+		StatusReason:      user.StatusReason,
+		StatusUntil:       user.StatusUntil,
+		MFAMethods:        user.MFAMethods,
+		PreferredMFA:      user.PreferredMFA,
+		PasswordChangedAt: user.PasswordChangedAt,
+		LockedUntil:       user.LockedUntil,
+		CreatedAt:         user.CreatedAt,
+	}
+}
+
+// ExportPersonalData writes a zip archive with every piece of data stored
+// about the user to w: the account, sessions, login history, the audit log
+// entries about them and their avatar. The login history and audit log are
+// streamed page by page, so an archive of any size uses little memory.
+// Nothing is written to w when the user cannot be read.
+func (s *UserService) ExportPersonalData(ctx context.Context, userID string, w io.Writer) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	sessions, err := s.sessionRepo.ListByUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"README.txt", func(w io.Writer) error {
+			_, err := io.WriteString(w, personalDataReadme)
+			return err
+		}},
+		{"account.json", func(w io.Writer) error { return writeJSON(w, newPersonalAccount(user)) }},
+		{"sessions.json", func(w io.Writer) error { return writeJSON(w, sessions) }},
+		{"login_history.json", func(w io.Writer) error {
+			return writeJSONPages(w, func(offset int64) ([]*domain.LoginEvent, error) {
+				events, err := s.loginHistoryRepo.ListByUser(ctx, userID, personalDataPageSize, offset)
+				if err != nil {
+					return nil, fmt.Errorf("failed to list login history: %w", err)
+				}
+				return events, nil
+			})
+		}},
+		{"audit_log.json", func(w io.Writer) error {
+			filter := &domain.AuditFilter{Subject: userID}
+			return writeJSONPages(w, func(offset int64) ([]*domain.AuditEntry, error) {
+				return s.audit.List(ctx, filter, personalDataPageSize, offset)
+			})
+		}},
+	}
+	for _, file := range files {
+		if err := writeArchiveFile(archive, file.name, file.write); err != nil {
+			return err
+		}
+	}
+	if user.Avatar != "" {
+		if err := s.archiveAvatar(ctx, archive, user); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write personal data archive: %w", err)
+	}
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionDataExport,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: userID,
+	})
+	return nil
+}
+
+func writeArchiveFile(archive *zip.Writer, name string, write func(io.Writer) error) error {
+	header := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()}
+	file, err := archive.CreateHeader(header)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if err := write(file); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, value any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// writeJSONPages writes the pages returned by list as a single indented JSON
+// array, holding one page in memory at a time. list is called with growing
+// offsets until it returns a short page.
+func writeJSONPages[T any](w io.Writer, list func(offset int64) ([]T, error)) error {
+	count := 0
+	for offset := int64(0); ; offset += personalDataPageSize {
+		page, err := list(offset)
+		if err != nil {
+			return err
+		}
+		for _, item := range page {
+			raw, err := json.MarshalIndent(item, "  ", "  ")
+			if err != nil {
+				return err
+			}
+			separator := ",\n  "
+			if count == 0 {
+				separator = "[\n  "
+			}
+			if _, err := io.WriteString(w, separator); err != nil {
+				return err
+			}
+			if _, err := w.Write(raw); err != nil {
+				return err
+			}
+			count++
+		}
+		if len(page) < personalDataPageSize {
+			break
+		}
+	}
+	end := "\n]\n"
+	if count == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w, end)
+	return err
+}
+
+func (s *UserService) archiveAvatar(ctx context.Context, archive *zip.Writer, user *domain.User) error {
+	content, _, err := s.blobStore.Open(ctx, domain.AvatarKey(user.ID, user.Avatar, domain.AvatarSizes[0].Name))
+	if errors.Is(err, domain.ErrBlobNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open avatar: %w", err)
+	}
+	defer content.Close()
+
+	// JPEG is already compressed
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: "avatar.jpg", Method: zip.Store, Modified: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to write avatar.jpg: %w", err)
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		return fmt.Errorf("failed to write avatar.jpg: %w", err)
+	}
+	return nil
+}
+
+// RequestErasure emails the user a link that erases their account when
+// confirmed. A new request replaces any link sent before.
+func (s *UserService) RequestErasure(ctx context.Context, userID string) error {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if err := s.tokenRepo.DeleteByUser(ctx, userID, domain.TokenPurposeErasureConfirm); err != nil {
+		return fmt.Errorf("failed to discard previous erasure request: %w", err)
+	}
+	token, hash, err := util.GenerateRandomToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	record := &domain.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   domain.TokenPurposeErasureConfirm,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(erasureTokenTTL),
+	}
+	if err := s.tokenRepo.Create(ctx, record); err != nil {
+		return fmt.Errorf("failed to store erasure token: %w", err)
+	}
+
+	email := &domain.Email{
+		To:      user.Email,
+		Subject: "Confirm the deletion of your account",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nA request was made to permanently delete your account and all the data we hold about you.\nThis cannot be undone. To confirm, open the link below:\n\n%s/erasure/confirm?token=%s\n\nThe link expires in %s. If this wasn't you, ignore this email and change your password.\n",
+			user.Name, s.appURL, token, erasureTokenTTL,
+		),
+	}
+	if err := s.mailer.Send(ctx, email); err != nil {
+		return fmt.Errorf("failed to send erasure confirmation: %w", err)
+	}
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionUserErasure,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: userID,
+		Details:  map[string]string{"step": "requested"},
+	})
+	return nil
+}
+
+// ConfirmErasure permanently erases the account referenced by the token,
+// with its sessions, one-time tokens, login history and avatar. The erasure
+// is recorded in the audit log.
+//
+// Audit entries about the user are deliberately kept unchanged, IP addresses
+// and user agents included. They are the security record of the account,
+// kept to investigate abuse and to answer legal claims, which is a ground to
+// keep data after an erasure request. Each entry is also hashed into the
+// next one, so pseudonymizing an entry in place would make the whole log
+// fail verification. Once the account is gone they only refer to the user by
+// an ID that no longer leads to any personal data.
+func (s *UserService) ConfirmErasure(ctx context.Context, token string) error {
+	record, err := s.tokenRepo.GetByHash(ctx, domain.TokenPurposeErasureConfirm, util.HashToken(token))
+	if err != nil {
+		return domain.ErrTokenInvalid
+	}
+	if record.UsedAt != nil {
+		return domain.ErrTokenUsed
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return domain.ErrTokenInvalid
+	}
+	userID := record.UserID
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return domain.ErrTokenInvalid
+	}
+	if err := s.tokenRepo.MarkUsed(ctx, record.ID); err != nil {
+		return err
+	}
+
+	// Soft deleting first locks the account right away, and leaves it to
+	// the purge job should one of the deletions below fail.
+	if err := s.userRepo.Delete(ctx, userID, domain.AnyVersion); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	if err := s.removeUser(ctx, user); err != nil {
+		s.audit.Record(ctx, &domain.AuditEvent{
+			Action:   domain.AuditActionUserErasure,
+			Outcome:  domain.AuditOutcomeFailure,
+			ActorID:  userID,
+			TargetID: userID,
+			Details:  map[string]string{"step": "confirmed"},
+		})
+		return err
+	}
+
+	slog.InfoContext(ctx, "Erased user", "user_id", userID)
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionUserErasure,
+		Outcome:  domain.AuditOutcomeSuccess,
+		ActorID:  userID,
+		TargetID: userID,
+		Details:  map[string]string{"step": "confirmed"},
+	})
+
+	notice := &domain.Email{
+		To:      user.Email,
+		Subject: "Your account has been deleted",
+		Body:    fmt.Sprintf("Hi %s,\n\nYour account and the data we held about you have been permanently deleted.\n", user.Name),
+	}
+	if err := s.mailer.Send(ctx, notice); err != nil {
+		slog.ErrorContext(ctx, "Failed to send erasure notice", "user_id", userID, "error", err)
+	}
+	return nil
+}
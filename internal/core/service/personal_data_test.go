@@ -0,0 +1,142 @@
+package service_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+// readArchive returns the content of every file of a zip archive, by name
+func readArchive(t *testing.T, data []byte) map[string][]byte {
+	t.Helper()
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		content, err := file.Open()
+		require.NoError(t, err)
+		files[file.Name], err = io.ReadAll(content)
+		content.Close()
+		require.NoError(t, err)
+	}
+	return files
+}
+
+func TestExportPersonalData(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	user, err := s.users.CreateUser(ctx, "Kate", "kate@example.com", password)
+	require.NoError(t, err)
+	var export bytes.Buffer
+	require.NoError(t, s.users.ExportPersonalData(ctx, user.ID, &export))
+	files := readArchive(t, export.Bytes())
+	assert.Equal(t, "[]\n", string(files["login_history.json"]))
+	assert.NotContains(t, files, "avatar.jpg")
+
+	for range 2 {
+		_, err = s.auth.Login(ctx, "kate@example.com", password)
+		require.NoError(t, err)
+	}
+	_, err = s.users.UploadAvatar(ctx, user.ID, bytes.NewReader(encodePNG(t, 200, 200)))
+	require.NoError(t, err)
+
+	export.Reset()
+	require.NoError(t, s.users.ExportPersonalData(ctx, user.ID, &export))
+	files = readArchive(t, export.Bytes())
+	assert.ElementsMatch(t, []string{"README.txt", "account.json", "sessions.json", "login_history.json", "audit_log.json", "avatar.jpg"}, keys(files))
+
+	var account map[string]any
+	require.NoError(t, json.Unmarshal(files["account.json"], &account))
+	assert.Equal(t, "kate@example.com", account["email"])
+	assert.NotContains(t, account, "password")
+
+	var sessions, logins, auditEntries []map[string]any
+	require.NoError(t, json.Unmarshal(files["sessions.json"], &sessions))
+	assert.Len(t, sessions, 2)
+	require.NoError(t, json.Unmarshal(files["login_history.json"], &logins))
+	assert.Len(t, logins, 2)
+	require.NoError(t, json.Unmarshal(files["audit_log.json"], &auditEntries))
+	// The creation, both logins and the avatar upload
+	assert.Len(t, auditEntries, 4)
+	for _, entry := range auditEntries {
+		assert.True(t, entry["actor_id"] == user.ID || entry["target_id"] == user.ID)
+	}
+}
+
+func keys(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	return names
+}
+
+var erasureLink = regexp.MustCompile(`/erasure/confirm\?token=(\S+)`)
+
+func TestConfirmErasure_RemovesEverything(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	user, err := s.users.CreateUser(ctx, "Liam", "liam@example.com", password)
+	require.NoError(t, err)
+	_, err = s.auth.Login(ctx, "liam@example.com", password)
+	require.NoError(t, err)
+	user, err = s.users.UploadAvatar(ctx, user.ID, bytes.NewReader(encodePNG(t, 200, 200)))
+	require.NoError(t, err)
+	other, err := s.users.CreateUser(ctx, "Mia", "mia@example.com", password)
+	require.NoError(t, err)
+	_, err = s.auth.Login(ctx, "mia@example.com", password)
+	require.NoError(t, err)
+
+	require.NoError(t, s.users.RequestErasure(ctx, user.ID))
+	match := erasureLink.FindStringSubmatch(s.mail.last(t, "liam@example.com").Body)
+	require.NotNil(t, match)
+	token := match[1]
+
+	require.NoError(t, s.users.ConfirmErasure(ctx, token))
+
+	_, err = s.users.GetUserByID(ctx, user.ID)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	sessions, err := s.sessions.ListByUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+	_, err = s.tokens.GetByHash(ctx, domain.TokenPurposeErasureConfirm, util.HashToken(token))
+	assert.Error(t, err)
+	logins, err := s.logins.ListByUser(ctx, user.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Empty(t, logins)
+	for _, size := range domain.AvatarSizes {
+		_, _, err := s.blobs.Open(ctx, domain.AvatarKey(user.ID, user.Avatar, size.Name))
+		assert.ErrorIs(t, err, domain.ErrBlobNotFound, size.Name)
+	}
+	assert.Equal(t, "Your account has been deleted", s.mail.last(t, "liam@example.com").Subject)
+
+	// Other users are left alone
+	sessions, err = s.sessions.ListByUser(ctx, other.ID)
+	require.NoError(t, err)
+	assert.Len(t, sessions, 1)
+	logins, err = s.logins.ListByUser(ctx, other.ID, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, logins, 1)
+
+	assert.ErrorIs(t, s.users.ConfirmErasure(ctx, token), domain.ErrTokenInvalid)
+
+	// The audit log keeps its entries and stays valid
+	entries, err := s.audit.List(ctx, &domain.AuditFilter{Subject: user.ID, Action: domain.AuditActionUserErasure}, 10, 0)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	verification, err := s.audit.Verify(ctx)
+	require.NoError(t, err)
+	assert.True(t, verification.Valid)
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+// patchMetadata merges patch into a metadata section and validates the
+// result. Stores return metadata as decoded JSON, so it merges and compares
+// with the patch as it is.
+func (s *UserService) patchMetadata(section string, current, patch map[string]any) (map[string]any, error) {
+	merged := util.MergePatch(current, patch)
+
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata must be valid JSON", domain.ErrInvalidProfile)
+	}
+	if len(raw) > domain.MaxMetadataSize {
+		return nil, &domain.ProfileValidationError{Problems: []string{
+			fmt.Sprintf("metadata must be at most %d bytes once encoded", domain.MaxMetadataSize),
+		}}
+	}
+	if err := s.metadataValidator.Validate(section, merged); err != nil {
+		return nil, err
+	}
+	if len(merged) == 0 {
+		return nil, nil
+	}
+	return merged, nil
+}
+
+// metadataChanged reports whether a patched metadata section differs from
+// what is stored
+func metadataChanged(current, patched map[string]any) bool {
+	if len(current) == 0 && len(patched) == 0 {
+		return false
+	}
+	return !reflect.DeepEqual(current, patched)
+}
+
+// UpdateAdminMetadata applies a JSON merge patch to the metadata only admins
+// can see.
+func (s *UserService) UpdateAdminMetadata(ctx context.Context, id string, version int64, patch map[string]any) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for update: %w", err)
+	}
+	if err := checkVersion(user, version); err != nil {
+		return nil, err
+	}
+
+	metadata, err := s.patchMetadata(domain.MetadataSectionAdmin, user.AdminMetadata, patch)
+	if err != nil {
+		return nil, err
+	}
+	if !metadataChanged(user.AdminMetadata, metadata) {
+		return user, nil
+	}
+	user.AdminMetadata = metadata
+	if err := s.userRepo.Update(ctx, user, domain.UserFieldAdminMetadata); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionUserUpdate,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: id,
+		Details:  map[string]string{"fields": domain.UserFieldAdminMetadata},
+	})
+	return user, nil
+}
+
+// MetadataSchema returns the JSON schema a metadata section must follow, or
+// nil when any object is accepted.
+func (s *UserService) MetadataSchema(section string) json.RawMessage {
+	return s.metadataValidator.Schema(section)
+}
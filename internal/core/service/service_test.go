@@ -0,0 +1,605 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nisibz/go-auth-tests/internal/adapter/config"
+	"github.com/nisibz/go-auth-tests/internal/adapter/schema"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/local"
+	"github.com/nisibz/go-auth-tests/internal/adapter/storeages/memory"
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/port"
+	"github.com/nisibz/go-auth-tests/internal/core/service"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+const password = "password123"
+
+// mailbox keeps every email sent instead of delivering it
+type mailbox struct {
+	mu     sync.Mutex
+	emails []*domain.Email
+}
+
+func (m *mailbox) Send(ctx context.Context, email *domain.Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.emails = append(m.emails, email)
+	return nil
+}
+
+// last returns the last email sent to the address
+func (m *mailbox) last(t *testing.T, to string) *domain.Email {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.emails) - 1; i >= 0; i-- {
+		if m.emails[i].To == to {
+			return m.emails[i]
+		}
+	}
+	t.Fatalf("no email sent to %s", to)
+	return nil
+}
+
+// services are the user and auth services wired to a fresh in-memory
+// database, with the stores behind them
+type services struct {
+	users    *service.UserService
+	auth     *service.AuthService
+	audit    *service.AuditService
+	sessions port.SessionRepository
+	tokens   port.OneTimeTokenRepository
+	logins   port.LoginHistoryRepository
+	blobs    port.BlobStore
+	mail     *mailbox
+}
+
+func newServices(t *testing.T) *services {
+	t.Helper()
+	return newServicesWith(t, memory.NewUserRepository(), memory.NewOneTimeTokenRepository())
+}
+
+// newServicesWith wires the services to userRepo and tokenRepo instead of
+// fresh in-memory stores
+func newServicesWith(t *testing.T, userRepo port.UserRepository, tokenRepo port.OneTimeTokenRepository) *services {
+	t.Helper()
+	require.NoError(t, util.InitJWTSecretKey(&config.Container{
+		JwtSecretKey: &config.JWT{JWT_SECRET_KEY: "service-test-secret"},
+	}))
+
+	blobStore, err := local.NewBlobStore(t.TempDir())
+	require.NoError(t, err)
+	metadataValidator, err := schema.NewMetadataValidator("", "")
+	require.NoError(t, err)
+
+	sessionRepo := memory.NewSessionRepository()
+	loginHistoryRepo := memory.NewLoginHistoryRepository()
+	mailer := &mailbox{}
+	auditService := service.NewAuditService(memory.NewAuditRepository())
+
+	return &services{
+		users:    service.NewUserService(userRepo, sessionRepo, tokenRepo, loginHistoryRepo, blobStore, mailer, auditService, metadataValidator, "http://localhost"),
+		auth:     service.NewAuthService(userRepo, sessionRepo, tokenRepo, loginHistoryRepo, mailer, auditService, "http://localhost", 50),
+		audit:    auditService,
+		sessions: sessionRepo,
+		tokens:   tokenRepo,
+		logins:   loginHistoryRepo,
+		blobs:    blobStore,
+		mail:     mailer,
+	}
+}
+
+// verifyToken checks that token is valid and its session still active
+func (s *services) verifyToken(t *testing.T, token string) (*util.Claims, error) {
+	t.Helper()
+	claims, err := util.ValidateToken(token)
+	require.NoError(t, err)
+	return claims, s.auth.VerifySession(context.Background(), claims)
+}
+
+func TestCreateUser_DuplicateEmail(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	user, err := s.users.CreateUser(ctx, "Alice", "alice@example.com", password)
+	require.NoError(t, err)
+	assert.NotEmpty(t, user.ID)
+	assert.NotEqual(t, password, user.Password)
+
+	_, err = s.users.CreateUser(ctx, "Other Alice", "alice@example.com", password)
+	assert.ErrorIs(t, err, domain.ErrEmailTaken)
+
+	fetched, err := s.users.GetUserByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", fetched.Name)
+}
+
+// failingEmailLookups is a user store whose lookups by email fail while err
+// is set
+type failingEmailLookups struct {
+	port.UserRepository
+	err error
+}
+
+func (r *failingEmailLookups) GetByEmail(ctx context.Context, email string) (*domain.User, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.UserRepository.GetByEmail(ctx, email)
+}
+
+func TestEmailChecks_FailOnLookupErrors(t *testing.T) {
+	userRepo := &failingEmailLookups{UserRepository: memory.NewUserRepository()}
+	s := newServicesWith(t, userRepo, memory.NewOneTimeTokenRepository())
+	ctx := context.Background()
+
+	user, err := s.users.CreateUser(ctx, "Nina", "nina@example.com", password)
+	require.NoError(t, err)
+	user, err = s.users.UpdateUser(ctx, user.ID, user.Version, "Nina", "nina.new@example.com")
+	require.NoError(t, err)
+	match := regexp.MustCompile(`/email-change/confirm\?token=(\S+)`).FindStringSubmatch(s.mail.last(t, "nina.new@example.com").Body)
+	require.NotNil(t, match)
+	deleted, err := s.users.CreateUser(ctx, "Owen", "owen@example.com", password)
+	require.NoError(t, err)
+	require.NoError(t, s.users.DeleteUser(ctx, deleted.ID, deleted.Version))
+
+	lookupErr := errors.New("connection refused")
+	userRepo.err = lookupErr
+
+	_, err = s.auth.Register(ctx, "Paul", "paul@example.com", password)
+	assert.ErrorIs(t, err, lookupErr)
+	_, err = s.users.UpdateUser(ctx, user.ID, user.Version, "Nina", "nina.other@example.com")
+	assert.ErrorIs(t, err, lookupErr)
+	email := "nina.other@example.com"
+	_, err = s.users.PatchUser(ctx, user.ID, user.Version, &domain.UserPatch{Email: &email})
+	assert.ErrorIs(t, err, lookupErr)
+	_, err = s.users.ConfirmEmailChange(ctx, match[1])
+	assert.ErrorIs(t, err, lookupErr)
+	_, err = s.users.RestoreUser(ctx, deleted.ID)
+	assert.ErrorIs(t, err, lookupErr)
+
+	// Nothing was changed, so everything works once the store recovers
+	userRepo.err = nil
+	user, err = s.users.ConfirmEmailChange(ctx, match[1])
+	require.NoError(t, err)
+	assert.Equal(t, "nina.new@example.com", user.Email)
+	_, err = s.users.RestoreUser(ctx, deleted.ID)
+	assert.NoError(t, err)
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	token, err := s.auth.Register(ctx, "Bob", "bob@example.com", password)
+	require.NoError(t, err)
+	claims, err := s.verifyToken(t, token)
+	require.NoError(t, err)
+
+	_, err = s.auth.Register(ctx, "Bob Again", "bob@example.com", password)
+	assert.Error(t, err)
+
+	_, err = s.auth.Login(ctx, "bob@example.com", "wrong-password1")
+	assert.Error(t, err)
+	user, err := s.users.GetUserByID(ctx, claims.UserID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, user.FailedLogins)
+
+	token, err = s.auth.Login(ctx, "bob@example.com", password)
+	require.NoError(t, err)
+	_, err = s.verifyToken(t, token)
+	require.NoError(t, err)
+
+	user, err = s.users.GetUserByID(ctx, claims.UserID)
+	require.NoError(t, err)
+	assert.Zero(t, user.FailedLogins)
+
+	history, err := s.users.ListLoginHistory(ctx, user.ID, 10, 0)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.True(t, history[0].Success)
+	assert.False(t, history[1].Success)
+
+	verification, err := s.audit.Verify(ctx)
+	require.NoError(t, err)
+	assert.True(t, verification.Valid)
+	assert.Equal(t, int64(4), verification.Checked)
+}
+
+func TestRegister_PasswordPolicy(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	for _, weak := range []string{"pass1", "password", "12345678"} {
+		_, err := s.auth.Register(ctx, "Carl", "carl@example.com", weak)
+		assert.ErrorIs(t, err, domain.ErrWeakPassword, weak)
+	}
+	_, err := s.users.CreateUser(ctx, "Carl", "carl@example.com", "password")
+	assert.ErrorIs(t, err, domain.ErrWeakPassword)
+
+	_, err = s.auth.Register(ctx, "Carl", "carl@example.com", password)
+	assert.NoError(t, err)
+}
+
+func TestLogin_LocksAccount(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	_, err := s.users.CreateUser(ctx, "Carol", "carol@example.com", password)
+	require.NoError(t, err)
+
+	for range 5 {
+		_, err = s.auth.Login(ctx, "carol@example.com", "wrong-password1")
+		require.Error(t, err)
+	}
+	_, err = s.auth.Login(ctx, "carol@example.com", password)
+	assert.ErrorIs(t, err, domain.ErrAccountLocked)
+}
+
+func TestLogin_CountsConcurrentFailures(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	_, err := s.users.CreateUser(ctx, "Carl", "carl@example.com", password)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.auth.Login(ctx, "carl@example.com", "wrong-password1")
+			assert.NotErrorIs(t, err, domain.ErrVersionConflict)
+		}()
+	}
+	wg.Wait()
+
+	_, err = s.auth.Login(ctx, "carl@example.com", password)
+	assert.ErrorIs(t, err, domain.ErrAccountLocked)
+}
+
+// startMFALogin enables email codes for a new user and signs in with the
+// password, returning the token of the pending login
+func startMFALogin(t *testing.T, s *services, email string) string {
+	t.Helper()
+	ctx := context.Background()
+	user, err := s.users.CreateUser(ctx, "MFA User", email, password)
+	require.NoError(t, err)
+	_, err = s.users.UpdateMFASettings(ctx, user.ID, password, []string{domain.MFAMethodEmail}, "")
+	require.NoError(t, err)
+
+	_, err = s.auth.Login(ctx, email, password)
+	var mfaErr *domain.MFARequiredError
+	require.ErrorAs(t, err, &mfaErr)
+	return mfaErr.Token
+}
+
+func TestResendMFACode_KeepsAttempts(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+	mfaToken := startMFALogin(t, s, "ivy@example.com")
+
+	for range 4 {
+		_, err := s.auth.VerifyMFA(ctx, mfaToken, "wrong")
+		require.ErrorIs(t, err, domain.ErrInvalidMFACode)
+	}
+	require.NoError(t, s.auth.ResendMFACode(ctx, mfaToken, ""))
+
+	_, err := s.auth.VerifyMFA(ctx, mfaToken, "wrong")
+	require.ErrorIs(t, err, domain.ErrInvalidMFACode)
+	_, err = s.auth.VerifyMFA(ctx, mfaToken, "wrong")
+	assert.ErrorIs(t, err, domain.ErrTokenUsed)
+	assert.ErrorIs(t, s.auth.ResendMFACode(ctx, mfaToken, ""), domain.ErrTokenUsed)
+}
+
+func TestResendMFACode_Limit(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+	mfaToken := startMFALogin(t, s, "jack@example.com")
+
+	for range 3 {
+		require.NoError(t, s.auth.ResendMFACode(ctx, mfaToken, ""))
+	}
+	assert.ErrorIs(t, s.auth.ResendMFACode(ctx, mfaToken, ""), domain.ErrRateLimited)
+}
+
+// lockstepChallenges is a token store where, once reads is set, every read
+// of an MFA challenge waits for the others, so that they all see the same
+// number of attempts
+type lockstepChallenges struct {
+	port.OneTimeTokenRepository
+	reads *sync.WaitGroup
+}
+
+func (r *lockstepChallenges) GetByHash(ctx context.Context, purpose, tokenHash string) (*domain.OneTimeToken, error) {
+	token, err := r.OneTimeTokenRepository.GetByHash(ctx, purpose, tokenHash)
+	if r.reads != nil && purpose == domain.TokenPurposeMFAChallenge {
+		r.reads.Done()
+		r.reads.Wait()
+	}
+	return token, err
+}
+
+func TestVerifyMFA_ParallelGuesses(t *testing.T) {
+	tokenRepo := &lockstepChallenges{OneTimeTokenRepository: memory.NewOneTimeTokenRepository()}
+	s := newServicesWith(t, memory.NewUserRepository(), tokenRepo)
+	ctx := context.Background()
+	mfaToken := startMFALogin(t, s, "kim@example.com")
+	match := regexp.MustCompile(`code is (\d+)`).FindStringSubmatch(s.mail.last(t, "kim@example.com").Body)
+	require.NotNil(t, match)
+
+	const guesses = 20
+	tokenRepo.reads = &sync.WaitGroup{}
+	tokenRepo.reads.Add(guesses)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	compared := 0
+	for range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.auth.VerifyMFA(ctx, mfaToken, "000000x")
+			if errors.Is(err, domain.ErrInvalidMFACode) {
+				mu.Lock()
+				compared++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	tokenRepo.reads = nil
+
+	// Only the allowed number of guesses reach the code, and the right code
+	// no longer works afterwards
+	assert.Equal(t, 5, compared)
+	_, err := s.auth.VerifyMFA(ctx, mfaToken, match[1])
+	assert.ErrorIs(t, err, domain.ErrTokenUsed)
+}
+
+func TestChangePassword_RevokesOtherSessions(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	first, err := s.auth.Register(ctx, "Dave", "dave@example.com", password)
+	require.NoError(t, err)
+	second, err := s.auth.Login(ctx, "dave@example.com", password)
+	require.NoError(t, err)
+	claims, err := s.verifyToken(t, second)
+	require.NoError(t, err)
+
+	err = s.users.ChangePassword(ctx, claims.UserID, claims.SessionID, "wrong-password1", "newpassword456")
+	assert.ErrorIs(t, err, domain.ErrInvalidCredentials)
+	err = s.users.ChangePassword(ctx, claims.UserID, claims.SessionID, password, password)
+	assert.ErrorIs(t, err, domain.ErrPasswordReused)
+
+	require.NoError(t, s.users.ChangePassword(ctx, claims.UserID, claims.SessionID, password, "newpassword456"))
+
+	_, err = s.verifyToken(t, first)
+	assert.ErrorIs(t, err, domain.ErrSessionInvalid)
+	_, err = s.verifyToken(t, second)
+	assert.NoError(t, err)
+
+	_, err = s.auth.Login(ctx, "dave@example.com", password)
+	assert.Error(t, err)
+	_, err = s.auth.Login(ctx, "dave@example.com", "newpassword456")
+	assert.NoError(t, err)
+}
+
+func TestDeleteAndRestoreUser(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	token, err := s.auth.Register(ctx, "Erin", "erin@example.com", password)
+	require.NoError(t, err)
+	claims, err := s.verifyToken(t, token)
+	require.NoError(t, err)
+	user, err := s.users.GetUserByID(ctx, claims.UserID)
+	require.NoError(t, err)
+
+	err = s.users.DeleteUser(ctx, user.ID, user.Version+1)
+	assert.ErrorIs(t, err, domain.ErrVersionConflict)
+	require.NoError(t, s.users.DeleteUser(ctx, user.ID, user.Version))
+
+	_, err = s.users.GetUserByID(ctx, user.ID)
+	assert.ErrorIs(t, err, domain.ErrUserNotFound)
+	_, err = s.verifyToken(t, token)
+	assert.ErrorIs(t, err, domain.ErrSessionInvalid)
+	_, err = s.auth.Login(ctx, "erin@example.com", password)
+	assert.Error(t, err)
+
+	restored, err := s.users.RestoreUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	_, err = s.auth.Login(ctx, "erin@example.com", password)
+	assert.NoError(t, err)
+}
+
+func TestRestoreUser_EmailTaken(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	user, err := s.users.CreateUser(ctx, "Frank", "frank@example.com", password)
+	require.NoError(t, err)
+	require.NoError(t, s.users.DeleteUser(ctx, user.ID, user.Version))
+	_, err = s.users.CreateUser(ctx, "New Frank", "frank@example.com", password)
+	require.NoError(t, err)
+
+	_, err = s.users.RestoreUser(ctx, user.ID)
+	assert.ErrorIs(t, err, domain.ErrEmailTaken)
+}
+
+func TestListUsers_Pagination(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	var created []string
+	for i := range 5 {
+		user, err := s.users.CreateUser(ctx, fmt.Sprintf("User %d", i), fmt.Sprintf("user%d@example.com", i), password)
+		require.NoError(t, err)
+		created = append(created, user.ID)
+	}
+
+	page, err := s.users.ListUsers(ctx, nil, 2, 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), page.Total)
+	assert.Equal(t, created[2:4], ids(page.Items))
+	assert.True(t, page.HasMore)
+
+	// Walk the whole listing forward with cursors, then back again.
+	var forward []string
+	filter := &domain.UserFilter{}
+	for {
+		page, err = s.users.ListUsers(ctx, filter, 2, 0)
+		require.NoError(t, err)
+		forward = append(forward, ids(page.Items)...)
+		if page.NextCursor == "" {
+			break
+		}
+		filter = &domain.UserFilter{Cursor: parseCursor(t, page.NextCursor)}
+	}
+	assert.Equal(t, created, forward)
+
+	var backward []string
+	for page.PrevCursor != "" {
+		page, err = s.users.ListUsers(ctx, &domain.UserFilter{Cursor: parseCursor(t, page.PrevCursor)}, 2, 0)
+		require.NoError(t, err)
+		backward = append(ids(page.Items), backward...)
+	}
+	assert.Equal(t, created[:4], backward)
+}
+
+func TestExportUsers_EscapesFormulasForExcel(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	_, err := s.users.CreateUser(ctx, "=SUM(A1)", "sum@example.com", password)
+	require.NoError(t, err)
+
+	export := func(format string) string {
+		var buf bytes.Buffer
+		count, err := s.users.ExportUsers(ctx, &buf, &domain.UserFilter{}, &domain.ExportOptions{Format: format, Columns: []string{"name"}})
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+		return buf.String()
+	}
+	assert.Equal(t, "name\n=SUM(A1)\n", export(domain.ExportFormatCSV))
+	assert.Equal(t, "\ufeffname\r\n'=SUM(A1)\r\n", export(domain.ExportFormatExcel))
+}
+
+// encodePNG returns a blank PNG image of the given size
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))))
+	return buf.Bytes()
+}
+
+func TestUploadAvatar_TooManyPixels(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	user, err := s.users.CreateUser(ctx, "Gina", "gina@example.com", password)
+	require.NoError(t, err)
+
+	_, err = s.users.UploadAvatar(ctx, user.ID, bytes.NewReader(encodePNG(t, 4097, 4096)))
+	assert.ErrorIs(t, err, domain.ErrInvalidImage)
+	_, err = s.users.OpenAvatar(ctx, user.ID, "large")
+	assert.ErrorIs(t, err, domain.ErrBlobNotFound)
+}
+
+func TestUploadAvatar_ReencodesSizes(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	user, err := s.users.CreateUser(ctx, "Hank", "hank@example.com", password)
+	require.NoError(t, err)
+
+	user, err = s.users.UploadAvatar(ctx, user.ID, bytes.NewReader(encodePNG(t, 600, 400)))
+	require.NoError(t, err)
+	assert.Equal(t, "/api/users/"+user.ID+"/avatar?v="+user.Avatar, user.Profile.AvatarURL)
+
+	for _, size := range domain.AvatarSizes {
+		avatar, err := s.users.OpenAvatar(ctx, user.ID, size.Name)
+		require.NoError(t, err)
+		assert.Equal(t, "image/jpeg", avatar.Info.ContentType)
+		config, err := jpeg.DecodeConfig(avatar.Content)
+		avatar.Content.Close()
+		require.NoError(t, err)
+		assert.Equal(t, size.Pixels, config.Width, size.Name)
+		assert.Equal(t, size.Pixels, config.Height, size.Name)
+	}
+
+	require.NoError(t, s.users.DeleteAvatar(ctx, user.ID))
+	_, err = s.users.OpenAvatar(ctx, user.ID, "large")
+	assert.ErrorIs(t, err, domain.ErrBlobNotFound)
+}
+
+// changingUsers is a user store where every read is followed by a change
+// to the user's name, as if another request had updated it meanwhile
+type changingUsers struct {
+	port.UserRepository
+}
+
+func (r *changingUsers) GetByID(ctx context.Context, id string) (*domain.User, error) {
+	user, err := r.UserRepository.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	changed := *user
+	changed.Name = "Changed " + user.Name
+	changed.Version = domain.AnyVersion
+	if err := r.UserRepository.Update(ctx, &changed, domain.UserFieldName); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func TestUploadAvatar_ConcurrentChange(t *testing.T) {
+	userRepo := memory.NewUserRepository()
+	s := newServicesWith(t, &changingUsers{UserRepository: userRepo}, memory.NewOneTimeTokenRepository())
+	ctx := context.Background()
+
+	user, err := s.users.CreateUser(ctx, "Ivy", "ivy@example.com", password)
+	require.NoError(t, err)
+
+	_, err = s.users.UploadAvatar(ctx, user.ID, bytes.NewReader(encodePNG(t, 64, 64)))
+	require.NoError(t, err)
+	stored, err := userRepo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.NotEmpty(t, stored.Avatar)
+	assert.Equal(t, "Changed Ivy", stored.Name)
+
+	require.NoError(t, s.users.DeleteAvatar(ctx, user.ID))
+	stored, err = userRepo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, stored.Avatar)
+	assert.Equal(t, "Changed Changed Ivy", stored.Name)
+}
+
+func ids(users []*domain.User) []string {
+	ids := make([]string, 0, len(users))
+	for _, user := range users {
+		ids = append(ids, user.ID)
+	}
+	return ids
+}
+
+func parseCursor(t *testing.T, cursor string) *domain.UserCursor {
+	t.Helper()
+	parsed := &domain.UserCursor{}
+	require.NoError(t, util.ParseCursor(cursor, parsed))
+	return parsed
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// purgeBatchSize is how many deleted users are purged per repository query.
+const purgeBatchSize = 100
+
+// RestoreUser brings back a soft deleted user. It fails with
+// domain.ErrEmailTaken if another account took the email in the meantime.
+func (s *UserService) RestoreUser(ctx context.Context, id string) (*domain.User, error) {
+	user, err := s.userRepo.GetDeletedByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deleted user: %w", err)
+	}
+
+	_, err = s.userRepo.GetByEmail(ctx, user.Email)
+	if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+		return nil, fmt.Errorf("failed to look up the email: %w", err)
+	}
+	if err == nil {
+		s.audit.Record(ctx, &domain.AuditEvent{
+			Action:   domain.AuditActionUserRestore,
+			Outcome:  domain.AuditOutcomeFailure,
+			TargetID: id,
+			Details:  map[string]string{"reason": "email_taken"},
+		})
+		return nil, domain.ErrEmailTaken
+	}
+
+	if err := s.userRepo.Restore(ctx, id); err != nil {
+		return nil, fmt.Errorf("failed to restore user: %w", err)
+	}
+	user.DeletedAt = nil
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionUserRestore,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: id,
+	})
+	return user, nil
+}
+
+// PurgeDeletedUsers permanently removes users that were soft deleted more than
+// gracePeriod ago, together with their sessions, one-time tokens, login
+// history and avatar. Audit entries are kept since they only reference the user by ID.
+// It returns how many users were purged.
+func (s *UserService) PurgeDeletedUsers(ctx context.Context, gracePeriod time.Duration) (int, error) {
+	cutoff := time.Now().Add(-gracePeriod)
+	purged := 0
+	for {
+		users, err := s.userRepo.ListDeletedBefore(ctx, cutoff, purgeBatchSize)
+		if err != nil {
+			return purged, fmt.Errorf("failed to list deleted users: %w", err)
+		}
+		if len(users) == 0 {
+			return purged, nil
+		}
+
+		for _, user := range users {
+			if err := s.purgeUser(ctx, user); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+}
+
+func (s *UserService) purgeUser(ctx context.Context, user *domain.User) error {
+	if err := s.removeUser(ctx, user); err != nil {
+		return err
+	}
+
+	id := user.ID
+	slog.InfoContext(ctx, "Purged deleted user", "user_id", id)
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionUserPurge,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: id,
+	})
+	return nil
+}
+
+// removeUser permanently deletes a soft deleted user with their sessions,
+// one-time tokens, login history and avatar.
+func (s *UserService) removeUser(ctx context.Context, user *domain.User) error {
+	id := user.ID
+	if user.Avatar != "" {
+		s.deleteAvatarBlobs(ctx, id, user.Avatar)
+	}
+	// Related data goes first so that a failure leaves the user in place to
+	// be retried by the next run.
+	if err := s.sessionRepo.DeleteByUser(ctx, id); err != nil {
+		return fmt.Errorf("failed to purge sessions of user %s: %w", id, err)
+	}
+	if err := s.tokenRepo.DeleteByUser(ctx, id); err != nil {
+		return fmt.Errorf("failed to purge tokens of user %s: %w", id, err)
+	}
+	if err := s.loginHistoryRepo.DeleteByUser(ctx, id); err != nil {
+		return fmt.Errorf("failed to purge login history of user %s: %w", id, err)
+	}
+	if err := s.userRepo.Purge(ctx, id); err != nil {
+		return fmt.Errorf("failed to purge user %s: %w", id, err)
+	}
+	return nil
+}
@@ -2,24 +2,62 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/nisibz/go-auth-tests/internal/core/domain"
 	"github.com/nisibz/go-auth-tests/internal/core/port"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
 )
 
+// passwordHistorySize is how many previous passwords a user may not reuse.
+const passwordHistorySize = 5
+
 type UserService struct {
-	userRepo port.UserRepository
+	userRepo          port.UserRepository
+	sessionRepo       port.SessionRepository
+	tokenRepo         port.OneTimeTokenRepository
+	loginHistoryRepo  port.LoginHistoryRepository
+	blobStore         port.BlobStore
+	mailer            port.Mailer
+	audit             port.AuditService
+	metadataValidator port.MetadataValidator
+	appURL            string
 }
 
-func NewUserService(userRepo port.UserRepository) *UserService {
-	return &UserService{userRepo: userRepo}
+func NewUserService(
+	userRepo port.UserRepository,
+	sessionRepo port.SessionRepository,
+	tokenRepo port.OneTimeTokenRepository,
+	loginHistoryRepo port.LoginHistoryRepository,
+	blobStore port.BlobStore,
+	mailer port.Mailer,
+	audit port.AuditService,
+	metadataValidator port.MetadataValidator,
+	appURL string,
+) *UserService {
+	return &UserService{
+		userRepo:          userRepo,
+		sessionRepo:       sessionRepo,
+		tokenRepo:         tokenRepo,
+		loginHistoryRepo:  loginHistoryRepo,
+		blobStore:         blobStore,
+		mailer:            mailer,
+		audit:             audit,
+		metadataValidator: metadataValidator,
+		appURL:            appURL,
+	}
 }
 
 func (s *UserService) CreateUser(ctx context.Context, name, email, password string) (*domain.User, error) {
+	if err := util.ValidatePasswordPolicy(password); err != nil {
+		return nil, fmt.Errorf("%w: %v", domain.ErrWeakPassword, err)
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
@@ -28,6 +66,7 @@ func (s *UserService) CreateUser(ctx context.Context, name, email, password stri
 	user := &domain.User{
 		Name:      name,
 		Email:     email,
+		Status:    domain.UserStatusActive,
 		Password:  string(hashedPassword),
 		CreatedAt: time.Now(),
 	}
@@ -46,41 +85,166 @@ func (s *UserService) GetUserByID(ctx context.Context, id string) (*domain.User,
 	return user, nil
 }
 
-func (s *UserService) ListUsers(ctx context.Context, limit, offset int64) ([]*domain.User, error) {
-	users, err := s.userRepo.List(ctx, limit, offset)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list users: %w", err)
-	}
-	return users, nil
-}
-
-func (s *UserService) UpdateUser(ctx context.Context, id, name, email string) (*domain.User, error) {
+func (s *UserService) UpdateUser(ctx context.Context, id string, version int64, name, email string) (*domain.User, error) {
 	user, err := s.userRepo.GetByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user for update: %w", err)
 	}
+	if err := checkVersion(user, version); err != nil {
+		return nil, err
+	}
 
-	existingUser, err := s.userRepo.GetByEmail(context.Background(), email)
+	existingUser, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+		return nil, fmt.Errorf("failed to look up the email: %w", err)
+	}
 	if err == nil && existingUser.ID != user.ID {
 		return nil, fmt.Errorf("user with email %s already exists", email)
 	}
 
 	user.Name = name
-	user.Email = email
 
-	if err := s.userRepo.Update(ctx, user); err != nil {
+	// The login email only changes once the new address has been confirmed.
+	var emailChange *pendingEmailChange
+	if email != user.Email {
+		emailChange, err = s.startEmailChange(ctx, user, email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.userRepo.Update(ctx, user, domain.UserFieldName, domain.UserFieldPendingEmail); err != nil {
 		return nil, fmt.Errorf("failed to update user: %w", err)
 	}
+
+	details := map[string]string{}
+	if emailChange != nil {
+		details["email_change"] = "requested"
+	}
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionUserUpdate,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: id,
+		Details:  details,
+	})
+
+	if emailChange != nil {
+		if err := s.sendEmailChangeEmails(ctx, user, emailChange); err != nil {
+			return nil, err
+		}
+	}
 	return user, nil
 }
 
-func (s *UserService) DeleteUser(ctx context.Context, id string) error {
-	if err := s.userRepo.Delete(ctx, id); err != nil {
+// ChangePassword replaces the user's password after checking the current one,
+// then revokes every session except currentSessionID so that only the caller
+// stays signed in.
+func (s *UserService) ChangePassword(ctx context.Context, id, currentSessionID, currentPassword, newPassword string) error {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to get user for password change: %w", err)
+	}
+
+	if err := util.ComparePassword(currentPassword, user.Password); err != nil {
+		s.audit.Record(ctx, &domain.AuditEvent{
+			Action:   domain.AuditActionPasswordChange,
+			Outcome:  domain.AuditOutcomeFailure,
+			TargetID: id,
+			Details:  map[string]string{"reason": "invalid_password"},
+		})
+		return domain.ErrInvalidCredentials
+	}
+
+	if err := util.ValidatePasswordPolicy(newPassword); err != nil {
+		return fmt.Errorf("%w: %v", domain.ErrWeakPassword, err)
+	}
+
+	history := append([]string{user.Password}, user.PasswordHistory...)
+	for _, previous := range history {
+		if util.ComparePassword(newPassword, previous) == nil {
+			return domain.ErrPasswordReused
+		}
+	}
+
+	hashedPassword, err := util.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if len(history) > passwordHistorySize-1 {
+		history = history[:passwordHistorySize-1]
+	}
+
+	now := time.Now()
+	user.Password = hashedPassword
+	user.PasswordHistory = history
+	user.PasswordChangedAt = &now
+
+	if err := updateFields(ctx, s.userRepo, user, domain.UserFieldPassword, domain.UserFieldPasswordHistory, domain.UserFieldPasswordChangedAt); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	revoked, err := s.sessionRepo.RevokeAllForUser(ctx, id, currentSessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke other sessions: %w", err)
+	}
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionPasswordChange,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: id,
+		Details:  map[string]string{"revoked_sessions": strconv.FormatInt(revoked, 10)},
+	})
+	return nil
+}
+
+// DeleteUser soft deletes the user and signs them out everywhere. The account
+// can be restored until PurgeDeletedUsers removes it for good.
+func (s *UserService) DeleteUser(ctx context.Context, id string, version int64) error {
+	if err := s.userRepo.Delete(ctx, id, version); err != nil {
+		s.audit.Record(ctx, &domain.AuditEvent{
+			Action:   domain.AuditActionUserDelete,
+			Outcome:  domain.AuditOutcomeFailure,
+			TargetID: id,
+		})
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
+
+	if _, err := s.sessionRepo.RevokeAllForUser(ctx, id, ""); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionUserDelete,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: id,
+	})
+	return nil
+}
+
+// checkVersion fails with domain.ErrVersionConflict when the caller expects
+// another version of the user than the one just read.
+func checkVersion(user *domain.User, version int64) error {
+	if version != domain.AnyVersion && version != user.Version {
+		return domain.ErrVersionConflict
+	}
+	return nil
+}
+
+// updateFields writes the given fields of the user whatever its stored
+// version. It is meant for writes that no client If-Match guards, such as
+// confirming an email change: naming the fields keeps them from undoing
+// concurrent changes to the others.
+func updateFields(ctx context.Context, userRepo port.UserRepository, user *domain.User, fields ...string) error {
+	version := user.Version
+	user.Version = domain.AnyVersion
+	if err := userRepo.Update(ctx, user, fields...); err != nil {
+		user.Version = version
+		return err
+	}
 	return nil
 }
 
 func (s *UserService) CountUsers(ctx context.Context) (int64, error) {
-	return s.userRepo.Count(ctx)
+	return s.userRepo.Count(ctx, nil)
 }
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+func TestExportValue(t *testing.T) {
+	until := time.Date(2030, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	user := &domain.User{
+		ID:          "010203000000000000000000",
+		Name:        "Jane Doe",
+		Status:      domain.UserStatusSuspended,
+		StatusUntil: &until,
+		Profile:     domain.UserProfile{Locale: "fr-FR"},
+		Metadata:    map[string]any{"plan": "pro"},
+		CreatedAt:   time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+	}
+
+	assert.Equal(t, "Jane Doe", exportValue(user, "name"))
+	assert.Equal(t, domain.RoleUser, exportValue(user, "role"), "missing roles are exported as user")
+	assert.Equal(t, domain.UserStatusSuspended, exportValue(user, "status"))
+	assert.Equal(t, "2030-01-02T02:04:05Z", exportValue(user, "status_until"))
+	assert.Equal(t, "2024-01-01T12:00:00Z", exportValue(user, "created_at"))
+	assert.Equal(t, "fr-FR", exportValue(user, "locale"))
+	assert.Equal(t, map[string]any{"plan": "pro"}, exportValue(user, "metadata"))
+	assert.Equal(t, []string{}, exportValue(user, "mfa_methods"))
+	assert.Nil(t, exportValue(&domain.User{}, "status_until"))
+	assert.Equal(t, map[string]any{}, exportValue(&domain.User{}, "metadata"))
+	assert.Nil(t, exportValue(user, "password"))
+
+	// Expired suspensions are exported as active
+	past := time.Now().Add(-time.Hour)
+	assert.Equal(t, domain.UserStatusActive, exportValue(&domain.User{Status: domain.UserStatusSuspended, StatusUntil: &past}, "status"))
+}
+
+func TestCSVValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value any
+		want  string
+	}{
+		{"nil", nil, ""},
+		{"string", "Jane Doe", "Jane Doe"},
+		{"list", []string{"totp", "email"}, "totp;email"},
+		{"empty list", []string{}, ""},
+		{"object", map[string]any{"plan": "pro"}, `{"plan":"pro"}`},
+		{"phone", "+33612345678", "+33612345678"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := csvValue(tt.value)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err := csvValue(map[string]any{"bad": make(chan int)})
+	assert.Error(t, err)
+}
+
+func TestExcelSafe(t *testing.T) {
+	for _, cell := range []string{"=1+1", "+33612345678", "-2", "@cmd", "\tx", "\rx"} {
+		assert.Equal(t, "'"+cell, excelSafe(cell), cell)
+	}
+	for _, cell := range []string{"", "Jane", "jane@example.com", "1-2", " =1+1", "'quoted"} {
+		assert.Equal(t, cell, excelSafe(cell), cell)
+	}
+}
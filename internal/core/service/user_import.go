@@ -0,0 +1,409 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/mail"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+// invitationTTL is how long the sign-in link sent to imported users is valid
+const invitationTTL = 7 * 24 * time.Hour
+
+// maxImportLineSize bounds a single NDJSON line
+const maxImportLineSize = 64 << 10
+
+// ImportUsers creates users from a CSV or NDJSON file, reading it row by row
+// so that large files are never held in memory. Every row is validated
+// first; invalid rows are reported and never abort the import. Users without
+// a password can only sign in through links, such as the invitation sent
+// when opts.SendInvites is set.
+func (s *UserService) ImportUsers(ctx context.Context, r io.Reader, opts *domain.ImportOptions) (*domain.ImportReport, error) {
+	if opts.OnDuplicate != domain.ImportOnDuplicateSkip && opts.OnDuplicate != domain.ImportOnDuplicateUpsert {
+		return nil, fmt.Errorf("%w: duplicates must be skipped or upserted", domain.ErrInvalidImport)
+	}
+
+	var next func() (*domain.ImportRow, error)
+	switch opts.Format {
+	case domain.ImportFormatCSV:
+		var err error
+		if next, err = csvImportRows(r); err != nil {
+			return nil, err
+		}
+	case domain.ImportFormatNDJSON:
+		next = ndjsonImportRows(r)
+	default:
+		return nil, fmt.Errorf("%w: unsupported format %q", domain.ErrInvalidImport, opts.Format)
+	}
+
+	report := &domain.ImportReport{DryRun: opts.DryRun, Rows: []*domain.ImportRowResult{}}
+	seen := map[string]int{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		row, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var rowErr *importRowError
+			if errors.As(err, &rowErr) {
+				report.Add(&domain.ImportRowResult{Line: rowErr.line, Action: domain.ImportActionInvalid, Errors: []string{rowErr.msg}})
+				continue
+			}
+			return report, fmt.Errorf("failed to read import file: %w", err)
+		}
+		report.Add(s.importRow(ctx, row, opts, seen))
+	}
+
+	if !opts.DryRun {
+		s.audit.Record(ctx, &domain.AuditEvent{
+			Action:  domain.AuditActionUserImport,
+			Outcome: domain.AuditOutcomeSuccess,
+			Details: map[string]string{
+				"created": strconv.Itoa(report.Created),
+				"updated": strconv.Itoa(report.Updated),
+				"skipped": strconv.Itoa(report.Skipped),
+				"invalid": strconv.Itoa(report.Invalid),
+				"failed":  strconv.Itoa(report.Failed),
+			},
+		})
+	}
+	return report, nil
+}
+
+// importRowError is a row that could not be parsed, which does not prevent
+// reading the following ones
+type importRowError struct {
+	line int
+	msg  string
+}
+
+func (e *importRowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.msg)
+}
+
+// csvImportRows reads the header of a CSV file and returns a function reading
+// its rows one at a time
+func csvImportRows(r io.Reader) (func() (*domain.ImportRow, error), error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read the CSV header: %v", domain.ErrInvalidImport, err)
+	}
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff")))
+		if !slices.Contains(domain.ImportColumns, column) {
+			return nil, fmt.Errorf("%w: unknown column %q, expected some of %s", domain.ErrInvalidImport, column, strings.Join(domain.ImportColumns, ", "))
+		}
+		if slices.Contains(header[:i], column) {
+			return nil, fmt.Errorf("%w: column %q appears twice", domain.ErrInvalidImport, column)
+		}
+		header[i] = column
+	}
+	for _, required := range []string{"name", "email"} {
+		if !slices.Contains(header, required) {
+			return nil, fmt.Errorf("%w: missing required column %q", domain.ErrInvalidImport, required)
+		}
+	}
+
+	return func() (*domain.ImportRow, error) {
+		record, err := reader.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, &importRowError{line: parseErr.StartLine, msg: parseErr.Err.Error()}
+			}
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(record) != len(header) {
+			return nil, &importRowError{line: line, msg: fmt.Sprintf("expected %d fields, got %d", len(header), len(record))}
+		}
+		row := &domain.ImportRow{Line: line, Fields: make(map[string]string, len(header))}
+		for i, column := range header {
+			row.Fields[column] = record[i]
+		}
+		return row, nil
+	}, nil
+}
+
+// ndjsonImportRows returns a function reading one JSON object per line,
+// skipping blank lines
+func ndjsonImportRows(r io.Reader) func() (*domain.ImportRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), maxImportLineSize)
+	line := 0
+
+	return func() (*domain.ImportRow, error) {
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+
+			var object map[string]any
+			if err := json.Unmarshal([]byte(text), &object); err != nil || object == nil {
+				return nil, &importRowError{line: line, msg: "line is not a JSON object"}
+			}
+			row := &domain.ImportRow{Line: line, Fields: make(map[string]string, len(object))}
+			for key, value := range object {
+				if !slices.Contains(domain.ImportColumns, key) {
+					return nil, &importRowError{line: line, msg: fmt.Sprintf("unknown field %q", key)}
+				}
+				switch value := value.(type) {
+				case string:
+					row.Fields[key] = value
+				case nil:
+				default:
+					return nil, &importRowError{line: line, msg: fmt.Sprintf("%s must be a string", key)}
+				}
+			}
+			return row, nil
+		}
+		if err := scanner.Err(); err != nil {
+			if errors.Is(err, bufio.ErrTooLong) {
+				return nil, fmt.Errorf("%w: line %d is longer than %d bytes", domain.ErrInvalidImport, line+1, maxImportLineSize)
+			}
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+}
+
+// importedUser holds the validated fields of an import row
+type importedUser struct {
+	name     string
+	email    string
+	password string
+	role     string
+	status   string
+	profile  domain.ProfilePatch
+}
+
+// parseImportRow validates a row, returning every problem found
+func parseImportRow(row *domain.ImportRow) (*importedUser, []string) {
+	field := func(name string) string {
+		return strings.TrimSpace(row.Fields[name])
+	}
+	optional := func(name string) *string {
+		if value := field(name); value != "" {
+			return &value
+		}
+		return nil
+	}
+
+	user := &importedUser{
+		name:     field("name"),
+		email:    field("email"),
+		password: row.Fields["password"],
+		role:     field("role"),
+		status:   field("status"),
+		profile: domain.ProfilePatch{
+			DisplayName: optional("display_name"),
+			Locale:      optional("locale"),
+			Timezone:    optional("timezone"),
+			Phone:       optional("phone"),
+		},
+	}
+
+	var problems []string
+	if user.name == "" {
+		problems = append(problems, "name is required")
+	} else if len([]rune(user.name)) > 100 {
+		problems = append(problems, "name must be at most 100 characters long")
+	}
+	if user.email == "" {
+		problems = append(problems, "email is required")
+	} else if address, err := mail.ParseAddress(user.email); err != nil || address.Address != user.email {
+		problems = append(problems, "email is not a valid email address")
+	}
+	if user.password != "" {
+		if err := util.ValidatePasswordPolicy(user.password); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if user.role != "" && user.role != domain.RoleUser && user.role != domain.RoleAdmin {
+		problems = append(problems, fmt.Sprintf("role must be %s or %s", domain.RoleUser, domain.RoleAdmin))
+	}
+	if user.status != "" && !domain.IsValidUserStatus(user.status) {
+		problems = append(problems, fmt.Sprintf("status %q is not valid", user.status))
+	}
+	profile := user.profile.Apply(domain.UserProfile{})
+	var profileErr *domain.ProfileValidationError
+	if errors.As(domain.ValidateProfile(&profile), &profileErr) {
+		problems = append(problems, profileErr.Problems...)
+	}
+	return user, problems
+}
+
+func (s *UserService) importRow(ctx context.Context, row *domain.ImportRow, opts *domain.ImportOptions, seen map[string]int) *domain.ImportRowResult {
+	result := &domain.ImportRowResult{Line: row.Line, Email: strings.TrimSpace(row.Fields["email"])}
+	fail := func(action string, problems ...string) *domain.ImportRowResult {
+		result.Action = action
+		result.Errors = problems
+		return result
+	}
+
+	imported, problems := parseImportRow(row)
+	if len(problems) > 0 {
+		return fail(domain.ImportActionInvalid, problems...)
+	}
+	// Emails are compared exactly, like every lookup by email, so that a
+	// row is a duplicate within the file exactly when it would be one in
+	// the database
+	if line, ok := seen[imported.email]; ok {
+		return fail(domain.ImportActionInvalid, fmt.Sprintf("email already appears on line %d", line))
+	}
+	seen[imported.email] = row.Line
+
+	existing, err := s.userRepo.GetByEmail(ctx, imported.email)
+	if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+		return fail(domain.ImportActionFailed, fmt.Sprintf("failed to look up the email: %v", err))
+	}
+	switch {
+	case err == nil && opts.OnDuplicate == domain.ImportOnDuplicateSkip:
+		result.UserID = existing.ID
+		return fail(domain.ImportActionSkipped, "a user with this email already exists")
+	case err == nil:
+		result.UserID = existing.ID
+		result.Action = domain.ImportActionUpdated
+		if !opts.DryRun {
+			if err := s.updateImportedUser(ctx, existing, imported); err != nil {
+				return fail(domain.ImportActionFailed, err.Error())
+			}
+		}
+		return result
+	}
+
+	result.Action = domain.ImportActionCreated
+	if opts.DryRun {
+		return result
+	}
+	user, err := s.createImportedUser(ctx, imported)
+	if err != nil {
+		return fail(domain.ImportActionFailed, err.Error())
+	}
+	result.UserID = user.ID
+	if opts.SendInvites {
+		if err := s.sendInvitation(ctx, user); err != nil {
+			slog.ErrorContext(ctx, "Failed to send invitation", "user_id", user.ID, "error", err)
+			result.Errors = []string{"user created but the invitation could not be sent"}
+		}
+	}
+	return result
+}
+
+func (s *UserService) createImportedUser(ctx context.Context, imported *importedUser) (*domain.User, error) {
+	password := imported.password
+	if password == "" {
+		// A random password nobody knows, so that the account can only be
+		// accessed through sign-in links until the user sets one
+		random, _, err := util.GenerateRandomToken()
+		if err != nil {
+			return nil, err
+		}
+		password = random
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user := &domain.User{
+		Name:      imported.name,
+		Email:     imported.email,
+		Role:      imported.role,
+		Status:    imported.status,
+		Profile:   imported.profile.Apply(domain.UserProfile{}),
+		Password:  string(hashedPassword),
+		CreatedAt: time.Now(),
+	}
+	if user.Status == "" {
+		user.Status = domain.UserStatusActive
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+// updateImportedUser applies the fields given in an import row to an
+// existing user. Passwords are never changed by an import.
+func (s *UserService) updateImportedUser(ctx context.Context, user *domain.User, imported *importedUser) error {
+	previousStatus := user.CurrentStatus(time.Now())
+	user.Name = imported.name
+	if imported.role != "" {
+		user.Role = imported.role
+	}
+	if imported.status != "" && imported.status != previousStatus {
+		user.Status = imported.status
+		user.StatusReason = ""
+		user.StatusUntil = nil
+	}
+	user.Profile = imported.profile.Apply(user.Profile)
+
+	fields := []string{domain.UserFieldName, domain.UserFieldRole, domain.UserFieldStatus, domain.UserFieldStatusReason, domain.UserFieldStatusUntil, domain.UserFieldProfile}
+	if err := s.userRepo.Update(ctx, user, fields...); err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+	if imported.status != "" && imported.status != domain.UserStatusActive && imported.status != previousStatus {
+		if _, err := s.sessionRepo.RevokeAllForUser(ctx, user.ID, ""); err != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", err)
+		}
+	}
+	return nil
+}
+
+// sendInvitation emails a new user a sign-in link, valid longer than the
+// links users request themselves
+func (s *UserService) sendInvitation(ctx context.Context, user *domain.User) error {
+	tokenID, tokenIDHash, err := util.GenerateRandomToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	record := &domain.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   domain.TokenPurposeMagicLink,
+		TokenHash: tokenIDHash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(invitationTTL),
+	}
+	if err := s.tokenRepo.Create(ctx, record); err != nil {
+		return fmt.Errorf("failed to store invitation: %w", err)
+	}
+	token, err := util.GeneratePurposeToken(domain.TokenPurposeMagicLink, user.ID, tokenID, invitationTTL)
+	if err != nil {
+		return err
+	}
+
+	email := &domain.Email{
+		To:      user.Email,
+		Subject: "You have been invited",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nAn account has been created for you. Open the link below to sign in. It can only be used once and expires in 7 days.\n\n%s/magic-link?token=%s\n",
+			user.Name, s.appURL, token,
+		),
+	}
+	return s.mailer.Send(ctx, email)
+}
@@ -0,0 +1,143 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+func importUsers(t *testing.T, s *services, content string, opts *domain.ImportOptions) *domain.ImportReport {
+	t.Helper()
+	report, err := s.users.ImportUsers(context.Background(), strings.NewReader(content), opts)
+	require.NoError(t, err)
+	return report
+}
+
+func rowActions(report *domain.ImportReport) []string {
+	actions := make([]string, 0, len(report.Rows))
+	for _, row := range report.Rows {
+		actions = append(actions, row.Action)
+	}
+	return actions
+}
+
+func TestImportUsers_CSV(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	content := "\ufeffName, EMAIL,password,role,display_name\n" +
+		"Alice,alice@example.com,password123,admin,Ali\n" +
+		"Bob,not-an-email,,,\n" +
+		"Carol,carol@example.com\n" +
+		"Alice Again,alice@example.com,,,\n" +
+		"Dan,dan@example.com,,,\n"
+	report := importUsers(t, s, content, &domain.ImportOptions{Format: domain.ImportFormatCSV, OnDuplicate: domain.ImportOnDuplicateSkip})
+
+	assert.Equal(t, []string{
+		domain.ImportActionCreated, domain.ImportActionInvalid, domain.ImportActionInvalid,
+		domain.ImportActionInvalid, domain.ImportActionCreated,
+	}, rowActions(report))
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 3, report.Invalid)
+	assert.Equal(t, []int{2, 3, 4, 5, 6}, []int{report.Rows[0].Line, report.Rows[1].Line, report.Rows[2].Line, report.Rows[3].Line, report.Rows[4].Line})
+	assert.Contains(t, report.Rows[1].Errors, "email is not a valid email address")
+	assert.Equal(t, []string{"expected 5 fields, got 2"}, report.Rows[2].Errors)
+	assert.Equal(t, []string{"email already appears on line 2"}, report.Rows[3].Errors)
+
+	alice, err := s.users.GetUserByID(ctx, report.Rows[0].UserID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", alice.Name)
+	assert.Equal(t, domain.RoleAdmin, alice.Role)
+	assert.Equal(t, "Ali", alice.Profile.DisplayName)
+	_, err = s.auth.Login(ctx, "alice@example.com", "password123")
+	assert.NoError(t, err)
+
+	_, err = s.users.ImportUsers(ctx, strings.NewReader("name,email,age\n"), &domain.ImportOptions{Format: domain.ImportFormatCSV, OnDuplicate: domain.ImportOnDuplicateSkip})
+	assert.ErrorIs(t, err, domain.ErrInvalidImport)
+	_, err = s.users.ImportUsers(ctx, strings.NewReader("name\n"), &domain.ImportOptions{Format: domain.ImportFormatCSV, OnDuplicate: domain.ImportOnDuplicateSkip})
+	assert.ErrorIs(t, err, domain.ErrInvalidImport)
+}
+
+func TestImportUsers_NDJSON(t *testing.T) {
+	s := newServices(t)
+
+	content := `{"name": "Alice", "email": "alice@example.com", "phone": null}` + "\n" +
+		"\n" +
+		`["not", "an", "object"]` + "\n" +
+		`{"name": "Bob", "email": "bob@example.com", "age": "42"}` + "\n" +
+		`{"name": "Carol", "email": "carol@example.com", "role": 1}` + "\n" +
+		`{"name": "Dan", "email": "dan@example.com", "status": "suspended"}` + "\n"
+	report := importUsers(t, s, content, &domain.ImportOptions{Format: domain.ImportFormatNDJSON, OnDuplicate: domain.ImportOnDuplicateSkip})
+
+	assert.Equal(t, []string{
+		domain.ImportActionCreated, domain.ImportActionInvalid, domain.ImportActionInvalid,
+		domain.ImportActionInvalid, domain.ImportActionCreated,
+	}, rowActions(report))
+	assert.Equal(t, 1, report.Rows[0].Line)
+	assert.Equal(t, []string{"line is not a JSON object"}, report.Rows[1].Errors)
+	assert.Equal(t, 3, report.Rows[1].Line)
+	assert.Equal(t, []string{`unknown field "age"`}, report.Rows[2].Errors)
+	assert.Equal(t, []string{"role must be a string"}, report.Rows[3].Errors)
+
+	dan, err := s.users.GetUserByID(context.Background(), report.Rows[4].UserID)
+	require.NoError(t, err)
+	assert.Equal(t, domain.UserStatusSuspended, dan.Status)
+}
+
+func TestImportUsers_SkipAndUpsert(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	existing, err := s.users.CreateUser(ctx, "Alice", "alice@example.com", password)
+	require.NoError(t, err)
+	content := "name,email,password,role\nAlice Smith,alice@example.com,otherpassword456,admin\n"
+
+	report := importUsers(t, s, content, &domain.ImportOptions{Format: domain.ImportFormatCSV, OnDuplicate: domain.ImportOnDuplicateSkip})
+	assert.Equal(t, []string{domain.ImportActionSkipped}, rowActions(report))
+	assert.Equal(t, existing.ID, report.Rows[0].UserID)
+	user, err := s.users.GetUserByID(ctx, existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", user.Name)
+
+	report = importUsers(t, s, content, &domain.ImportOptions{Format: domain.ImportFormatCSV, OnDuplicate: domain.ImportOnDuplicateUpsert})
+	assert.Equal(t, []string{domain.ImportActionUpdated}, rowActions(report))
+	assert.Equal(t, existing.ID, report.Rows[0].UserID)
+	user, err = s.users.GetUserByID(ctx, existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice Smith", user.Name)
+	assert.Equal(t, domain.RoleAdmin, user.Role)
+
+	// Imports never change the password of an existing user
+	_, err = s.auth.Login(ctx, "alice@example.com", password)
+	assert.NoError(t, err)
+
+	// Emails match exactly, like every other lookup by email
+	report = importUsers(t, s, "name,email\nAlice Upper,Alice@example.com\n", &domain.ImportOptions{Format: domain.ImportFormatCSV, OnDuplicate: domain.ImportOnDuplicateSkip})
+	assert.Equal(t, []string{domain.ImportActionCreated}, rowActions(report))
+	assert.NotEqual(t, existing.ID, report.Rows[0].UserID)
+}
+
+func TestImportUsers_DryRun(t *testing.T) {
+	s := newServices(t)
+	ctx := context.Background()
+
+	existing, err := s.users.CreateUser(ctx, "Alice", "alice@example.com", password)
+	require.NoError(t, err)
+	content := "name,email\nAlice Smith,alice@example.com\nBob,bob@example.com\nBob Again,bob@example.com\n"
+
+	report := importUsers(t, s, content, &domain.ImportOptions{Format: domain.ImportFormatCSV, OnDuplicate: domain.ImportOnDuplicateUpsert, DryRun: true})
+	assert.True(t, report.DryRun)
+	assert.Equal(t, []string{domain.ImportActionUpdated, domain.ImportActionCreated, domain.ImportActionInvalid}, rowActions(report))
+
+	count, err := s.users.CountUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), count)
+	user, err := s.users.GetUserByID(ctx, existing.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", user.Name)
+}
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+	"github.com/nisibz/go-auth-tests/internal/core/util"
+)
+
+// ListUsers returns a page of users matching filter. When the listing is
+// sorted by creation date the page carries signed cursors for the pages
+// around it.
+func (s *UserService) ListUsers(ctx context.Context, filter *domain.UserFilter, limit, offset int64) (*domain.Page[*domain.User], error) {
+	if filter == nil {
+		filter = &domain.UserFilter{}
+	}
+
+	// One extra user tells whether another page follows.
+	fetch := limit
+	if limit > 0 {
+		fetch = limit + 1
+	}
+	users, total, err := s.userRepo.ListAndCount(ctx, filter, fetch, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	current := filter.Cursor
+	backward := current != nil && current.Backward
+	extra := limit > 0 && int64(len(users)) > limit
+	if extra {
+		// A backward page is in listing order, so the extra user is the
+		// first one.
+		if backward {
+			users = users[1:]
+		} else {
+			users = users[:limit]
+		}
+	}
+	if users == nil {
+		users = []*domain.User{}
+	}
+	if current != nil {
+		offset = 0
+	}
+
+	// A backward page always has a page after it, the one it came from.
+	hasNext := extra || backward
+	hasPrev := (current != nil && !backward) || (current == nil && offset > 0) || (backward && extra)
+
+	page := &domain.Page[*domain.User]{
+		Items:   users,
+		Total:   total,
+		Limit:   limit,
+		Offset:  offset,
+		HasMore: hasNext,
+	}
+	if !domain.SupportsUserCursor(filter.Sort) || len(users) == 0 {
+		return page, nil
+	}
+
+	desc := len(filter.Sort) == 1 && filter.Sort[0].Desc
+	if hasNext {
+		last := users[len(users)-1]
+		page.NextCursor, err = util.SignCursor(&domain.UserCursor{CreatedAt: last.CreatedAt, ID: last.ID, Desc: desc})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hasPrev {
+		first := users[0]
+		page.PrevCursor, err = util.SignCursor(&domain.UserCursor{CreatedAt: first.CreatedAt, ID: first.ID, Desc: desc, Backward: true})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nisibz/go-auth-tests/internal/core/domain"
+)
+
+// PatchUser applies a partial update to the user, writing only the fields
+// that actually change. A new email goes through the same confirmation flow
+// as UpdateUser, profile fields are checked for format and metadata against
+// the deployment's schema.
+func (s *UserService) PatchUser(ctx context.Context, id string, version int64, patch *domain.UserPatch) (*domain.User, error) {
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user for update: %w", err)
+	}
+	if err := checkVersion(user, version); err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	if patch.Name != nil && *patch.Name != user.Name {
+		user.Name = *patch.Name
+		changed = append(changed, domain.UserFieldName)
+	}
+
+	if patch.Profile != nil {
+		profile := patch.Profile.Apply(user.Profile)
+		if err := domain.ValidateProfile(&profile); err != nil {
+			return nil, err
+		}
+		if profile != user.Profile {
+			user.Profile = profile
+			changed = append(changed, domain.UserFieldProfile)
+		}
+	}
+
+	if patch.Metadata != nil {
+		metadata, err := s.patchMetadata(domain.MetadataSectionUser, user.Metadata, patch.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		if metadataChanged(user.Metadata, metadata) {
+			user.Metadata = metadata
+			changed = append(changed, domain.UserFieldMetadata)
+		}
+	}
+
+	var emailChange *pendingEmailChange
+	if patch.Email != nil && *patch.Email != user.Email {
+		existingUser, err := s.userRepo.GetByEmail(ctx, *patch.Email)
+		if err != nil && !errors.Is(err, domain.ErrUserNotFound) {
+			return nil, fmt.Errorf("failed to look up the email: %w", err)
+		}
+		if err == nil && existingUser.ID != user.ID {
+			return nil, domain.ErrEmailTaken
+		}
+		emailChange, err = s.startEmailChange(ctx, user, *patch.Email)
+		if err != nil {
+			return nil, err
+		}
+		changed = append(changed, domain.UserFieldPendingEmail)
+	}
+
+	if len(changed) == 0 {
+		return user, nil
+	}
+	if err := s.userRepo.Update(ctx, user, changed...); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	details := map[string]string{}
+	if emailChange != nil {
+		details["email_change"] = "requested"
+	}
+	s.audit.Record(ctx, &domain.AuditEvent{
+		Action:   domain.AuditActionUserUpdate,
+		Outcome:  domain.AuditOutcomeSuccess,
+		TargetID: id,
+		Details:  details,
+	})
+
+	if emailChange != nil {
+		if err := s.sendEmailChangeEmails(ctx, user, emailChange); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
@@ -10,13 +10,45 @@ import (
 
 var jwtSecretKey []byte
 
-const tokenExpirationDuration = 24 * time.Hour // Token valid for 24 hours
+const TokenExpirationDuration = 24 * time.Hour // Token valid for 24 hours
+
+// Authentication methods recorded in the amr claim (RFC 8176)
+const (
+	AMRPassword = "pwd"
+	AMROTP      = "otp"
+	AMRMFA      = "mfa"
+	// AMREmail marks a sign-in through a link sent by email
+	AMREmail = "email"
+)
 
 type Claims struct {
-	UserID string `json:"user_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid"`
+	// AuthTime is when the user last actively authenticated, which stays
+	// the same when a token is reissued for the same session.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	AMR      []string         `json:"amr,omitempty"`
+	// Act identifies the admin behind an impersonation token (RFC 8693)
+	Act *Actor `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// IsImpersonation reports whether the token was issued to an admin acting as
+// another user.
+func (c *Claims) IsImpersonation() bool {
+	return c.Act != nil
+}
+
+// AuthenticatedWithin reports whether the user actively authenticated no
+// longer than maxAge ago.
+func (c *Claims) AuthenticatedWithin(maxAge time.Duration) bool {
+	return c.AuthTime != nil && time.Since(c.AuthTime.Time) <= maxAge
+}
+
 func InitJWTSecretKey(cfg *config.Container) error {
 	if cfg == nil || cfg.JwtSecretKey == nil || cfg.JwtSecretKey.JWT_SECRET_KEY == "" {
 		return fmt.Errorf("JWT secret key not found in config")
@@ -25,14 +57,17 @@ func InitJWTSecretKey(cfg *config.Container) error {
 	return nil
 }
 
-func GenerateToken(userID string) (string, error) {
+func GenerateToken(userID, sessionID string, authTime time.Time, amr []string) (string, error) {
 	if len(jwtSecretKey) == 0 {
 		return "", fmt.Errorf("JWT_SECRET_KEY environment variable not set or empty")
 	}
 
-	expirationTime := time.Now().Add(tokenExpirationDuration)
+	expirationTime := time.Now().Add(TokenExpirationDuration)
 	claims := &Claims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
+		AuthTime:  jwt.NewNumericDate(authTime),
+		AMR:       amr,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -48,11 +83,38 @@ func GenerateToken(userID string) (string, error) {
 	return tokenString, nil
 }
 
-func ValidateToken(tokenString string) (string, error) {
+// GenerateImpersonationToken issues a short-lived token for userID on behalf
+// of actorID. It carries no auth_time so it never passes step-up checks.
+func GenerateImpersonationToken(userID, sessionID, actorID string, ttl time.Duration) (string, error) {
 	if len(jwtSecretKey) == 0 {
 		return "", fmt.Errorf("JWT_SECRET_KEY environment variable not set or empty")
 	}
 
+	now := time.Now()
+	claims := &Claims{
+		UserID:    userID,
+		SessionID: sessionID,
+		Act:       &Actor{Subject: actorID},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(jwtSecretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return tokenString, nil
+}
+
+func ValidateToken(tokenString string) (*Claims, error) {
+	if len(jwtSecretKey) == 0 {
+		return nil, fmt.Errorf("JWT_SECRET_KEY environment variable not set or empty")
+	}
+
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
@@ -61,12 +123,67 @@ func ValidateToken(tokenString string) (string, error) {
 		return jwtSecretKey, nil
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to parse token: %w", err)
+		return nil, fmt.Errorf("failed to parse token: %w", err)
 	}
 
 	if !token.Valid {
-		return "", fmt.Errorf("invalid token")
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
+
+// PurposeClaims are carried by single-purpose tokens, such as magic links,
+// that must never be accepted as access tokens.
+type PurposeClaims struct {
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+func GeneratePurposeToken(purpose, userID, tokenID string, ttl time.Duration) (string, error) {
+	if len(jwtSecretKey) == 0 {
+		return "", fmt.Errorf("JWT_SECRET_KEY environment variable not set or empty")
+	}
+
+	now := time.Now()
+	claims := &PurposeClaims{
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   userID,
+			ID:        tokenID,
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	tokenString, err := token.SignedString(jwtSecretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return tokenString, nil
+}
+
+func ValidatePurposeToken(purpose, tokenString string) (*PurposeClaims, error) {
+	if len(jwtSecretKey) == 0 {
+		return nil, fmt.Errorf("JWT_SECRET_KEY environment variable not set or empty")
+	}
+
+	claims := &PurposeClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return jwtSecretKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	if !token.Valid || claims.Purpose != purpose {
+		return nil, fmt.Errorf("invalid token")
 	}
 
-	return claims.UserID, nil
+	return claims, nil
 }
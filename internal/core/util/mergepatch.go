@@ -0,0 +1,25 @@
+package util
+
+// MergePatch applies a JSON merge patch (RFC 7396) to target and returns the
+// result. Nil values in patch remove keys, nested objects are merged
+// recursively and any other value replaces the target's. target is not
+// modified.
+func MergePatch(target, patch map[string]any) map[string]any {
+	result := make(map[string]any, len(target)+len(patch))
+	for key, value := range target {
+		result[key] = value
+	}
+	for key, value := range patch {
+		if value == nil {
+			delete(result, key)
+			continue
+		}
+		if patchObject, ok := value.(map[string]any); ok {
+			targetObject, _ := result[key].(map[string]any)
+			result[key] = MergePatch(targetObject, patchObject)
+			continue
+		}
+		result[key] = value
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"fmt"
+	"unicode"
+)
+
+const (
+	passwordMinLength = 8
+	// bcrypt silently ignores everything past 72 bytes
+	passwordMaxLength = 72
+)
+
+// ValidatePasswordPolicy checks that a new password is long enough and mixes
+// letters with digits.
+func ValidatePasswordPolicy(password string) error {
+	if len(password) < passwordMinLength {
+		return fmt.Errorf("password must be at least %d characters long", passwordMinLength)
+	}
+	if len(password) > passwordMaxLength {
+		return fmt.Errorf("password must be at most %d bytes long", passwordMaxLength)
+	}
+
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return fmt.Errorf("password must contain both letters and digits")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package util
+
+import (
+	"sync"
+	"time"
+)
+
+// RateLimiter is an in-memory fixed-window limiter keyed by an arbitrary
+// string such as an email address or IP.
+type RateLimiter struct {
+	mu        sync.Mutex
+	limit     int
+	window    time.Duration
+	windows   map[string]*rateWindow
+	lastSweep time.Time
+}
+
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		limit:   limit,
+		window:  window,
+		windows: make(map[string]*rateWindow),
+	}
+}
+
+// Allow records a hit for key and reports whether it is within the limit.
+func (l *RateLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.window {
+		l.sweep(now)
+		w = &rateWindow{start: now}
+		l.windows[key] = w
+	}
+	w.count++
+	return w.count <= l.limit
+}
+
+// sweep drops expired windows, at most once per window, so that the map
+// doesn't grow without bound.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+	for key, w := range l.windows {
+		if now.Sub(w.start) >= l.window {
+			delete(l.windows, key)
+		}
+	}
+}